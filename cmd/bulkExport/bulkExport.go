@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/vladwithcode/qrcatalog/internal/db"
@@ -24,6 +28,11 @@ func main() {
 
 	flags := parseFlags()
 
+	ctx, cancel := context.WithTimeout(context.Background(), flags.Timeout)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
 	conn, err := db.Connect()
 	if err != nil {
 		fmt.Printf("failed to connect to db: %v\n", err)
@@ -38,27 +47,39 @@ func main() {
 	}
 	defer file.Close()
 
-	ctx := context.Background()
-	var data ExportData
-
-	sections, err := db.FindAllSections(ctx)
+	err = exportSections(ctx, file, db.FindAllSections)
 	if err != nil {
-		fmt.Printf("failed to find all sections: %v\n", err)
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			fmt.Printf("export timed out after %s\n", flags.Timeout)
+		case errors.Is(ctx.Err(), context.Canceled):
+			fmt.Println("export cancelled")
+		}
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	data.Sections = sections
-	err = json.NewEncoder(file).Encode(data)
+	fmt.Println("Sections exported successfully")
+}
+
+// exportSections writes the sections returned by find to w as [ExportData]
+func exportSections(ctx context.Context, w io.Writer, find func(context.Context) ([]*db.Section, error)) error {
+	sections, err := find(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find all sections: %w", err)
+	}
+
+	err = json.NewEncoder(w).Encode(ExportData{Sections: sections})
 	if err != nil {
-		fmt.Printf("failed to encode json: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to encode json: %w", err)
 	}
 
-	fmt.Println("Sections exported successfully")
+	return nil
 }
 
 type Flags struct {
-	File string `json:"file"`
+	File    string        `json:"file"`
+	Timeout time.Duration `json:"timeout"`
 }
 
 func parseFlags() Flags {
@@ -66,6 +87,7 @@ func parseFlags() Flags {
 
 	flag.StringVar(&flags.File, "f", "", "File to export")
 	flag.StringVar(&flags.File, "file", "", "File to export")
+	flag.DurationVar(&flags.Timeout, "timeout", 5*time.Minute, "Abort the export if it takes longer than this")
 	flag.Parse()
 
 	if flags.File == "" {
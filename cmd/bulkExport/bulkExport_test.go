@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+func TestExportSectionsAbortsOnDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var out bytes.Buffer
+	err := exportSections(ctx, &out, func(ctx context.Context) ([]*db.Section, error) {
+		// Simulates a hung query, it only returns once ctx is done
+		select {
+		case <-time.After(time.Minute):
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected nothing to be written, got %q", out.String())
+	}
+}
+
+func TestExportSectionsWritesExportData(t *testing.T) {
+	var out bytes.Buffer
+	err := exportSections(context.Background(), &out, func(ctx context.Context) ([]*db.Section, error) {
+		return []*db.Section{{Name: "inicio"}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data ExportData
+	if err := json.Unmarshal(out.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Sections) != 1 || data.Sections[0].Name != "inicio" {
+		t.Errorf("got sections %+v, want the exported one", data.Sections)
+	}
+}
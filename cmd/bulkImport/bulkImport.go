@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/vladwithcode/qrcatalog/internal/db"
 )
@@ -25,6 +27,11 @@ func main() {
 
 	flags := parseFlags()
 
+	ctx, cancel := context.WithTimeout(context.Background(), flags.Timeout)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
 	conn, err := db.Connect()
 	if err != nil {
 		fmt.Printf("failed to connect to db: %v\n", err)
@@ -45,29 +52,61 @@ func main() {
 		fmt.Printf("failed to decode json: %v\n", err)
 		return
 	}
-	ctx := context.Background()
 	tx, err := conn.Begin(ctx)
 	if err != nil {
 		fmt.Printf("failed to begin transaction: %v\n", err)
 		return
 	}
-	defer tx.Rollback(ctx)
-
-	for _, section := range data.Sections {
-		id := uuid.Must(uuid.NewV7()).String()
-		section.ID = id
-		err = db.CreateSection(ctx, &section)
-		if err != nil {
-			fmt.Printf("failed to create section \"%s\": %v\n", section.Name, err)
-			return
-		}
+	// Rollback with a fresh context, ctx may be the reason we're bailing out
+	defer tx.Rollback(context.Background())
+
+	err = importSections(ctx, data.Sections, func(ctx context.Context, section *db.Section) error {
+		return db.CreateSectionTx(ctx, tx, section)
+	})
+	if err != nil {
+		reportCtxErr(ctx, flags.Timeout)
+		fmt.Printf("%v, nothing was imported\n", err)
+		return
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		reportCtxErr(ctx, flags.Timeout)
+		fmt.Printf("failed to commit import, nothing was imported: %v\n", err)
+		return
 	}
 
 	fmt.Println("Sections imported successfully")
 }
 
+// importSections creates the sections in order using create, stopping at the
+// first failure or as soon as ctx is done
+func importSections(ctx context.Context, sections []db.Section, create func(context.Context, *db.Section) error) error {
+	for i := range sections {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("failed to create section \"%s\": %w", sections[i].Name, err)
+		}
+		if err := create(ctx, &sections[i]); err != nil {
+			return fmt.Errorf("failed to create section \"%s\": %w", sections[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// reportCtxErr explains why the import stopped when ctx is done
+func reportCtxErr(ctx context.Context, timeout time.Duration) {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		fmt.Printf("import timed out after %s\n", timeout)
+	case errors.Is(ctx.Err(), context.Canceled):
+		fmt.Println("import cancelled")
+	}
+}
+
 type Flags struct {
-	File string `json:"file"`
+	File    string        `json:"file"`
+	Timeout time.Duration `json:"timeout"`
 }
 
 func parseFlags() Flags {
@@ -75,6 +114,7 @@ func parseFlags() Flags {
 
 	flag.StringVar(&flags.File, "f", "", "File to import")
 	flag.StringVar(&flags.File, "file", "", "File to import")
+	flag.DurationVar(&flags.Timeout, "timeout", 5*time.Minute, "Abort the import if it takes longer than this")
 	flag.Parse()
 
 	if flags.File == "" {
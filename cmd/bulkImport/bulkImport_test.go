@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+// slowCreate simulates a hung insert, it only returns once ctx is done
+func slowCreate(ctx context.Context, section *db.Section) error {
+	select {
+	case <-time.After(time.Minute):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestImportSectionsAbortsOnDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var created []string
+	sections := []db.Section{{Name: "first"}, {Name: "slow"}, {Name: "last"}}
+	err := importSections(ctx, sections, func(ctx context.Context, section *db.Section) error {
+		created = append(created, section.Name)
+		if section.Name == "slow" {
+			return slowCreate(ctx, section)
+		}
+		return nil
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(created) != 2 {
+		t.Errorf("got sections %v attempted, want the import to stop at the slow one", created)
+	}
+}
+
+func TestImportSectionsStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := importSections(ctx, []db.Section{{Name: "first"}}, func(ctx context.Context, section *db.Section) error {
+		t.Error("expected no section to be created after cancellation")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
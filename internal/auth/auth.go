@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -46,6 +45,8 @@ func SetAuthParameters() {
 	if envMaxAge > 0 {
 		DefaultCookieMaxAge = envMaxAge
 	}
+
+	setSigningKeys()
 }
 
 var (
@@ -74,6 +75,8 @@ func (a *Auth) HasAccess(reqLv AccessLevel) bool {
 		roleLv = 0
 	case db.RoleAdmin:
 		roleLv = 1
+	case db.RoleSuperAdmin:
+		roleLv = 2
 	}
 
 	return roleLv >= reqLv
@@ -93,10 +96,7 @@ type AuthCtxKey string
 const DefaultAuthCtxKey AuthCtxKey = "auth"
 
 func CreateToken(user *db.User) (string, error) {
-	var (
-		t *jwt.Token
-		k = os.Getenv("JWT_SECRET")
-	)
+	var t *jwt.Token
 	expTime := time.Now().Add(DefaultExpirationTime)
 
 	t = jwt.NewWithClaims(jwt.SigningMethodHS256, AuthClaims{
@@ -110,22 +110,11 @@ func CreateToken(user *db.User) (string, error) {
 		},
 	})
 
-	return t.SignedString([]byte(k))
+	return signToken(t)
 }
 
 func ParseToken(tokenStr string) (*jwt.Token, error) {
-	var (
-		t *jwt.Token
-		k = os.Getenv("JWT_SECRET")
-	)
-
-	t, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
-		}
-
-		return []byte(k), nil
-	})
+	t, err := jwt.Parse(tokenStr, verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -244,6 +233,31 @@ func ValidateAuth(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// RequireAccess validates the request's auth and rejects it with a 403 if
+// the user's role doesn't reach the required access level
+func RequireAccess(reqLv AccessLevel, next http.HandlerFunc) http.HandlerFunc {
+	return ValidateAuth(func(w http.ResponseWriter, r *http.Request) {
+		a, err := ExtractAuthFromReq(r)
+		if err != nil || !a.HasAccess(reqLv) {
+			RejectUnauthorized(w, r, "No tienes permiso para realizar esta acción")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func RejectUnauthorized(w http.ResponseWriter, r *http.Request, reason string) {
+	resData := map[string]string{
+		"error": reason,
+	}
+	w.WriteHeader(http.StatusForbidden)
+	err := json.NewEncoder(w).Encode(resData)
+	if err != nil {
+		log.Printf("failed to write error response: %v\n", err)
+	}
+}
+
 func RejectUnauthenticated(w http.ResponseWriter, r *http.Request, reason string) {
 	resData := map[string]string{
 		"error": reason,
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+const (
+	// CartShareTokenDuration is how long a shared cart link stays valid
+	CartShareTokenDuration = time.Hour * 24 * 7
+	// cartShareAudience keeps share tokens from being accepted as session
+	// tokens and the other way around
+	cartShareAudience = "cart_share"
+)
+
+var (
+	ErrCartShareTokenInvalid = errors.New("invalid cart share token")
+	ErrCartShareTokenExpired = errors.New("cart share token expired")
+)
+
+// CartShareClaims identifies the shared cart by its share id, never by the
+// cart id, which is what grants write access to the cart
+type CartShareClaims struct {
+	ShareID string
+
+	jwt.RegisteredClaims
+}
+
+// CreateCartShareToken returns a signed, read only token granting access to
+// the cart's contents until it expires
+func CreateCartShareToken(ctx context.Context, cartID string) (string, error) {
+	shareID, err := db.GetCartShareID(ctx, cartID)
+	if err != nil {
+		return "", err
+	}
+
+	return signCartShareToken(shareID, time.Now())
+}
+
+// signCartShareToken signs a share token for shareID issued at issuedAt
+func signCartShareToken(shareID string, issuedAt time.Time) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, CartShareClaims{
+		shareID,
+
+		jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{cartShareAudience},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(CartShareTokenDuration)),
+		},
+	})
+
+	return signToken(t)
+}
+
+// ParseCartShareToken validates a token created by CreateCartShareToken and
+// returns the share id of the shared cart
+func ParseCartShareToken(tokenStr string) (string, error) {
+	claims := &CartShareClaims{}
+	t, err := jwt.ParseWithClaims(
+		tokenStr,
+		claims,
+		verificationKey,
+		jwt.WithAudience(cartShareAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return "", ErrCartShareTokenExpired
+		}
+		return "", errors.Join(ErrCartShareTokenInvalid, err)
+	}
+	if !t.Valid || claims.ShareID == "" {
+		return "", ErrCartShareTokenInvalid
+	}
+
+	return claims.ShareID, nil
+}
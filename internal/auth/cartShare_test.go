@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCartShareTokenRoundTrip(t *testing.T) {
+	useSigningKeys(t, "secret", "k1", "")
+
+	tokenStr, err := signCartShareToken("share-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shareID, err := ParseCartShareToken(tokenStr)
+	if err != nil {
+		t.Fatalf("expected the token to parse, got %v", err)
+	}
+	if shareID != "share-1" {
+		t.Errorf("got share id %q, want share-1", shareID)
+	}
+}
+
+func TestExpiredCartShareToken(t *testing.T) {
+	useSigningKeys(t, "secret", "k1", "")
+
+	issuedAt := time.Now().Add(-CartShareTokenDuration - time.Minute)
+	tokenStr, err := signCartShareToken("share-1", issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseCartShareToken(tokenStr); !errors.Is(err, ErrCartShareTokenExpired) {
+		t.Errorf("expected ErrCartShareTokenExpired, got %v", err)
+	}
+}
+
+func TestSessionTokensAreNotCartShareTokens(t *testing.T) {
+	useSigningKeys(t, "secret", "k1", "")
+
+	tokenStr, err := CreateToken(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseCartShareToken(tokenStr); !errors.Is(err, ErrCartShareTokenInvalid) {
+		t.Errorf("expected ErrCartShareTokenInvalid, got %v", err)
+	}
+}
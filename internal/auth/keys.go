@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// EnvVarJWTSecret holds the secret used to sign new tokens
+	EnvVarJWTSecret = "JWT_SECRET"
+	// EnvVarJWTKeyID holds the id of the signing secret, sent in the kid header
+	EnvVarJWTKeyID = "JWT_KEY_ID"
+	// EnvVarJWTAcceptedKeys holds previous secrets that are still accepted for
+	// verification, as a comma separated list of kid:secret pairs
+	EnvVarJWTAcceptedKeys = "JWT_ACCEPTED_KEYS"
+)
+
+// DefaultJWTKeyID is the kid of the signing secret if JWT_KEY_ID isn't set
+const DefaultJWTKeyID = "default"
+
+var (
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+)
+
+var (
+	signingKeyID = DefaultJWTKeyID
+	// acceptedKeys maps the kid of every secret accepted for verification,
+	// other than the signing one, to its secret
+	acceptedKeys = map[string][]byte{}
+)
+
+// setSigningKeys reads the signing key and the accepted verification keys
+// from the environment. To rotate the secret, move the current one to
+// JWT_ACCEPTED_KEYS under its kid and set a new JWT_SECRET and JWT_KEY_ID, so
+// tokens signed with the old secret stay valid until they expire
+func setSigningKeys() {
+	if envKeyID := os.Getenv(EnvVarJWTKeyID); envKeyID != "" {
+		signingKeyID = envKeyID
+	}
+
+	keys := map[string][]byte{}
+	for _, pair := range strings.Split(os.Getenv(EnvVarJWTAcceptedKeys), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || secret == "" {
+			log.Printf("ignoring malformed %s entry\n", EnvVarJWTAcceptedKeys)
+			continue
+		}
+		if kid == signingKeyID {
+			log.Printf("ignoring %s entry %q, it matches the signing key id\n", EnvVarJWTAcceptedKeys, kid)
+			continue
+		}
+		keys[kid] = []byte(secret)
+	}
+	acceptedKeys = keys
+}
+
+// signToken signs t with the current signing secret, setting its kid header
+func signToken(t *jwt.Token) (string, error) {
+	t.Header["kid"] = signingKeyID
+	return t.SignedString([]byte(os.Getenv(EnvVarJWTSecret)))
+}
+
+// verificationKey is the jwt.Keyfunc used to parse tokens. It picks the
+// secret matching the token's kid header. Tokens issued before kids were set
+// are checked against the signing secret and every accepted one
+func verificationKey(t *jwt.Token) (any, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+	}
+
+	signingKey := []byte(os.Getenv(EnvVarJWTSecret))
+	kid, hasKid := t.Header["kid"].(string)
+	if !hasKid {
+		set := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{signingKey}}
+		for _, k := range acceptedKeys {
+			set.Keys = append(set.Keys, k)
+		}
+		return set, nil
+	}
+
+	if kid == signingKeyID {
+		return signingKey, nil
+	}
+	if k, ok := acceptedKeys[kid]; ok {
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+// useSigningKeys sets the key env vars and reloads the keys, restoring the
+// previous ones once the test ends
+func useSigningKeys(t *testing.T, secret, keyID, accepted string) {
+	t.Helper()
+
+	prevKeyID, prevAccepted := signingKeyID, acceptedKeys
+	t.Cleanup(func() {
+		signingKeyID, acceptedKeys = prevKeyID, prevAccepted
+	})
+
+	t.Setenv(EnvVarJWTSecret, secret)
+	t.Setenv(EnvVarJWTKeyID, keyID)
+	t.Setenv(EnvVarJWTAcceptedKeys, accepted)
+	setSigningKeys()
+}
+
+func testUser() *db.User {
+	return &db.User{ID: "user-1", Username: "admin", Fullname: "Admin", Role: db.RoleAdmin}
+}
+
+func TestTokensCarryTheCurrentKeyID(t *testing.T) {
+	useSigningKeys(t, "secret-2", "k2", "k1:secret-1")
+
+	tokenStr, err := CreateToken(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != "k2" {
+		t.Errorf("got kid %v, want k2", kid)
+	}
+	if _, err := ParseToken(tokenStr); err != nil {
+		t.Errorf("expected the token to parse, got %v", err)
+	}
+}
+
+func TestTokensSignedWithAnAcceptedKeyStillParse(t *testing.T) {
+	useSigningKeys(t, "secret-1", "k1", "")
+	oldToken, err := CreateToken(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate, keeping the old secret as accepted
+	useSigningKeys(t, "secret-2", "k2", "k1:secret-1")
+	if _, err := ParseToken(oldToken); err != nil {
+		t.Errorf("expected the old token to parse, got %v", err)
+	}
+
+	// Once the old secret is dropped, its tokens are rejected
+	useSigningKeys(t, "secret-2", "k2", "")
+	if _, err := ParseToken(oldToken); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("expected ErrUnknownSigningKey, got %v", err)
+	}
+}
+
+func TestTokensWithAnUnknownKeyIDAreRejected(t *testing.T) {
+	useSigningKeys(t, "secret-2", "k2", "k1:secret-1")
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"ID": "user-1"})
+	token.Header["kid"] = "k9"
+	tokenStr, err := token.SignedString([]byte("secret-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseToken(tokenStr); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("expected ErrUnknownSigningKey, got %v", err)
+	}
+}
+
+func TestTokensWithoutKeyIDAreCheckedAgainstEveryKey(t *testing.T) {
+	useSigningKeys(t, "secret-2", "k2", "k1:secret-1")
+
+	for _, secret := range []string{"secret-1", "secret-2"} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"ID": "user-1"})
+		tokenStr, err := token.SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseToken(tokenStr); err != nil {
+			t.Errorf("token signed with %s: expected it to parse, got %v", secret, err)
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"ID": "user-1"})
+	tokenStr, _ := token.SignedString([]byte("other"))
+	if _, err := ParseToken(tokenStr); err == nil {
+		t.Error("expected a token signed with an unknown secret to be rejected")
+	}
+}
+
+func TestSetSigningKeysIgnoresMalformedEntries(t *testing.T) {
+	useSigningKeys(t, "secret-2", "k2", "k1:secret-1, broken, :nokid, k2:shadow, k3:")
+
+	if len(acceptedKeys) != 1 || string(acceptedKeys["k1"]) != "secret-1" {
+		t.Errorf("got accepted keys %v, want only k1", acceptedKeys)
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/vladwithcode/qrcatalog/internal/utils"
 )
 
 const DefaultCartCookieDuration = time.Hour * 24 * 30 // 30 days
@@ -22,6 +24,11 @@ var (
 	ErrCartSaveFailedData         = errors.New("failed to save cart data")
 	ErrCartSaveFailedItems        = errors.New("failed to save cart items")
 	ErrCartSaveFailedRemovedItems = errors.New("failed to save removed cart items")
+	ErrCartSubmitted              = errors.New("cart has already been submitted")
+	ErrCartContactMissing         = errors.New("cart needs a customer email or phone")
+	ErrCartContactInvalid         = errors.New("cart customer contact is invalid")
+	ErrCartInsufficientStock      = errors.New("not enough stock for cart item")
+	ErrCartProductUnavailable     = errors.New("cart item product is no longer available")
 )
 
 type Cart struct {
@@ -36,6 +43,25 @@ type Cart struct {
 	updatedFields map[string]bool `json:"-"`
 	removedItems  []string        `json:"-"`
 	isNew         bool            `json:"-"`
+	// persisted holds the customer fields as last read from/written to the
+	// db, so fields assigned directly on the struct are still detected
+	persisted map[string]string `json:"-"`
+}
+
+// cartFieldColumns maps the accepted field keys to their carts column
+var cartFieldColumns = map[string]string{
+	"CustomerName":   "customer_name",
+	"customer_name":  "customer_name",
+	"CustomerEmail":  "customer_email",
+	"customer_email": "customer_email",
+	"CustomerPhone":  "customer_phone",
+	"customer_phone": "customer_phone",
+	"Items":          "items",
+	"items":          "items",
+	"CreatedAt":      "created_at",
+	"created_at":     "created_at",
+	"IsSubmitted":    "is_submitted",
+	"is_submitted":   "is_submitted",
 }
 
 type CartItem struct {
@@ -45,10 +71,22 @@ type CartItem struct {
 	ImageURL  string    `json:"image_url"`
 	Quantity  int       `json:"quantity"`
 	MaxQty    int       `json:"max_quantity"`
+	MinQty    int       `json:"min_quantity"`         // Products may only be ordered in multiples of this
+	Price     float64   `json:"price"`                // Unit price, only set by LoadItems
 	Source    string    `json:"source"`               // "wizard" or "catalog"
 	StepIndex int       `json:"step_index,omitempty"` // For wizard items
 	CreatedAt time.Time `json:"created_at"`           // AddedAt
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Note and Customizations are set by the customer (e.g. "blue tablecloths")
+	Note           string            `json:"note,omitempty"`
+	Customizations map[string]string `json:"customizations,omitempty"`
+}
+
+// Subtotal returns the item's price times its quantity. The price is only
+// known once the items have been loaded with LoadItems
+func (i *CartItem) Subtotal() float64 {
+	return i.Price * float64(i.Quantity)
 }
 
 type CartItemSource string
@@ -58,8 +96,13 @@ const (
 	CartItemSourceCatalog CartItemSource = "catálogo"
 )
 
+// NewCart returns an empty cart with the given id, or a fresh one if no id
+// (or an empty one) is given
 func NewCart(id ...string) *Cart {
-	cartID := id[0]
+	var cartID string
+	if len(id) > 0 {
+		cartID = id[0]
+	}
 	if cartID == "" {
 		cartID = uuid.Must(uuid.NewV7()).String()
 	}
@@ -78,6 +121,96 @@ func NewCart(id ...string) *Cart {
 	}
 }
 
+// CanSubmit checks the cart has a way to reach the customer, requiring a
+// valid email, a valid phone or both
+func (c *Cart) CanSubmit() error {
+	if c.IsSubmitted {
+		return ErrCartSubmitted
+	}
+
+	email := strings.TrimSpace(c.CustomerEmail)
+	phone := strings.TrimSpace(c.CustomerPhone)
+	if email == "" && phone == "" {
+		return ErrCartContactMissing
+	}
+
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			return fmt.Errorf("%w: email %q", ErrCartContactInvalid, email)
+		}
+	}
+	if phone != "" {
+		if _, err := utils.FormatPhone(phone); err != nil {
+			return fmt.Errorf("%w: phone %q", ErrCartContactInvalid, phone)
+		}
+	}
+
+	return nil
+}
+
+// UpdateCartCustomer writes only the customer fields of the cart, creating
+// its row if it doesn't exist yet. The email and phone are validated when
+// given, and submitted carts are rejected with ErrCartSubmitted
+func UpdateCartCustomer(ctx context.Context, cartID string, name, email, phone string) error {
+	if _, err := uuid.Parse(cartID); err != nil {
+		return ErrCartIDInvalidMissing
+	}
+
+	name = strings.TrimSpace(name)
+	email = strings.TrimSpace(email)
+	phone = strings.TrimSpace(phone)
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			return fmt.Errorf("%w: email %q", ErrCartContactInvalid, email)
+		}
+	}
+	if phone != "" {
+		if _, err := utils.FormatPhone(phone); err != nil {
+			return fmt.Errorf("%w: phone %q", ErrCartContactInvalid, phone)
+		}
+	}
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`INSERT INTO carts (id, customer_name, customer_email, customer_phone)
+		VALUES (@id, @customer_name, @customer_email, @customer_phone)
+		ON CONFLICT (id) DO UPDATE SET
+			customer_name = @customer_name,
+			customer_email = @customer_email,
+			customer_phone = @customer_phone
+		WHERE NOT carts.is_submitted`,
+		pgx.NamedArgs{
+			"id":             cartID,
+			"customer_name":  name,
+			"customer_email": email,
+			"customer_phone": phone,
+		},
+	)
+	if err != nil {
+		return errors.Join(ErrCartSaveFailedData, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCartSubmitted
+	}
+
+	return nil
+}
+
+// Total returns the sum of every item's subtotal
+func (c *Cart) Total() float64 {
+	var total float64
+	for _, item := range c.Items {
+		total += item.Subtotal()
+	}
+	return total
+}
+
 func (c *Cart) GetField(key string) any {
 	switch key {
 	case "CustomerName", "customer_name":
@@ -118,38 +251,107 @@ func (c *Cart) SetField(key string, value any) error {
 		return ErrCartSetFieldInvalid
 	}
 
+	return c.MarkDirty(key)
+}
+
+// MarkDirty flags the field so the next Save writes it
+func (c *Cart) MarkDirty(field string) error {
+	column, ok := cartFieldColumns[field]
+	if !ok {
+		return ErrCartSetFieldInvalid
+	}
+	if c.updatedFields == nil {
+		c.updatedFields = make(map[string]bool)
+	}
+	c.updatedFields[column] = true
 	return nil
 }
 
 // SetFrom receives a map of cart fields and updates the cart with the values
-// from the map. It also marks the changed fields as updated.
+// from the map, marking them as updated. Unknown fields are ignored
 func (c *Cart) SetFrom(fieldsPtr *map[string]any) {
-	cartFields := *fieldsPtr
-	for k, v := range cartFields {
-		err := c.SetField(k, v)
-		if err == nil {
-			c.updatedFields[k] = true
+	for k, v := range *fieldsPtr {
+		c.SetField(k, v)
+	}
+}
+
+// markChangedCustomerFields marks the customer fields that differ from what
+// was last persisted, catching the ones assigned without SetField
+func (c *Cart) markChangedCustomerFields() {
+	for column, value := range c.customerFields() {
+		if value != c.persisted[column] {
+			c.MarkDirty(column)
 		}
 	}
 }
 
+// markPersisted records the current customer fields as saved and clears the
+// pending changes
+func (c *Cart) markPersisted() {
+	c.persisted = c.customerFields()
+	c.updatedFields = make(map[string]bool)
+	c.removedItems = make([]string, 0)
+	c.isNew = false
+}
+
+func (c *Cart) customerFields() map[string]string {
+	return map[string]string{
+		"customer_name":  c.CustomerName,
+		"customer_email": c.CustomerEmail,
+		"customer_phone": c.CustomerPhone,
+	}
+}
+
 func (c *Cart) AddItem(item *CartItem) {
-	c.updatedFields["items"] = true
+	c.MarkDirty("items")
 	exists := false
 	for _, i := range c.Items {
 		if i.ProductID == item.ProductID {
 			exists = true
-			i.Quantity += item.Quantity
+			if i.MinQty < 1 {
+				i.MinQty = item.MinQty
+			}
+			if i.MaxQty < 1 {
+				i.MaxQty = item.MaxQty
+			}
+			i.Quantity = clampItemQty(i.Quantity+item.Quantity, i.MinQty, i.MaxQty)
+			if i.Quantity == 0 {
+				// The stock can't cover a single minimum lot
+				c.RemoveItem(i.ProductID)
+				return
+			}
+			if item.Note != "" {
+				i.Note = item.Note
+			}
+			if len(item.Customizations) > 0 {
+				i.Customizations = item.Customizations
+			}
 			break
 		}
 	}
 	if !exists {
+		item.Quantity = clampItemQty(item.Quantity, item.MinQty, item.MaxQty)
+		if item.Quantity == 0 {
+			return
+		}
 		c.Items = append(c.Items, item)
 	}
 }
 
+// SetItemNote replaces the note and customizations of the item
+func (c *Cart) SetItemNote(itemID string, note string, customizations map[string]string) {
+	for _, item := range c.Items {
+		if item.ProductID == itemID {
+			c.MarkDirty("items")
+			item.Note = note
+			item.Customizations = customizations
+			break
+		}
+	}
+}
+
 func (c *Cart) UpdateItemQty(itemID string, quantity int) {
-	c.updatedFields["items"] = true
+	c.MarkDirty("items")
 	if quantity <= 0 {
 		c.RemoveItem(itemID)
 		return
@@ -157,14 +359,43 @@ func (c *Cart) UpdateItemQty(itemID string, quantity int) {
 
 	for i, item := range c.Items {
 		if itemID == item.ProductID {
-			c.Items[i].Quantity = min(quantity, item.MaxQty)
+			quantity = clampItemQty(quantity, item.MinQty, item.MaxQty)
+			if quantity == 0 {
+				// The stock can't cover a single minimum lot
+				c.RemoveItem(itemID)
+				return
+			}
+			c.Items[i].Quantity = quantity
 			break
 		}
 	}
 }
 
+// clampItemQty rounds qty up to a multiple of minQty and, when maxQty is
+// set, lowers it to the largest multiple of minQty that doesn't exceed
+// maxQty. It returns 0 when maxQty can't cover a single minQty lot
+func clampItemQty(qty, minQty, maxQty int) int {
+	qty = roundUpToMinQty(qty, minQty)
+	if maxQty > 0 && qty > maxQty {
+		qty = maxQty - maxQty%max(minQty, 1)
+	}
+	return qty
+}
+
+// roundUpToMinQty rounds qty up to the next multiple of minQty. A minQty
+// lower than 1 is treated as 1
+func roundUpToMinQty(qty, minQty int) int {
+	if minQty <= 1 || qty <= 0 {
+		return qty
+	}
+	if rem := qty % minQty; rem != 0 {
+		qty += minQty - rem
+	}
+	return qty
+}
+
 func (c *Cart) RemoveItem(itemID string) {
-	c.updatedFields["items"] = true
+	c.MarkDirty("items")
 	c.removedItems = append(c.removedItems, itemID)
 	if len(c.Items) == 0 {
 		return
@@ -208,6 +439,12 @@ func (c *Cart) Save(ctx context.Context) error {
 	if c.ID == "" {
 		return ErrCartIDInvalidMissing
 	}
+	// Submitted carts are read-only, unless this save is the one submitting it
+	if c.IsSubmitted && !c.updatedFields["is_submitted"] {
+		return ErrCartSubmitted
+	}
+	c.markChangedCustomerFields()
+
 	conn, err := GetConnWithContext(ctx)
 	if err != nil {
 		return err
@@ -218,9 +455,25 @@ func (c *Cart) Save(ctx context.Context) error {
 		return err
 	}
 
-	// Insert/update cart data only if it's a new cart or there are updated fields
-	// skip for saves with only item updates
-	if (c.isNew || len(c.updatedFields) > 0) && !(len(c.updatedFields) == 1 && c.updatedFields["items"]) {
+	// The in-memory flag may be stale, so the stored one is checked too. The
+	// row stays locked until the save commits, so the cart can't be submitted
+	// halfway through
+	var submitted bool
+	err = tx.QueryRow(ctx, `SELECT is_submitted FROM carts WHERE id = $1 FOR UPDATE`, c.ID).Scan(&submitted)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		tx.Rollback(ctx)
+		return fmt.Errorf("failed to save cart: %w", err)
+	}
+	if submitted {
+		tx.Rollback(ctx)
+		return ErrCartSubmitted
+	}
+
+	// Insert/update cart data only if it's a new cart or there are updated
+	// fields other than the items. New carts are always inserted so their
+	// items have a cart to reference
+	hasCartFields := len(c.updatedFields) > 1 || (len(c.updatedFields) == 1 && !c.updatedFields["items"])
+	if c.isNew || hasCartFields {
 		baseQuery := `INSERT INTO carts`
 		args := pgx.NamedArgs{"id": c.ID}
 
@@ -241,10 +494,14 @@ func (c *Cart) Save(ctx context.Context) error {
 		}
 		columnStr += ")"
 		argStr += ")"
-		updtStr += " " + strings.Join(updtFields, ", ")
+		updtStr += " " + strings.Join(updtFields, ", ") + " WHERE NOT carts.is_submitted"
 		baseQuery = fmt.Sprintf("%s %s VALUES %s", baseQuery, columnStr, argStr)
 		if len(updtFields) > 0 {
 			baseQuery += " " + updtStr
+		} else {
+			// A new cart with only items changed may already have its row
+			// (e.g. one built from a cookie id), which must not fail the save
+			baseQuery += " ON CONFLICT (id) DO NOTHING"
 		}
 
 		_, err = tx.Exec(ctx, baseQuery, args)
@@ -254,24 +511,31 @@ func (c *Cart) Save(ctx context.Context) error {
 		tx.Rollback(ctx)
 		return fmt.Errorf("failed to save cart: %w", err)
 	}
-	c.isNew = false
 
 	if c.updatedFields["items"] {
 		for _, item := range c.Items {
+			customizations := item.Customizations
+			if customizations == nil {
+				customizations = map[string]string{}
+			}
 			args := pgx.NamedArgs{
-				"cart_id":    c.ID,
-				"product_id": item.ProductID,
-				"quantity":   item.Quantity,
-				"source":     item.Source,
-				"created_at": item.CreatedAt,
+				"cart_id":        c.ID,
+				"product_id":     item.ProductID,
+				"quantity":       item.Quantity,
+				"source":         item.Source,
+				"note":           item.Note,
+				"customizations": customizations,
+				"created_at":     item.CreatedAt,
 			}
 			_, err = tx.Exec(
 				ctx,
-				`INSERT INTO cart_items (cart_id, product_id, quantity, source, created_at, updated_at)
-				VALUES (@cart_id, @product_id, @quantity, @source, @created_at, NOW())
+				`INSERT INTO cart_items (cart_id, product_id, quantity, source, note, customizations, created_at, updated_at)
+				VALUES (@cart_id, @product_id, @quantity, @source, @note, @customizations, @created_at, NOW())
 				ON CONFLICT (cart_id, product_id) DO UPDATE SET
 					quantity = @quantity,
 					source = @source,
+					note = @note,
+					customizations = @customizations,
 					updated_at = NOW()
 			`,
 				args,
@@ -296,7 +560,13 @@ func (c *Cart) Save(ctx context.Context) error {
 		}
 	}
 
-	return tx.Commit(ctx)
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	c.markPersisted()
+
+	return nil
 }
 
 // LoadItems loads all items for this cart from the database
@@ -307,13 +577,21 @@ func (c *Cart) LoadItems(ctx context.Context) error {
 	}
 	defer conn.Release()
 
+	// Rows are grouped by product so any duplicated (cart_id, product_id)
+	// rows in legacy data collapse into a single item
 	rows, err := conn.Query(ctx, `
-		SELECT ci.product_id, ci.quantity, ci.source, ci.created_at, ci.updated_at,
-		       cp.name, cp.category_name, cp.image_url, cp.quantity as max_quantity
+		SELECT ci.product_id, SUM(ci.quantity)::int, (ARRAY_AGG(ci.source ORDER BY ci.created_at))[1],
+		       MIN(ci.created_at), MAX(ci.updated_at),
+		       cp.name, cp.category_name, cp.image_url, cp.quantity as max_quantity,
+		       p.min_order_qty, COALESCE(cp.price, 0),
+		       (ARRAY_AGG(ci.note ORDER BY ci.updated_at DESC))[1],
+		       (ARRAY_AGG(ci.customizations ORDER BY ci.updated_at DESC))[1]
 		FROM cart_items ci
 		JOIN catalog_products cp ON ci.product_id = cp.id
+		JOIN products p ON ci.product_id = p.id
 		WHERE ci.cart_id = $1
-		ORDER BY ci.created_at
+		GROUP BY ci.product_id, cp.name, cp.category_name, cp.image_url, cp.quantity, cp.price, p.min_order_qty
+		ORDER BY MIN(ci.created_at)
 	`, c.ID)
 	if err != nil {
 		return err
@@ -326,6 +604,7 @@ func (c *Cart) LoadItems(ctx context.Context) error {
 		err = rows.Scan(
 			&item.ProductID, &item.Quantity, &item.Source, &item.CreatedAt, &item.UpdatedAt,
 			&item.Name, &item.Category, &item.ImageURL, &item.MaxQty,
+			&item.MinQty, &item.Price, &item.Note, &item.Customizations,
 		)
 		if err != nil {
 			return err
@@ -336,6 +615,55 @@ func (c *Cart) LoadItems(ctx context.Context) error {
 	return rows.Err()
 }
 
+// DedupCartItems merges duplicated (cart_id, product_id) rows into a single
+// row holding the summed quantity and returns the number of rows removed.
+// cart_items_pkey already rejects duplicates, so this is only a defensive
+// helper for legacy data, e.g. rows restored from a dump without the key
+func DedupCartItems(ctx context.Context) (int, error) {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE cart_items ci SET quantity = dups.total
+		FROM (
+			SELECT cart_id, product_id, SUM(quantity) AS total
+			FROM cart_items
+			GROUP BY cart_id, product_id
+			HAVING COUNT(*) > 1
+		) dups
+		WHERE ci.cart_id = dups.cart_id AND ci.product_id = dups.product_id
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM cart_items a
+		USING cart_items b
+		WHERE a.cart_id = b.cart_id
+			AND a.product_id = b.product_id
+			AND a.ctid > b.ctid
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
 // FindCartByID loads a cart from the database by ID, including all its items
 func FindCartByID(ctx context.Context, cartID string) (*Cart, error) {
 	if cartID == "" {
@@ -375,6 +703,7 @@ func FindCartByID(ctx context.Context, cartID string) (*Cart, error) {
 	cart.CustomerName = customerName.String
 	cart.CustomerEmail = customerEmail.String
 	cart.CustomerPhone = customerPhone.String
+	cart.persisted = cart.customerFields()
 
 	// Load cart items
 	err = cart.LoadItems(ctx)
@@ -385,6 +714,162 @@ func FindCartByID(ctx context.Context, cartID string) (*Cart, error) {
 	return cart, nil
 }
 
+// MaxCustomerCarts caps the carts returned by FindCartsByCustomer
+const MaxCustomerCarts = 50
+
+// FindCartsByCustomer returns the active (not submitted) carts whose customer
+// phone or email match the given ones, newest first and with their items
+// loaded. Emails are compared case insensitively and phones by their last 10
+// digits, so formatting and the country code don't matter
+func FindCartsByCustomer(ctx context.Context, phone, email string) ([]*Cart, error) {
+	phone = strings.TrimSpace(phone)
+	email = strings.TrimSpace(email)
+	if phone == "" && email == "" {
+		return nil, ErrCartContactMissing
+	}
+
+	if phone != "" {
+		formatted, err := utils.FormatPhone(phone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: phone %q", ErrCartContactInvalid, phone)
+		}
+		phone = formatted[len(formatted)-10:]
+	}
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT id, customer_name, customer_email, customer_phone, created_at, is_submitted
+		FROM carts
+		WHERE NOT is_submitted AND (
+			(@phone != '' AND RIGHT(regexp_replace(customer_phone, '[^0-9]', '', 'g'), 10) = @phone)
+			OR (@email != '' AND LOWER(TRIM(customer_email)) = LOWER(@email))
+		)
+		ORDER BY created_at DESC
+		LIMIT @limit`,
+		pgx.NamedArgs{
+			"phone": phone,
+			"email": email,
+			"limit": MaxCustomerCarts,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	carts := []*Cart{}
+	for rows.Next() {
+		cart := &Cart{
+			updatedFields: make(map[string]bool),
+			removedItems:  make([]string, 0),
+		}
+		customerName := sql.NullString{}
+		customerEmail := sql.NullString{}
+		customerPhone := sql.NullString{}
+
+		err = rows.Scan(&cart.ID, &customerName, &customerEmail, &customerPhone, &cart.CreatedAt, &cart.IsSubmitted)
+		if err != nil {
+			return nil, err
+		}
+		cart.CustomerName = customerName.String
+		cart.CustomerEmail = customerEmail.String
+		cart.CustomerPhone = customerPhone.String
+		cart.persisted = cart.customerFields()
+		carts = append(carts, cart)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	conn.Release()
+
+	for _, cart := range carts {
+		if err := cart.LoadItems(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return carts, nil
+}
+
+// SharedCart is the read only snapshot of a cart shown through a share link.
+// It leaves out the cart id, which grants write access to the cart, and the
+// customer's contact details
+type SharedCart struct {
+	Items []*CartItem `json:"items"`
+	Total float64     `json:"total"`
+}
+
+// GetCartShareID returns the opaque id used to share the cart, generating it
+// the first time the cart is shared
+func GetCartShareID(ctx context.Context, cartID string) (string, error) {
+	if _, err := uuid.Parse(cartID); err != nil {
+		return "", ErrCartIDInvalidMissing
+	}
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+
+	var shareID string
+	err = conn.QueryRow(
+		ctx,
+		`UPDATE carts SET share_id = COALESCE(share_id, $2)
+		WHERE id = $1
+		RETURNING share_id::text`,
+		cartID,
+		uuid.Must(uuid.NewRandom()).String(),
+	).Scan(&shareID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrCartNotFound
+		}
+		return "", err
+	}
+
+	return shareID, nil
+}
+
+// FindSharedCart returns the snapshot of the cart with the given share id
+func FindSharedCart(ctx context.Context, shareID string) (*SharedCart, error) {
+	if _, err := uuid.Parse(shareID); err != nil {
+		return nil, ErrCartNotFound
+	}
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var cartID string
+	err = conn.QueryRow(ctx, `SELECT id FROM carts WHERE share_id = $1`, shareID).Scan(&cartID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCartNotFound
+		}
+		return nil, err
+	}
+	conn.Release()
+
+	cart := &Cart{ID: cartID}
+	if err := cart.LoadItems(ctx); err != nil {
+		return nil, err
+	}
+
+	return &SharedCart{
+		Items: cart.Items,
+		Total: cart.Total(),
+	}, nil
+}
+
 // GetOrCreateCart gets an existing cart or creates a new one if it doesn't exist
 func GetOrCreateCart(ctx context.Context, cartID string) (*Cart, error) {
 	cart, err := FindCartByID(ctx, cartID)
@@ -417,6 +902,252 @@ func DeleteCart(ctx context.Context, cartID string) error {
 	return err
 }
 
+type CartItemIssue string
+
+const (
+	CartItemIssueProductDeleted  CartItemIssue = "product_deleted"
+	CartItemIssueUnavailable     CartItemIssue = "unavailable"
+	CartItemIssueOutOfStock      CartItemIssue = "out_of_stock"
+	CartItemIssueQuantityReduced CartItemIssue = "quantity_reduced"
+)
+
+// CartItemValidation describes a problem found with a cart item
+type CartItemValidation struct {
+	ProductID    string        `json:"product_id"`
+	Name         string        `json:"name"`
+	Issue        CartItemIssue `json:"issue"`
+	RequestedQty int           `json:"requested_quantity"`
+	AvailableQty int           `json:"available_quantity"`
+}
+
+// CartValidation is the result of validating a cart before checkout
+type CartValidation struct {
+	CartID string                `json:"cart_id"`
+	Valid  bool                  `json:"valid"`
+	Issues []*CartItemValidation `json:"issues"`
+}
+
+// ValidateCart checks that every item of the cart is still available at its
+// requested quantity, returning the issues found per item
+func ValidateCart(ctx context.Context, cartID string) (*CartValidation, error) {
+	if cartID == "" {
+		return nil, ErrCartIDInvalidMissing
+	}
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var exists bool
+	err = conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM carts WHERE id = $1)`, cartID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrCartNotFound
+	}
+
+	rows, err := conn.Query(ctx, `
+		SELECT ci.product_id, ci.quantity,
+		       p.id IS NOT NULL as product_exists,
+		       COALESCE(p.name, ''), COALESCE(p.available AND product_in_window(p.available_from, p.available_until), false), COALESCE(p.quantity, 0)
+		FROM cart_items ci
+		LEFT JOIN products p ON ci.product_id = p.id AND p.deleted_at IS NULL
+		WHERE ci.cart_id = $1
+		ORDER BY ci.created_at
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	validation := &CartValidation{
+		CartID: cartID,
+		Issues: make([]*CartItemValidation, 0),
+	}
+	for rows.Next() {
+		var (
+			item          CartItemValidation
+			productExists bool
+			available     bool
+		)
+		err = rows.Scan(
+			&item.ProductID, &item.RequestedQty,
+			&productExists, &item.Name, &available, &item.AvailableQty,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !productExists:
+			item.Issue = CartItemIssueProductDeleted
+		case !available:
+			item.Issue = CartItemIssueUnavailable
+		case item.AvailableQty <= 0:
+			item.Issue = CartItemIssueOutOfStock
+		case item.RequestedQty > item.AvailableQty:
+			item.Issue = CartItemIssueQuantityReduced
+		default:
+			continue
+		}
+		validation.Issues = append(validation.Issues, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	validation.Valid = len(validation.Issues) == 0
+	return validation, nil
+}
+
+// DecrementStockForCart subtracts the quantity of every item of the cart from
+// its product's stock. If any product doesn't have enough stock nothing is
+// changed and an ErrCartInsufficientStock naming the product is returned. A
+// product deleted since it was added to the cart gives an
+// ErrCartProductUnavailable instead
+func DecrementStockForCart(ctx context.Context, cartID string) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	changes, err := decrementStockForCartTx(ctx, tx, cartID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	changes.emitSoldOut()
+	return nil
+}
+
+// stockChange holds the quantity a product had before and after a stock
+// decrement, so sold out events can be emitted once the transaction commits
+type stockChange struct {
+	productID       string
+	prevQty, newQty int
+}
+
+type stockChanges []stockChange
+
+func (changes stockChanges) emitSoldOut() {
+	for _, change := range changes {
+		emitSoldOut(change.productID, change.prevQty, change.newQty)
+	}
+}
+
+// decrementStockForCartTx does the work of DecrementStockForCart within tx.
+// The products are locked in id order so concurrent checkouts can't oversell
+// them or deadlock each other
+func decrementStockForCartTx(ctx context.Context, tx pgx.Tx, cartID string) (stockChanges, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT p.id::text, p.name, p.quantity
+		FROM products p
+		WHERE p.id IN (SELECT product_id FROM cart_items WHERE cart_id = $1)
+			AND p.deleted_at IS NULL
+		ORDER BY p.id
+		FOR UPDATE
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	type stock struct {
+		name     string
+		quantity int
+	}
+	var (
+		ids    []string
+		stocks = map[string]stock{}
+	)
+	for rows.Next() {
+		var (
+			id string
+			st stock
+		)
+		if err := rows.Scan(&id, &st.name, &st.quantity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		stocks[id] = st
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	requested := map[string]int{}
+	rows, err = tx.Query(ctx, `
+		SELECT ci.product_id::text, COALESCE(p.name, ''), SUM(ci.quantity)::int
+		FROM cart_items ci
+		LEFT JOIN products p ON p.id = ci.product_id
+		WHERE ci.cart_id = $1
+		GROUP BY ci.product_id, p.name
+		ORDER BY ci.product_id
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			id, name string
+			qty      int
+		)
+		if err := rows.Scan(&id, &name, &qty); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// Deleted products aren't locked above, so they'd be silently left
+		// out of the decrement
+		if _, ok := stocks[id]; !ok {
+			rows.Close()
+			if name == "" {
+				name = id
+			}
+			return nil, fmt.Errorf("%w: %q", ErrCartProductUnavailable, name)
+		}
+		requested[id] = qty
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	changes := stockChanges{}
+	for _, id := range ids {
+		st, qty := stocks[id], requested[id]
+		if qty > st.quantity {
+			return nil, fmt.Errorf(
+				"%w: %q has %d left, %d requested",
+				ErrCartInsufficientStock, st.name, st.quantity, qty,
+			)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE products SET quantity = quantity - $2 WHERE id = $1`, id, qty)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, stockChange{id, st.quantity, st.quantity - qty})
+	}
+
+	return changes, nil
+}
+
 // GetCartIDFromRequest extracts the cart ID from the request cookie
 func GetCartIDFromRequest(r *http.Request) (string, error) {
 	cookie, err := r.Cookie("cart_id")
@@ -0,0 +1,455 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestClampItemQty(t *testing.T) {
+	tests := []struct {
+		name                string
+		qty, minQty, maxQty int
+		want                int
+	}{
+		{"no limits", 3, 0, 0, 3},
+		{"rounds up to the min lot", 3, 5, 0, 5},
+		{"under the max", 10, 5, 12, 10},
+		{"lowered to a multiple under the max", 15, 5, 12, 10},
+		{"max can't cover a lot", 5, 5, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clampItemQty(tt.qty, tt.minQty, tt.maxQty); got != tt.want {
+				t.Errorf("clampItemQty(%d, %d, %d) = %d, want %d", tt.qty, tt.minQty, tt.maxQty, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateItemQtyRemovesItemWhenStockCantCoverALot(t *testing.T) {
+	cart := NewCart()
+	cart.Items = []*CartItem{{ProductID: "p1", Quantity: 5, MinQty: 5, MaxQty: 3}}
+
+	cart.UpdateItemQty("p1", 5)
+
+	if len(cart.Items) != 0 {
+		t.Fatalf("cart has %d items, want the item removed", len(cart.Items))
+	}
+	if len(cart.removedItems) != 1 || cart.removedItems[0] != "p1" {
+		t.Errorf("removedItems = %v, want [p1]", cart.removedItems)
+	}
+}
+
+func TestAddItemClampsNewItemsToTheMax(t *testing.T) {
+	cart := NewCart()
+
+	cart.AddItem(&CartItem{ProductID: "p1", Quantity: 7, MinQty: 5, MaxQty: 12})
+
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 10 {
+		t.Fatalf("items = %+v, want p1 with quantity 10", cart.Items)
+	}
+}
+
+func TestAddItemSkipsItemsWhoseStockCantCoverALot(t *testing.T) {
+	cart := NewCart()
+
+	cart.AddItem(&CartItem{ProductID: "p1", Quantity: 1, MinQty: 5, MaxQty: 3})
+
+	if len(cart.Items) != 0 {
+		t.Fatalf("cart has %d items, want none", len(cart.Items))
+	}
+}
+
+func TestAddItemMergesIntoExistingItem(t *testing.T) {
+	cart := NewCart()
+	cart.AddItem(&CartItem{ProductID: "p1", Quantity: 5, MinQty: 5, MaxQty: 12})
+
+	cart.AddItem(&CartItem{ProductID: "p1", Quantity: 5, MinQty: 5, MaxQty: 12})
+	cart.AddItem(&CartItem{ProductID: "p1", Quantity: 5, MinQty: 5, MaxQty: 12})
+
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 10 {
+		t.Fatalf("items = %+v, want p1 with quantity 10", cart.Items)
+	}
+}
+
+func TestSaveRejectsCartSubmittedElsewhere(t *testing.T) {
+	connectTestDB(t)
+
+	productID := createTestProduct(t, 10)
+	cart := createTestCart(t, 1, productID)
+	if err := CreateQuote(cartQuote(cart)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The in-memory cart doesn't know it was submitted
+	cart.CustomerName = "Otro nombre"
+	cart.UpdateItemQty(productID, 4)
+	err := cart.Save(context.Background())
+	if !errors.Is(err, ErrCartSubmitted) {
+		t.Fatalf("expected ErrCartSubmitted, got %v", err)
+	}
+
+	stored, err := FindCartByID(context.Background(), cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CustomerName == "Otro nombre" {
+		t.Error("expected the submitted cart's customer to be unchanged")
+	}
+	if len(stored.Items) != 1 || stored.Items[0].Quantity != 1 {
+		t.Errorf("expected the submitted cart's items to be unchanged, got %+v", stored.Items)
+	}
+}
+
+func TestDedupCartItemsKeepsUniqueItems(t *testing.T) {
+	connectTestDB(t)
+
+	first := createTestProduct(t, 10)
+	second := createTestProduct(t, 10)
+	cart := createTestCart(t, 2, first, second)
+
+	// cart_items_pkey keeps duplicates out, so there's nothing to merge
+	if _, err := DedupCartItems(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := FindCartByID(context.Background(), cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Items) != 2 {
+		t.Fatalf("got %d items, want 2", len(stored.Items))
+	}
+	for _, item := range stored.Items {
+		if item.Quantity != 2 {
+			t.Errorf("got quantity %d for %s, want 2", item.Quantity, item.ProductID)
+		}
+	}
+}
+
+func TestNewCart(t *testing.T) {
+	tests := []struct {
+		name   string
+		cart   func() *Cart
+		wantID string
+	}{
+		{"no id", func() *Cart { return NewCart() }, ""},
+		{"empty id", func() *Cart { return NewCart("") }, ""},
+		{"given id", func() *Cart { return NewCart("some-id") }, "some-id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart := tt.cart()
+			if tt.wantID != "" {
+				if cart.ID != tt.wantID {
+					t.Errorf("got id %q, want %q", cart.ID, tt.wantID)
+				}
+			} else if _, err := uuid.Parse(cart.ID); err != nil {
+				t.Errorf("expected a fresh uuid, got %q: %v", cart.ID, err)
+			}
+			if !cart.isNew || cart.updatedFields == nil || cart.Items == nil {
+				t.Error("expected an initialized new cart")
+			}
+		})
+	}
+
+	if NewCart().ID == NewCart().ID {
+		t.Error("expected every cart to get a different id")
+	}
+}
+
+func TestCanSubmit(t *testing.T) {
+	tests := []struct {
+		name         string
+		email, phone string
+		submitted    bool
+		want         error
+	}{
+		{"no contact", "", "", false, ErrCartContactMissing},
+		{"blank contact", "  ", " ", false, ErrCartContactMissing},
+		{"malformed email", "cliente@", "", false, ErrCartContactInvalid},
+		{"malformed phone", "", "12345", false, ErrCartContactInvalid},
+		{"valid email, malformed phone", "cliente@example.com", "abc", false, ErrCartContactInvalid},
+		{"valid email", "cliente@example.com", "", false, nil},
+		{"valid phone", "", "618 123 4567", false, nil},
+		{"valid phone with country code", "", "+526181234567", false, nil},
+		{"already submitted", "cliente@example.com", "", true, ErrCartSubmitted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart := NewCart()
+			cart.CustomerEmail = tt.email
+			cart.CustomerPhone = tt.phone
+			cart.IsSubmitted = tt.submitted
+
+			err := cart.CanSubmit()
+			if tt.want == nil && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateCleanCart(t *testing.T) {
+	connectTestDB(t)
+
+	cart := createTestCart(t, 2, createTestProduct(t, 5))
+
+	validation, err := ValidateCart(context.Background(), cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !validation.Valid || len(validation.Issues) != 0 {
+		t.Errorf("expected a valid cart, got issues %+v", validation.Issues)
+	}
+}
+
+func TestValidateCartReportsItemIssues(t *testing.T) {
+	connectTestDB(t)
+
+	deleted := createTestProduct(t, 5)
+	reduced := createTestProduct(t, 5)
+	cart := createTestCart(t, 3, deleted, reduced)
+	execTestSQL(t, `UPDATE products SET deleted_at = NOW() WHERE id = $1`, deleted)
+	setProductQuantity(t, reduced, 1)
+
+	validation, err := ValidateCart(context.Background(), cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validation.Valid {
+		t.Error("expected an invalid cart")
+	}
+
+	issues := map[string]*CartItemValidation{}
+	for _, issue := range validation.Issues {
+		issues[issue.ProductID] = issue
+	}
+	if got := issues[deleted]; got == nil || got.Issue != CartItemIssueProductDeleted {
+		t.Errorf("got %+v for the deleted product, want %s", got, CartItemIssueProductDeleted)
+	}
+	got := issues[reduced]
+	if got == nil || got.Issue != CartItemIssueQuantityReduced {
+		t.Fatalf("got %+v for the reduced product, want %s", got, CartItemIssueQuantityReduced)
+	}
+	if got.RequestedQty != 3 || got.AvailableQty != 1 {
+		t.Errorf("got requested %d and available %d, want 3 and 1", got.RequestedQty, got.AvailableQty)
+	}
+}
+
+func TestValidateMissingCart(t *testing.T) {
+	connectTestDB(t)
+
+	_, err := ValidateCart(context.Background(), uuid.Must(uuid.NewV7()).String())
+	if !errors.Is(err, ErrCartNotFound) {
+		t.Errorf("expected ErrCartNotFound, got %v", err)
+	}
+}
+
+func TestAddItemKeepsTheNoteOfExistingItems(t *testing.T) {
+	cart := NewCart()
+	cart.AddItem(&CartItem{ProductID: "p1", Quantity: 1, Note: "Manteles azules"})
+	cart.AddItem(&CartItem{ProductID: "p1", Quantity: 1})
+
+	if got := cart.Items[0].Note; got != "Manteles azules" {
+		t.Errorf("got note %q, want it kept", got)
+	}
+
+	cart.SetItemNote("p1", "Manteles rojos", map[string]string{"color": "rojo"})
+	if got := cart.Items[0].Note; got != "Manteles rojos" {
+		t.Errorf("got note %q after SetItemNote", got)
+	}
+}
+
+func TestCartItemNoteRoundTrip(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	productID := createTestProductIn(t, createTestCategory(t), 5)
+	customizations := map[string]string{"color": "azul", "tamaño": "grande"}
+
+	cart := NewCart()
+	cart.CustomerEmail = "cliente@example.com"
+	cart.AddItem(&CartItem{
+		ProductID:      productID,
+		Quantity:       2,
+		Source:         string(CartItemSourceCatalog),
+		Note:           "Manteles azules",
+		Customizations: customizations,
+	})
+	if err := cart.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := FindCartByID(ctx, cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(stored.Items))
+	}
+	item := stored.Items[0]
+	if item.Note != "Manteles azules" || !maps.Equal(item.Customizations, customizations) {
+		t.Errorf("got note %q and customizations %v after loading", item.Note, item.Customizations)
+	}
+
+	quote := cartQuote(cart)
+	if err := CreateQuote(quote); err != nil {
+		t.Fatal(err)
+	}
+	storedQuote, err := FindQuoteByID(quote.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storedQuote.Cart == nil || len(storedQuote.Cart.Items) != 1 {
+		t.Fatal("expected the quote to carry the cart snapshot")
+	}
+	if got := storedQuote.Cart.Items[0]; got.Note != "Manteles azules" || !maps.Equal(got.Customizations, customizations) {
+		t.Errorf("got note %q and customizations %v in the quote", got.Note, got.Customizations)
+	}
+}
+
+func TestCartMarkDirtyRejectsUnknownFields(t *testing.T) {
+	cart := NewCart()
+	if err := cart.MarkDirty("unknown"); !errors.Is(err, ErrCartSetFieldInvalid) {
+		t.Errorf("got error %v, want %v", err, ErrCartSetFieldInvalid)
+	}
+	if err := cart.MarkDirty("CustomerName"); err != nil {
+		t.Fatal(err)
+	}
+	if !cart.updatedFields["customer_name"] {
+		t.Error("expected the customer_name column to be marked")
+	}
+}
+
+func TestCartPersistsDirectlyAssignedCustomerFields(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	productID := createTestProductIn(t, createTestCategory(t), 5)
+	cart, err := GetOrCreateCart(ctx, uuid.Must(uuid.NewV7()).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		DeleteCart(context.Background(), cart.ID)
+	})
+
+	cart.CustomerName = "Ana"
+	cart.AddItem(&CartItem{ProductID: productID, Quantity: 1, Source: string(CartItemSourceCatalog)})
+	if err := cart.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cart.CustomerPhone = "6181234567"
+	if err := cart.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := FindCartByID(ctx, cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CustomerName != "Ana" || stored.CustomerPhone != "6181234567" {
+		t.Errorf("got name %q and phone %q, want the assigned ones", stored.CustomerName, stored.CustomerPhone)
+	}
+}
+
+func TestNewCartWithOnlyItemsPersists(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	productID := createTestProductIn(t, createTestCategory(t), 5)
+	cart := NewCart()
+	t.Cleanup(func() {
+		DeleteCart(context.Background(), cart.ID)
+	})
+	cart.AddItem(&CartItem{ProductID: productID, Quantity: 2, Source: string(CartItemSourceCatalog)})
+	if err := cart.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := countTestRows(t, `SELECT COUNT(*) FROM carts WHERE id = $1`, cart.ID); got != 1 {
+		t.Errorf("got %d cart rows, want 1", got)
+	}
+	if got := countTestRows(t, `SELECT COUNT(*) FROM cart_items WHERE cart_id = $1`, cart.ID); got != 1 {
+		t.Errorf("got %d cart items, want 1", got)
+	}
+
+	// A new cart built for an id that already has a row saves too
+	again := NewCart(cart.ID)
+	again.AddItem(&CartItem{ProductID: productID, Quantity: 3, Source: string(CartItemSourceCatalog)})
+	if err := again.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindCartsByCustomerRequiresValidContact(t *testing.T) {
+	if _, err := FindCartsByCustomer(context.Background(), " ", ""); !errors.Is(err, ErrCartContactMissing) {
+		t.Errorf("got error %v, want %v", err, ErrCartContactMissing)
+	}
+	if _, err := FindCartsByCustomer(context.Background(), "123", ""); !errors.Is(err, ErrCartContactInvalid) {
+		t.Errorf("got error %v, want %v", err, ErrCartContactInvalid)
+	}
+}
+
+func TestFindCartsByCustomer(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	productID := createTestProductIn(t, createTestCategory(t), 5)
+	// Unique contact info so other carts in the db don't match
+	phone := fmt.Sprintf("618%07d", time.Now().UnixNano()%10_000_000)
+	email := "test-" + uuid.Must(uuid.NewV7()).String() + "@example.com"
+
+	saveCart := func(phone, email string) *Cart {
+		cart := NewCart()
+		t.Cleanup(func() {
+			DeleteCart(context.Background(), cart.ID)
+		})
+		cart.CustomerPhone = phone
+		cart.CustomerEmail = email
+		cart.AddItem(&CartItem{ProductID: productID, Quantity: 1, Source: string(CartItemSourceCatalog)})
+		if err := cart.Save(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return cart
+	}
+	byPhone := saveCart(phone, "")
+	byEmail := saveCart("", email)
+
+	tests := []struct {
+		name         string
+		phone, email string
+		want         string
+	}{
+		{"by phone", "+52 " + phone[:3] + "-" + phone[3:], "", byPhone.ID},
+		{"by email", "", "  " + strings.ToUpper(email), byEmail.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carts, err := FindCartsByCustomer(ctx, tt.phone, tt.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(carts) != 1 || carts[0].ID != tt.want {
+				t.Fatalf("got %d carts, want only %s", len(carts), tt.want)
+			}
+			if len(carts[0].Items) != 1 {
+				t.Errorf("got %d items, want the cart's items loaded", len(carts[0].Items))
+			}
+		})
+	}
+}
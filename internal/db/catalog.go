@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +23,12 @@ const (
 	DefaultCatalogPageSize = 16
 )
 
+// DefaultCatalogSort is the sort used by the public catalog when none is
+// requested and SettingCatalogDefaultSort isn't set. It keeps products in
+// stock ahead of unavailable ones; the admin product listing keeps sorting by
+// name
+var DefaultCatalogSort = "available_first"
+
 type CatalogCtg struct {
 	ID           string `json:"id"`
 	Name         string `json:"name"`
@@ -44,6 +54,7 @@ type CatalogProductFilterParams struct {
 	Search      string     `json:"search"`       // Search term for name/description
 	SearchMode  SearchMode `json:"search_mode"`  // fulltext, exact, fuzzy
 	Categories  []string   `json:"categories"`   // Category IDs to filter by
+	Subcategory string     `json:"subcategory"`  // Subcategory ID to filter by
 	Available   int        `json:"available"`    // -1=unavailable, 0=all, 1=available
 	MinQuantity int        `json:"min_quantity"` // Minimum quantity filter
 	MaxQuantity int        `json:"max_quantity"` // Maximum quantity filter
@@ -52,6 +63,120 @@ type CatalogProductFilterParams struct {
 	Limit       int        `json:"limit"`        // Items per page
 	ExcludeIDs  []string   `json:"exclude_ids"`  // Product IDs to exclude
 	OnlyIDs     []string   `json:"only_ids"`     // Only include these IDs
+	OnlySlugs   []string   `json:"only_slugs"`   // Only include these slugs, in the given order
+	Fields      []string   `json:"fields"`       // Only serialize these product fields, all if empty
+}
+
+// NewCatalogProductFilterParamsFromRequest builds the filter params from the
+// request's query. Categories, exclude_ids and only_ids may be repeated and
+// fields is a comma separated list
+func NewCatalogProductFilterParamsFromRequest(r *http.Request) CatalogProductFilterParams {
+	query := r.URL.Query()
+	params := CatalogProductFilterParams{}
+
+	if query.Get("search") != "" {
+		params.Search = query.Get("search")
+		params.SearchMode = SearchModeFullText
+	}
+	if query.Get("search_mode") != "" {
+		params.SearchMode = SearchMode(query.Get("search_mode"))
+	}
+
+	params.Categories = nonEmptyValues(query["categories"])
+	if query.Get("subcategory") != "" {
+		params.Subcategory = query.Get("subcategory")
+	}
+
+	if query.Get("available") != "" {
+		params.Available, _ = strconv.Atoi(query.Get("available"))
+	}
+	if query.Get("min_quantity") != "" {
+		params.MinQuantity, _ = strconv.Atoi(query.Get("min_quantity"))
+	}
+	if query.Get("max_quantity") != "" {
+		params.MaxQuantity, _ = strconv.Atoi(query.Get("max_quantity"))
+	}
+
+	if query.Get("sort") != "" {
+		params.Sort = query.Get("sort")
+	}
+	if query.Get("page") != "" {
+		params.Page, _ = strconv.Atoi(query.Get("page"))
+	}
+	if query.Get("limit") != "" {
+		params.Limit, _ = strconv.Atoi(query.Get("limit"))
+	}
+
+	params.ExcludeIDs = nonEmptyValues(query["exclude_ids"])
+	params.OnlyIDs = nonEmptyValues(query["only_ids"])
+	if query.Get("fields") != "" {
+		params.Fields = nonEmptyValues(strings.Split(query.Get("fields"), ","))
+	}
+
+	return params
+}
+
+// nonEmptyValues returns the trimmed values, skipping the empty ones
+func nonEmptyValues(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+var ErrCatalogFieldInvalid = errors.New("invalid catalog product field")
+
+// CatalogProdFields lists the product fields that can be requested through
+// CatalogProductFilterParams.Fields
+var CatalogProdFields = []string{
+	"id", "name", "slug", "description", "long_description", "category",
+	"category_id", "image_url", "images", "available", "quantity",
+}
+
+// ValidateCatalogFields checks every field is in CatalogProdFields
+func ValidateCatalogFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(CatalogProdFields, field) {
+			return fmt.Errorf("%w: %s", ErrCatalogFieldInvalid, field)
+		}
+	}
+	return nil
+}
+
+// Project returns a map with only the given fields of the product, keyed by
+// their json name. Unknown fields are ignored
+func (p *CatalogProd) Project(fields []string) map[string]any {
+	projected := make(map[string]any, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "id":
+			projected[field] = p.ID
+		case "name":
+			projected[field] = p.Name
+		case "slug":
+			projected[field] = p.Slug
+		case "description":
+			projected[field] = p.Description
+		case "long_description":
+			projected[field] = p.LongDescription
+		case "category":
+			projected[field] = p.CategoryName
+		case "category_id":
+			projected[field] = p.CategoryID
+		case "image_url":
+			projected[field] = p.ImageURL
+		case "images":
+			projected[field] = p.Images
+		case "available":
+			projected[field] = p.Available
+		case "quantity":
+			projected[field] = p.Quantity
+		}
+	}
+	return projected
 }
 
 func FindCatalogCategories(search string) ([]*CatalogCtg, error) {
@@ -159,6 +284,9 @@ func FindCatalogProductDetail(id string) (*CatalogProd, error) {
 		&product.Quantity,
 	)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
 		return nil, err
 	}
 
@@ -169,6 +297,67 @@ func FindCatalogProductDetail(id string) (*CatalogProd, error) {
 	return &product, nil
 }
 
+// FindAdjacentProducts returns the products right before and after productID
+// when listing the catalog with the given sort, optionally limited to a
+// category. prev or next are nil when productID is the first or last product
+func FindAdjacentProducts(ctx context.Context, productID string, categoryID string, sort string) (prev, next *CatalogProd, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Release()
+
+	args := pgx.NamedArgs{"id": productID}
+	where := ""
+	if categoryID != "" {
+		where = "WHERE category_id = @category_id"
+		args["category_id"] = categoryID
+	}
+	if sort == "" {
+		sort = settingOrDefault(ctx, conn, SettingCatalogDefaultSort, DefaultCatalogSort)
+	}
+	// Ties are broken by id so neighbors are stable between requests
+	orderBy := buildCatalogProductOrderByClause(CatalogProductFilterParams{Sort: sort})
+
+	var prevID, nextID *string
+	err = conn.QueryRow(
+		ctx,
+		fmt.Sprintf(`WITH ordered AS (
+			SELECT id,
+				LAG(id) OVER w AS prev_id,
+				LEAD(id) OVER w AS next_id
+			FROM catalog_products %s
+			WINDOW w AS (%s, id ASC)
+		)
+		SELECT prev_id, next_id FROM ordered WHERE id = @id`, where, orderBy),
+		args,
+	).Scan(&prevID, &nextID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrProductNotFound
+		}
+		return nil, nil, err
+	}
+	conn.Release()
+
+	if prevID != nil {
+		prev, err = FindCatalogProductDetail(*prevID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if nextID != nil {
+		next, err = FindCatalogProductDetail(*nextID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return prev, next, nil
+}
+
 type CatalogProductFilterResult struct {
 	Products    []*CatalogProd `json:"products"`
 	Total       int            `json:"total"`
@@ -179,6 +368,33 @@ type CatalogProductFilterResult struct {
 	HasPrevious bool           `json:"has_previous"`
 	HasError    bool           `json:"has_error"`
 	Error       string         `json:"error"`
+	// Facets is only set by FilterCatalogProductsWithFacets
+	Facets *CatalogFacets `json:"facets,omitempty"`
+
+	// fields projects the serialized products when set
+	fields []string
+}
+
+// MarshalJSON serializes the result, projecting each product to the
+// requested fields if any were given
+func (r CatalogProductFilterResult) MarshalJSON() ([]byte, error) {
+	type plainResult CatalogProductFilterResult
+	if len(r.fields) == 0 {
+		return json.Marshal(plainResult(r))
+	}
+
+	projected := make([]map[string]any, len(r.Products))
+	for i, p := range r.Products {
+		projected[i] = p.Project(r.fields)
+	}
+
+	return json.Marshal(struct {
+		plainResult
+		Products []map[string]any `json:"products"`
+	}{
+		plainResult: plainResult(r),
+		Products:    projected,
+	})
 }
 
 // FindCatalogProducts is a backward-compatible wrapper around FilterCatalogProducts
@@ -239,6 +455,14 @@ func FilterCatalogProducts(filters CatalogProductFilterParams) (*CatalogProductF
 	if filters.SearchMode == "" {
 		filters.SearchMode = SearchModeFullText
 	}
+	// Full-text searches without a sort are ranked by relevance instead
+	if filters.Sort == "" && (filters.Search == "" || filters.SearchMode != SearchModeFullText) {
+		filters.Sort = settingOrDefault(ctx, conn, SettingCatalogDefaultSort, DefaultCatalogSort)
+	}
+	err = ValidateCatalogFields(filters.Fields)
+	if err != nil {
+		return nil, err
+	}
 
 	// Build query conditions and named arguments
 	conditions, namedArgs := buildCatalogProductQueryConditions(filters)
@@ -298,12 +522,187 @@ func FilterCatalogProducts(filters CatalogProductFilterParams) (*CatalogProductF
 		TotalPages:  totalPages,
 		HasNext:     filters.Page < totalPages,
 		HasPrevious: filters.Page > 1,
+		fields:      filters.Fields,
+	}
+
+	return result, nil
+}
+
+// CatalogPriceBucketBounds are the lower bounds of the price facet buckets.
+// Each bucket goes up to the next bound, the last one is open ended
+var CatalogPriceBucketBounds = []float64{0, 100, 500, 1000, 5000}
+
+// CatalogFacets holds the match counts of the products filtered by a
+// CatalogProductFilterParams, grouped in several ways
+type CatalogFacets struct {
+	Categories   []*CatalogCategoryFacet `json:"categories"`
+	Available    int                     `json:"available"`
+	Unavailable  int                     `json:"unavailable"`
+	PriceBuckets []*CatalogPriceBucket   `json:"price_buckets"`
+}
+
+type CatalogCategoryFacet struct {
+	CategoryID   string `json:"category_id"`
+	CategoryName string `json:"category"`
+	Count        int    `json:"count"`
+}
+
+// CatalogPriceBucket counts the products priced from Min up to, but not
+// including, Max. Max is 0 for the last bucket
+type CatalogPriceBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// FilterCatalogProductsWithFacets works as FilterCatalogProducts, also
+// counting every match (not only the current page) by category,
+// availability and price bucket
+func FilterCatalogProductsWithFacets(filters CatalogProductFilterParams) (*CatalogProductFilterResult, error) {
+	result, err := FilterCatalogProducts(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if filters.SearchMode == "" {
+		filters.SearchMode = SearchModeFullText
+	}
+	conditions, namedArgs := buildCatalogProductQueryConditions(filters)
+	baseQuery := `FROM catalog_products`
+	if len(conditions) > 0 {
+		baseQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	facets := &CatalogFacets{
+		Categories:   []*CatalogCategoryFacet{},
+		PriceBuckets: make([]*CatalogPriceBucket, len(CatalogPriceBucketBounds)),
+	}
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT COALESCE(category_id::text, ''), COALESCE(category_name, ''), COUNT(*) `+baseQuery+`
+		GROUP BY category_id, category_name
+		ORDER BY COUNT(*) DESC, category_name ASC`,
+		namedArgs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count category facets: %w", err)
+	}
+	for rows.Next() {
+		facet := &CatalogCategoryFacet{}
+		if err := rows.Scan(&facet.CategoryID, &facet.CategoryName, &facet.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		facets.Categories = append(facets.Categories, facet)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = conn.QueryRow(
+		ctx,
+		`SELECT COUNT(*) FILTER (WHERE available), COUNT(*) FILTER (WHERE NOT available) `+baseQuery,
+		namedArgs,
+	).Scan(&facets.Available, &facets.Unavailable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count availability facets: %w", err)
+	}
+
+	for i, bound := range CatalogPriceBucketBounds {
+		facets.PriceBuckets[i] = &CatalogPriceBucket{Min: bound}
+		if i+1 < len(CatalogPriceBucketBounds) {
+			facets.PriceBuckets[i].Max = CatalogPriceBucketBounds[i+1]
+		}
+	}
+	// width_bucket returns the 1-based index of the bucket, 0 if below the
+	// first bound
+	namedArgs["price_bounds"] = CatalogPriceBucketBounds
+	rows, err = conn.Query(
+		ctx,
+		`SELECT width_bucket(COALESCE(price, 0)::float8, @price_bounds::float8[]) AS bucket, COUNT(*) `+baseQuery+`
+		GROUP BY bucket`,
+		namedArgs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count price facets: %w", err)
+	}
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if bucket > 0 && bucket <= len(facets.PriceBuckets) {
+			facets.PriceBuckets[bucket-1].Count += count
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
+	result.Facets = facets
 	return result, nil
 }
 
+type CatalogListingsOrder string
+
+const (
+	CatalogListingsOrderName         CatalogListingsOrder = "name"
+	CatalogListingsOrderDisplayOrder CatalogListingsOrder = "display_order"
+
+	DefaultCatalogListingsPerCategory = 4
+)
+
+// CatalogListingsOptions controls how the homepage listings are grouped and sorted
+type CatalogListingsOptions struct {
+	// CategoryOrder sorts the category groups, by name when empty
+	CategoryOrder CatalogListingsOrder `json:"category_order"`
+	// CategoryPriority lists category IDs that go first, in the given order
+	CategoryPriority []string `json:"category_priority"`
+	// FeaturedFirst puts featured products first within each group
+	FeaturedFirst bool `json:"featured_first"`
+	// PerCategory is the max number of products per group
+	PerCategory int `json:"per_category"`
+}
+
+// CatalogListing is a category group of the catalog listings
+type CatalogListing struct {
+	CategoryID   string         `json:"category_id"`
+	CategoryName string         `json:"category"`
+	Products     []*CatalogProd `json:"products"`
+}
+
+// FindCatalogListings returns the default listings keyed by category name
 func FindCatalogListings() (map[string][]*CatalogProd, error) {
+	groups, err := FindOrderedCatalogListings(CatalogListingsOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Different categories may share a name, their products are merged
+	listings := make(map[string][]*CatalogProd, len(groups))
+	for _, group := range groups {
+		listings[group.CategoryName] = append(listings[group.CategoryName], group.Products...)
+	}
+
+	return listings, nil
+}
+
+// FindOrderedCatalogListings returns a few products per category, grouped by
+// category in the order described by opts
+func FindOrderedCatalogListings(opts CatalogListingsOptions) ([]*CatalogListing, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -312,56 +711,92 @@ func FindCatalogListings() (map[string][]*CatalogProd, error) {
 	}
 	defer conn.Release()
 
+	if opts.PerCategory < 1 {
+		opts.PerCategory = DefaultCatalogListingsPerCategory
+	}
+	if opts.CategoryPriority == nil {
+		opts.CategoryPriority = []string{}
+	}
+
+	productOrder := "p.name"
+	if opts.FeaturedFirst {
+		productOrder = "p.featured DESC, p.name"
+	}
+
+	// Ties are broken by id so same-named categories aren't interleaved
+	categoryOrder := "ctg.name, ctg.id"
+	if opts.CategoryOrder == CatalogListingsOrderDisplayOrder {
+		categoryOrder = "ctg.display_order, ctg.name, ctg.id"
+	}
+
 	rows, err := conn.Query(
 		ctx,
-		`SELECT 
+		fmt.Sprintf(`SELECT 
 			prod.id, prod.name, prod.description, prod.slug,
-			ctg.name as category, pic.filename as main_img
+			ctg.id, ctg.name as category, pic.filename as main_img
 		FROM (
 			SELECT
-				ROW_NUMBER() OVER (PARTITION BY p.category_id) as row_num,
+				ROW_NUMBER() OVER (PARTITION BY p.category_id ORDER BY %s) as row_num,
 				p.id, p.name, p.description, p.slug, p.category_id,
 				p.main_img_id
 			FROM products p
-			ORDER BY p.category_id, p.name
+			WHERE p.deleted_at IS NULL AND product_in_window(p.available_from, p.available_until)
 		) as prod
 		LEFT JOIN categories ctg ON prod.category_id = ctg.id
 		LEFT JOIN images pic ON prod.main_img_id = pic.id
-		WHERE prod.row_num <= 4
-		ORDER BY category, prod.name
-		`,
+		WHERE prod.row_num <= @per_category
+		ORDER BY array_position(@priority::uuid[], ctg.id) NULLS LAST, %s, prod.row_num
+		`, productOrder, categoryOrder),
+		pgx.NamedArgs{
+			"per_category": opts.PerCategory,
+			"priority":     opts.CategoryPriority,
+		},
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	listings := make(map[string][]*CatalogProd)
+	listings := []*CatalogListing{}
+	groups := map[string]*CatalogListing{}
 	for rows.Next() {
 		var product CatalogProd
 		var imgUrl sql.NullString
+		var categoryID sql.NullString
+		var categoryName sql.NullString
 
 		err = rows.Scan(
 			&product.ID,
 			&product.Name,
 			&product.Description,
 			&product.Slug,
-			&product.CategoryName,
+			&categoryID,
+			&categoryName,
 			&imgUrl,
 		)
 		if err != nil {
 			return nil, err
 		}
 
-		if imgUrl.Valid {
-			product.ImageURL = imgUrl.String
+		product.ImageURL = imgUrl.String
+		if product.ImageURL == "" {
+			product.ImageURL = DefaultProductImage
 		}
-		if _, ok := listings[product.CategoryName]; !ok {
-			listings[product.CategoryName] = []*CatalogProd{}
-			listings[product.CategoryName] = append(listings[product.CategoryName], &product)
-		} else {
-			listings[product.CategoryName] = append(listings[product.CategoryName], &product)
+		product.CategoryID = categoryID.String
+		product.CategoryName = categoryName.String
+
+		// Products without a category are grouped under an empty id
+		group, ok := groups[product.CategoryID]
+		if !ok {
+			group = &CatalogListing{
+				CategoryID:   product.CategoryID,
+				CategoryName: product.CategoryName,
+				Products:     []*CatalogProd{},
+			}
+			groups[product.CategoryID] = group
+			listings = append(listings, group)
 		}
+		group.Products = append(group.Products, &product)
 	}
 
 	// Check for iteration errors
@@ -372,10 +807,108 @@ func FindCatalogListings() (map[string][]*CatalogProd, error) {
 	return listings, nil
 }
 
+const (
+	DefaultFeaturedProductsLimit = 8
+	MaxFeaturedProductsLimit     = 50
+)
+
+var ErrFeaturedProductsLimit = errors.New("featured products limit can't be negative")
+
+// FindFeaturedProducts returns up to limit catalog products, featured ones
+// first, then available ones, then by name. When there aren't enough
+// featured products the rest of the catalog fills the selection.
+// A limit of 0 uses DefaultFeaturedProductsLimit and limits over
+// MaxFeaturedProductsLimit are capped to it. Negative limits are rejected
+func FindFeaturedProducts(limit int) ([]*CatalogProd, error) {
+	if limit < 0 {
+		return nil, ErrFeaturedProductsLimit
+	}
+	if limit == 0 {
+		limit = DefaultFeaturedProductsLimit
+	}
+	limit = min(limit, MaxFeaturedProductsLimit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// catalog_products already excludes deleted and out of window products
+	rows, err := conn.Query(
+		ctx,
+		`SELECT
+			cp.id, cp.name, cp.description, cp.long_description, cp.category_id, cp.category_name,
+			cp.image_url, cp.available, cp.images, cp.slug, cp.quantity,
+			0::real as search_rank
+		FROM catalog_products cp
+			JOIN products p ON p.id = cp.id
+		ORDER BY p.featured DESC, (cp.available AND cp.quantity > 0) DESC, cp.name ASC, cp.id ASC
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find featured products: %w", err)
+	}
+	defer rows.Close()
+
+	return scanCatalogProducts(rows, false)
+}
+
+const (
+	DefaultRelatedProductsLimit = 8
+	MaxRelatedProductsLimit     = 20
+)
+
+var ErrRelatedProductsLimit = errors.New("related products limit can't be negative")
+
+type RelatedProductsSource string
+
+const (
+	// RelatedSourceSimilarity means every product came from the precomputed similarities
+	RelatedSourceSimilarity RelatedProductsSource = "similarity"
+	// RelatedSourceMixed means similarities were topped up with products of the same category
+	RelatedSourceMixed RelatedProductsSource = "mixed"
+	// RelatedSourceComputed means similarities were computed on the fly as the
+	// materialized view wasn't available
+	RelatedSourceComputed RelatedProductsSource = "computed"
+)
+
+type RelatedProductsResult struct {
+	Products        []*CatalogProd        `json:"products"`
+	Source          RelatedProductsSource `json:"source"`
+	SimilarityCount int                   `json:"similarity_count"`
+	FallbackCount   int                   `json:"fallback_count"`
+	// Partial is set when filling up with same category products failed,
+	// so there may be less products than available
+	Partial bool `json:"partial"`
+}
+
+// relatedProductsLimit resolves the limit given to FindRelatedProducts
+func relatedProductsLimit(limit int) (int, error) {
+	if limit < 0 {
+		return 0, ErrRelatedProductsLimit
+	}
+	if limit == 0 {
+		return DefaultRelatedProductsLimit, nil
+	}
+	return min(limit, MaxRelatedProductsLimit), nil
+}
+
 // FindRelatedProducts finds products related to a given product ID
 // It uses the pre-calculated similarity scores from the product_similarities materialized view
 // for optimal performance. Falls back to category-based recommendations if needed.
-func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
+//
+// A limit of 0 uses DefaultRelatedProductsLimit and limits over
+// MaxRelatedProductsLimit are capped to it. Negative limits are rejected
+func FindRelatedProducts(productID string, limit int) (*RelatedProductsResult, error) {
+	limit, err := relatedProductsLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -385,27 +918,25 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 	}
 	defer conn.Release()
 
-	// Set default limit
-	if limit < 1 || limit > 20 {
-		limit = 8
-	}
-
 	// First, resolve the product ID if a slug was provided
 	var resolvedID string
 	if _, err = uuid.Parse(productID); err == nil {
 		err = conn.QueryRow(ctx, `
 			SELECT id FROM products 
-			WHERE id = $1
+			WHERE id = $1 AND deleted_at IS NULL
 		`, productID).Scan(&resolvedID)
 	} else {
 		err = conn.QueryRow(ctx, `
 			SELECT id FROM products 
-			WHERE slug = $1
+			WHERE slug = $1 AND deleted_at IS NULL
 		`, productID).Scan(&resolvedID)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("product not found: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
 	}
 
 	// Query using the materialized view for pre-calculated similarities
@@ -436,6 +967,8 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 		LEFT JOIN images i ON p.main_img_id = i.id
 		WHERE ps.product_id = $1
 			AND p.available = true
+			AND p.deleted_at IS NULL
+			AND product_in_window(p.available_from, p.available_until)
 		ORDER BY ps.similarity_score DESC, p.name
 		LIMIT $2
 	`
@@ -444,11 +977,22 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 	if err != nil {
 		log.Printf("main strat failed: %v\n", err)
 		// If the materialized view doesn't exist or has issues, fall back to direct calculation
-		return findRelatedProductsFallback(ctx, conn, resolvedID, limit)
+		products, err := findRelatedProductsFallback(ctx, conn, resolvedID, limit)
+		if err != nil {
+			return nil, err
+		}
+		return &RelatedProductsResult{
+			Products:      products,
+			Source:        RelatedSourceComputed,
+			FallbackCount: len(products),
+		}, nil
 	}
 	defer rows.Close()
 
 	var products []*CatalogProd
+	// seen holds the ids already recommended, starting with the product
+	// itself, so it's never recommended and no product appears twice
+	seen := map[string]bool{resolvedID: true}
 	for rows.Next() {
 		var product CatalogProd
 		var imagesJSON []byte
@@ -471,6 +1015,11 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 			return nil, fmt.Errorf("failed to scan related product: %w", err)
 		}
 
+		if seen[product.ID] {
+			continue
+		}
+		seen[product.ID] = true
+
 		// Unmarshal JSON fields
 		if err = json.Unmarshal(imagesJSON, &product.Images); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal images: %w", err)
@@ -478,23 +1027,31 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 
 		products = append(products, &product)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read related products: %w", err)
+	}
+	rows.Close()
+
+	result := &RelatedProductsResult{
+		Source:          RelatedSourceSimilarity,
+		SimilarityCount: len(products),
+	}
 
 	// If we don't have enough related products, fill with products from the same category
 	if len(products) < limit {
 		remainingLimit := limit - len(products)
 
-		// Get the current product's category
+		// Get the current product's category, products without one get no fill
 		var currentCategoryID string
 		err = conn.QueryRow(ctx, `
-			SELECT category FROM products WHERE id = $1
+			SELECT COALESCE(category_id::text, '') FROM products WHERE id = $1
 		`, resolvedID).Scan(&currentCategoryID)
 
 		if err == nil && currentCategoryID != "" {
-			// Get product IDs we already have
-			existingIDs := make([]string, len(products)+1)
-			existingIDs[0] = resolvedID // Don't include the current product
-			for i, p := range products {
-				existingIDs[i+1] = p.ID
+			// Exclude the current product and the ones we already have
+			existingIDs := make([]string, 0, len(seen))
+			for id := range seen {
+				existingIDs = append(existingIDs, id)
 			}
 
 			// Query for additional products from the same category
@@ -523,7 +1080,9 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 				LEFT JOIN images i ON p.main_img_id = i.id
 				WHERE p.category_id = $1
 					AND p.available = true
-					AND p.id != ALL($2)
+					AND p.deleted_at IS NULL
+					AND product_in_window(p.available_from, p.available_until)
+					AND p.id != ALL($2::uuid[])
 				ORDER BY RANDOM() -- Random for variety
 				LIMIT $3
 			`
@@ -549,16 +1108,40 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 						&imagesJSON,
 					)
 					if err == nil {
-						if err = json.Unmarshal(imagesJSON, &product.Images); err == nil {
-							products = append(products, &product)
-						}
+						err = json.Unmarshal(imagesJSON, &product.Images)
+					}
+					if err != nil {
+						log.Printf("failed to read same category product: %v\n", err)
+						result.Partial = true
+						continue
 					}
+					if seen[product.ID] {
+						continue
+					}
+					seen[product.ID] = true
+					products = append(products, &product)
+					result.FallbackCount++
+				}
+				if err = fallbackRows.Err(); err != nil {
+					log.Printf("failed to read same category products: %v\n", err)
+					result.Partial = true
 				}
+			} else {
+				log.Printf("same category products query failed: %v\n", err)
+				result.Partial = true
 			}
+		} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("failed to get product category: %v\n", err)
+			result.Partial = true
 		}
 	}
 
-	return products, nil
+	if result.FallbackCount > 0 {
+		result.Source = RelatedSourceMixed
+	}
+	result.Products = products
+
+	return result, nil
 }
 
 // findRelatedProductsFallback is used when the materialized view is not available
@@ -566,7 +1149,7 @@ func FindRelatedProducts(productID string, limit int) ([]*CatalogProd, error) {
 func findRelatedProductsFallback(ctx context.Context, conn *pgxpool.Conn, productID string, limit int) ([]*CatalogProd, error) {
 	query := `
 		WITH current_product AS (
-			SELECT id, category, search_vector
+			SELECT id, category_id, search_vector
 			FROM products 
 			WHERE id = $1
 		)
@@ -595,12 +1178,14 @@ func findRelatedProductsFallback(ctx context.Context, conn *pgxpool.Conn, produc
 		LEFT JOIN images i ON p.main_img_id = i.id
 		WHERE p.id != cp.id
 			AND p.available = true
+			AND p.deleted_at IS NULL
+			AND product_in_window(p.available_from, p.available_until)
 			AND (
-				p.category_id = cp.category  -- Same category
+				p.category_id = cp.category_id  -- Same category
 				OR ts_rank(p.search_vector, cp.search_vector) > 0.1  -- Or similar content
 			)
 		ORDER BY 
-			CASE WHEN p.category_id = cp.category THEN 0 ELSE 1 END,  -- Prioritize same category
+			CASE WHEN p.category_id = cp.category_id THEN 0 ELSE 1 END,  -- Prioritize same category
 			ts_rank(p.search_vector, cp.search_vector) DESC,
 			p.name
 		LIMIT $2
@@ -703,9 +1288,11 @@ func FindRelatedProductsSimple(productID string, limit int) ([]*CatalogProd, err
 		JOIN products current_p ON (current_p.id = $1 OR current_p.slug = $1)
 		LEFT JOIN categories c ON p.category_id = c.id
 		LEFT JOIN images i ON p.main_img_id = i.id
-		WHERE p.category_id = current_p.category
+		WHERE p.category_id = current_p.category_id
 			AND p.id != current_p.id
 			AND p.available = true
+			AND p.deleted_at IS NULL
+			AND product_in_window(p.available_from, p.available_until)
 		ORDER BY RANDOM()  -- Random selection for variety
 		LIMIT $2
 	`
@@ -756,14 +1343,18 @@ func buildCatalogProductQueryConditions(filters CatalogProductFilterParams) ([]s
 	if len(filters.OnlyIDs) > 0 {
 		conditions = append(conditions, "id = ANY(@only_ids)")
 		namedArgs["only_ids"] = filters.OnlyIDs
+	} else if len(filters.OnlySlugs) > 0 {
+		conditions = append(conditions, "slug = ANY(@only_slugs)")
+		namedArgs["only_slugs"] = filters.OnlySlugs
 	} else {
 		// Add search condition
 		if filters.Search != "" {
 			switch filters.SearchMode {
 			case SearchModeFullText:
 				// Full-text search with ranking
-				conditions = append(conditions, "search_vector @@ plainto_tsquery(\"spanish\", @search_query)")
+				conditions = append(conditions, "search_vector @@ plainto_tsquery('spanish', @search_query)")
 				namedArgs["search_query"] = filters.Search
+				namedArgs["search_weights"] = ProductSearchWeights.Array()
 
 			case SearchModeExact:
 				// Exact match search
@@ -783,6 +1374,11 @@ func buildCatalogProductQueryConditions(filters CatalogProductFilterParams) ([]s
 			namedArgs["categories"] = filters.Categories
 		}
 
+		if filters.Subcategory != "" {
+			conditions = append(conditions, "id IN (SELECT id FROM products WHERE subcategory_id = @subcategory_id)")
+			namedArgs["subcategory_id"] = filters.Subcategory
+		}
+
 		// Add availability filter
 		if filters.Available > 0 {
 			conditions = append(conditions, "available = true")
@@ -814,13 +1410,17 @@ func buildCatalogProductQueryConditions(filters CatalogProductFilterParams) ([]s
 // buildCatalogProductSearchRankSelect adds search ranking column when using full-text search
 func buildCatalogProductSearchRankSelect(filters CatalogProductFilterParams) string {
 	if filters.Search != "" && filters.SearchMode == SearchModeFullText {
-		return "ts_rank(search_vector, plainto_tsquery(\"spanish\", @search_query)) as search_rank"
+		return "ts_rank(@search_weights::real[], search_vector, plainto_tsquery('spanish', @search_query)) as search_rank"
 	}
 	return "0 as search_rank"
 }
 
 // buildCatalogProductOrderByClause constructs the ORDER BY clause
 func buildCatalogProductOrderByClause(filters CatalogProductFilterParams) string {
+	if len(filters.OnlySlugs) > 0 {
+		return "ORDER BY array_position(@only_slugs::text[], slug::text)"
+	}
+
 	// If using full-text search with a query, prioritize search ranking
 	if filters.Search != "" && filters.SearchMode == SearchModeFullText {
 		switch strings.ToLower(filters.Sort) {
@@ -839,14 +1439,21 @@ func buildCatalogProductOrderByClause(filters CatalogProductFilterParams) string
 		case "category_desc":
 			return "ORDER BY category_name DESC, search_rank DESC"
 		case "available_first":
-			return "ORDER BY available DESC, search_rank DESC, name ASC"
+			return "ORDER BY (available AND quantity > 0) DESC, search_rank DESC, name ASC"
+		case "views_desc":
+			return "ORDER BY view_count DESC, search_rank DESC, name ASC"
 		default:
 			return "ORDER BY search_rank DESC, name ASC"
 		}
 	}
 
+	sort := strings.ToLower(filters.Sort)
+	if sort == "" {
+		sort = DefaultCatalogSort
+	}
+
 	// Regular sorting without search ranking
-	switch strings.ToLower(filters.Sort) {
+	switch sort {
 	case "name_asc", "name", "":
 		return "ORDER BY name ASC"
 	case "name_desc":
@@ -860,13 +1467,15 @@ func buildCatalogProductOrderByClause(filters CatalogProductFilterParams) string
 	case "category_desc":
 		return "ORDER BY category_name DESC, name ASC"
 	case "available_first":
-		return "ORDER BY available DESC, name ASC"
+		return "ORDER BY (available AND quantity > 0) DESC, name ASC"
 	case "available_last":
-		return "ORDER BY available ASC, name ASC"
+		return "ORDER BY (available AND quantity > 0) ASC, name ASC"
 	case "newest":
 		return "ORDER BY id DESC"
 	case "oldest":
 		return "ORDER BY id ASC"
+	case "views_desc":
+		return "ORDER BY view_count DESC, name ASC"
 	default:
 		return "ORDER BY name ASC"
 	}
@@ -928,6 +1537,9 @@ func scanCatalogProducts(rows pgx.Rows, includeRank bool) ([]*CatalogProd, error
 		if product.Quantity <= 0 {
 			product.Available = false
 		}
+		if product.ImageURL == "" {
+			product.ImageURL = DefaultProductImage
+		}
 
 		products = append(products, &product)
 	}
@@ -990,3 +1602,18 @@ func GetCatalogProductsByIDs(productIDs []string) (*CatalogProductFilterResult,
 		SearchMode: SearchModeFullText,
 	})
 }
+
+// GetProductsBySlugs retrieves the products with the given slugs, in the same
+// order. Unknown slugs are skipped
+func GetProductsBySlugs(slugs []string) (*CatalogProductFilterResult, error) {
+	if len(slugs) == 0 {
+		return &CatalogProductFilterResult{Products: []*CatalogProd{}, Page: 1}, nil
+	}
+
+	return FilterCatalogProducts(CatalogProductFilterParams{
+		OnlySlugs:  slugs,
+		Page:       1,
+		Limit:      len(slugs),
+		SearchMode: SearchModeFullText,
+	})
+}
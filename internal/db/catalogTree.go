@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vladwithcode/qrcatalog/internal/metrics"
+)
+
+// CategoryTreeCacheTTL bounds how long a cached tree is served even if no
+// write invalidated it, as some writes happen outside this package
+const CategoryTreeCacheTTL = 10 * time.Minute
+
+// CategoryNode is a category with its nested subcategories
+type CategoryNode struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Slug          string             `json:"slug"`
+	ProductCount  int                `json:"product_count"`
+	Subcategories []*SubcategoryNode `json:"subcategories"`
+}
+
+type SubcategoryNode struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	ProductCount int    `json:"product_count"`
+}
+
+var categoryTreeCache struct {
+	sync.RWMutex
+	tree      []*CategoryNode
+	expiresAt time.Time
+	// generation changes on every invalidation so a read that raced with
+	// a write doesn't cache a stale tree
+	generation int
+}
+
+// InvalidateCategoryTree drops the cached category tree so it's rebuilt on
+// the next read
+func InvalidateCategoryTree() {
+	categoryTreeCache.Lock()
+	defer categoryTreeCache.Unlock()
+	categoryTreeCache.tree = nil
+	categoryTreeCache.generation++
+}
+
+// GetCategoryTree returns every category with its subcategories and their
+// product counts. The tree is cached until a category, subcategory or
+// product write invalidates it
+func GetCategoryTree(ctx context.Context) ([]*CategoryNode, error) {
+	categoryTreeCache.RLock()
+	tree, expiresAt := categoryTreeCache.tree, categoryTreeCache.expiresAt
+	generation := categoryTreeCache.generation
+	categoryTreeCache.RUnlock()
+	if tree != nil && time.Now().Before(expiresAt) {
+		metrics.IncCacheHit()
+		return tree, nil
+	}
+	metrics.IncCacheMiss()
+
+	tree, err := findCategoryTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryTreeCache.Lock()
+	if categoryTreeCache.generation == generation {
+		categoryTreeCache.tree = tree
+		categoryTreeCache.expiresAt = time.Now().Add(CategoryTreeCacheTTL)
+	}
+	categoryTreeCache.Unlock()
+
+	return tree, nil
+}
+
+func findCategoryTree(ctx context.Context) ([]*CategoryNode, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT c.id, c.name, c.slug, COUNT(p.id) as product_count
+		FROM categories c
+		LEFT JOIN products p ON p.category_id = c.id AND p.deleted_at IS NULL
+			AND product_in_window(p.available_from, p.available_until)
+		GROUP BY c.id, c.name, c.slug, c.display_order
+		ORDER BY c.display_order ASC, c.name ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tree := []*CategoryNode{}
+	nodes := map[string]*CategoryNode{}
+	for rows.Next() {
+		node := &CategoryNode{Subcategories: []*SubcategoryNode{}}
+		err = rows.Scan(&node.ID, &node.Name, &node.Slug, &node.ProductCount)
+		if err != nil {
+			return nil, err
+		}
+		tree = append(tree, node)
+		nodes[node.ID] = node
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = conn.Query(
+		ctx,
+		`SELECT s.id, s.name, s.slug, s.category_id, COUNT(p.id) as product_count
+		FROM subcategories s
+		LEFT JOIN products p ON p.subcategory_id = s.id AND p.deleted_at IS NULL
+			AND product_in_window(p.available_from, p.available_until)
+		WHERE s.category_id IS NOT NULL
+		GROUP BY s.id, s.name, s.slug, s.category_id
+		ORDER BY s.name ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			sub        SubcategoryNode
+			categoryID string
+		)
+		err = rows.Scan(&sub.ID, &sub.Name, &sub.Slug, &categoryID, &sub.ProductCount)
+		if err != nil {
+			return nil, err
+		}
+		if parent, ok := nodes[categoryID]; ok {
+			parent.Subcategories = append(parent.Subcategories, &sub)
+		}
+	}
+
+	return tree, rows.Err()
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetCategoryTree(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	categoryID := createTestCategory(t)
+	subcategoryID := uuid.Must(uuid.NewV7()).String()
+	execTestSQL(
+		t,
+		`INSERT INTO subcategories (id, name, slug, description, category_id) VALUES ($1, $2, $2, '', $3)`,
+		subcategoryID,
+		"test-subcategory-"+subcategoryID,
+		categoryID,
+	)
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM subcategories WHERE id = $1`, subcategoryID)
+	})
+
+	inSubcategory, inCategory := createTestProduct(t, 1), createTestProduct(t, 1)
+	execTestSQL(t, `UPDATE products SET category_id = $2, subcategory_id = $3 WHERE id = $1`, inSubcategory, categoryID, subcategoryID)
+	execTestSQL(t, `UPDATE products SET category_id = $2 WHERE id = $1`, inCategory, categoryID)
+
+	InvalidateCategoryTree()
+	tree, err := GetCategoryTree(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var node *CategoryNode
+	for _, n := range tree {
+		if n.ID == categoryID {
+			node = n
+		}
+	}
+	if node == nil {
+		t.Fatal("category missing from the tree")
+	}
+	if node.ProductCount != 2 {
+		t.Errorf("got %d category products, want 2", node.ProductCount)
+	}
+	if len(node.Subcategories) != 1 || node.Subcategories[0].ID != subcategoryID {
+		t.Fatalf("got subcategories %+v, want [%s]", node.Subcategories, subcategoryID)
+	}
+	if got := node.Subcategories[0].ProductCount; got != 1 {
+		t.Errorf("got %d subcategory products, want 1", got)
+	}
+
+	cached, err := GetCategoryTree(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) == 0 || &cached[0] != &tree[0] {
+		t.Error("expected the second read to be served from the cache")
+	}
+
+	InvalidateCategoryTree()
+	rebuilt, err := GetCategoryTree(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rebuilt) == 0 || &rebuilt[0] == &tree[0] {
+		t.Error("expected the tree to be rebuilt after invalidating it")
+	}
+}
@@ -0,0 +1,470 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildCatalogProductOrderByClauseViews(t *testing.T) {
+	got := buildCatalogProductOrderByClause(CatalogProductFilterParams{Sort: "views_desc"})
+	if want := "ORDER BY view_count DESC, name ASC"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = buildCatalogProductOrderByClause(CatalogProductFilterParams{
+		Sort:       "views_desc",
+		Search:     "mesa",
+		SearchMode: SearchModeFullText,
+	})
+	if want := "ORDER BY view_count DESC, search_rank DESC, name ASC"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuildProductsOrderByClauseViews(t *testing.T) {
+	got := buildProductsOrderByClause(ProductFilterParams{Sort: "views_desc"})
+	if want := "ORDER BY prod.view_count DESC, name ASC"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = buildProductsOrderByClause(ProductFilterParams{
+		Sort:       "views_desc",
+		Search:     "mesa",
+		SearchMode: SearchModeFullText,
+	})
+	if want := "ORDER BY prod.view_count DESC, search_rank DESC, name ASC"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFindOrderedCatalogListingsRespectsCategoryPriority(t *testing.T) {
+	connectTestDB(t)
+
+	first, second := createTestCategory(t), createTestCategory(t)
+	for _, categoryID := range []string{first, second} {
+		productID := createTestProduct(t, 1)
+		execTestSQL(t, `UPDATE products SET category_id = $2 WHERE id = $1`, productID, categoryID)
+	}
+
+	for _, priority := range [][]string{{first, second}, {second, first}} {
+		listings, err := FindOrderedCatalogListings(CatalogListingsOptions{CategoryPriority: priority})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, listing := range listings {
+			if slices.Contains(priority, listing.CategoryID) {
+				got = append(got, listing.CategoryID)
+			}
+		}
+		if !slices.Equal(got, priority) {
+			t.Errorf("got category order %v, want %v", got, priority)
+		}
+		// Prioritized categories go before every other one
+		if len(listings) < 2 || listings[0].CategoryID != priority[0] || listings[1].CategoryID != priority[1] {
+			t.Errorf("expected the prioritized categories to be the first groups")
+		}
+	}
+}
+
+func TestValidateCatalogFields(t *testing.T) {
+	if err := ValidateCatalogFields([]string{"id", "name", "slug", "image_url"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := ValidateCatalogFields([]string{"id", "password"}); !errors.Is(err, ErrCatalogFieldInvalid) {
+		t.Errorf("expected ErrCatalogFieldInvalid, got %v", err)
+	}
+}
+
+func TestCatalogProductFilterResultProjectsFields(t *testing.T) {
+	result := CatalogProductFilterResult{
+		Products: []*CatalogProd{{
+			ID:          "p1",
+			Name:        "Mesa",
+			Slug:        "mesa",
+			Description: "Una descripción muy larga",
+			Images:      []string{"a.webp", "b.webp"},
+		}},
+		Total:  1,
+		fields: []string{"id", "name"},
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Products []map[string]any `json:"products"`
+		Total    int              `json:"total"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Total != 1 || len(got.Products) != 1 {
+		t.Fatalf("got %s", data)
+	}
+	product := got.Products[0]
+	if product["id"] != "p1" || product["name"] != "Mesa" {
+		t.Errorf("requested fields are missing from %v", product)
+	}
+	for _, field := range []string{"slug", "description", "images"} {
+		if _, ok := product[field]; ok {
+			t.Errorf("unrequested field %q was serialized", field)
+		}
+	}
+}
+
+func TestFindCatalogProductDetailNotFound(t *testing.T) {
+	connectTestDB(t)
+
+	for _, id := range []string{"test-missing-slug", uuid.Must(uuid.NewV7()).String()} {
+		if _, err := FindCatalogProductDetail(id); !errors.Is(err, ErrProductNotFound) {
+			t.Errorf("%s: expected ErrProductNotFound, got %v", id, err)
+		}
+	}
+}
+
+func TestRelatedProductsLimit(t *testing.T) {
+	tests := []struct {
+		limit   int
+		want    int
+		wantErr bool
+	}{
+		{-1, 0, true},
+		{0, DefaultRelatedProductsLimit, false},
+		{1, 1, false},
+		{MaxRelatedProductsLimit, MaxRelatedProductsLimit, false},
+		{MaxRelatedProductsLimit + 1, MaxRelatedProductsLimit, false},
+	}
+
+	for _, tt := range tests {
+		got, err := relatedProductsLimit(tt.limit)
+		if tt.wantErr {
+			if !errors.Is(err, ErrRelatedProductsLimit) {
+				t.Errorf("limit %d: expected ErrRelatedProductsLimit, got %v", tt.limit, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("limit %d: got %d, %v, want %d", tt.limit, got, err, tt.want)
+		}
+	}
+}
+
+func TestFindRelatedProductsRejectsNegativeLimits(t *testing.T) {
+	if _, err := FindRelatedProducts("mesa", -1); !errors.Is(err, ErrRelatedProductsLimit) {
+		t.Errorf("expected ErrRelatedProductsLimit, got %v", err)
+	}
+}
+
+func TestFindRelatedProductsReportsTheFallback(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	productID, siblingID := createTestProduct(t, 1), createTestProduct(t, 1)
+	execTestSQL(t, `UPDATE products SET category_id = $2 WHERE id = ANY($1)`, []string{productID, siblingID}, categoryID)
+
+	// New products have no precomputed similarities, so the sibling can
+	// only come from the same category fallback
+	result, err := FindRelatedProducts(productID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Source == RelatedSourceSimilarity {
+		t.Errorf("got source %s, expected a fallback", result.Source)
+	}
+	if result.FallbackCount == 0 || result.FallbackCount+result.SimilarityCount != len(result.Products) {
+		t.Errorf(
+			"got %d similar and %d fallback products for %d products",
+			result.SimilarityCount, result.FallbackCount, len(result.Products),
+		)
+	}
+	found := false
+	for _, product := range result.Products {
+		found = found || product.ID == siblingID
+	}
+	if !found {
+		t.Error("expected the same category product to be related")
+	}
+}
+
+func TestCatalogDefaultSortIsAvailableFirst(t *testing.T) {
+	got := buildCatalogProductOrderByClause(CatalogProductFilterParams{})
+	if want := "ORDER BY (available AND quantity > 0) DESC, name ASC"; got != want {
+		t.Errorf("got public default %q, want %q", got, want)
+	}
+
+	got = buildProductsOrderByClause(ProductFilterParams{})
+	if want := "ORDER BY name ASC, id ASC"; got != want {
+		t.Errorf("got admin default %q, want %q", got, want)
+	}
+}
+
+func TestFilterCatalogProductsListsInStockFirst(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	// Created first, so it sorts first by name
+	outOfStock := createTestProduct(t, 0)
+	inStock := createTestProduct(t, 3)
+	execTestSQL(t, `UPDATE products SET category_id = $2 WHERE id = ANY($1)`, []string{outOfStock, inStock}, categoryID)
+
+	result, err := FilterCatalogProducts(CatalogProductFilterParams{Categories: []string{categoryID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, product := range result.Products {
+		got = append(got, product.ID)
+	}
+	if want := []string{inStock, outOfStock}; !slices.Equal(got, want) {
+		t.Errorf("got products %v, want %v", got, want)
+	}
+}
+
+func TestFindAdjacentProducts(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	categoryID := createTestCategory(t)
+	// Test product names sort in creation order
+	ids := []string{
+		createTestProductIn(t, categoryID, 1),
+		createTestProductIn(t, categoryID, 1),
+		createTestProductIn(t, categoryID, 1),
+	}
+
+	tests := []struct {
+		name               string
+		productID          string
+		wantPrev, wantNext string
+	}{
+		{"first", ids[0], "", ids[1]},
+		{"middle", ids[1], ids[0], ids[2]},
+		{"last", ids[2], ids[1], ""},
+	}
+
+	productID := func(p *CatalogProd) string {
+		if p == nil {
+			return ""
+		}
+		return p.ID
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev, next, err := FindAdjacentProducts(ctx, tt.productID, categoryID, "name_asc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := productID(prev); got != tt.wantPrev {
+				t.Errorf("got prev %q, want %q", got, tt.wantPrev)
+			}
+			if got := productID(next); got != tt.wantNext {
+				t.Errorf("got next %q, want %q", got, tt.wantNext)
+			}
+		})
+	}
+
+	_, _, err := FindAdjacentProducts(ctx, uuid.Must(uuid.NewV7()).String(), categoryID, "name_asc")
+	if !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("expected ErrProductNotFound for a missing product, got %v", err)
+	}
+}
+
+func TestFilterCatalogProductsFullTextSearch(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	match := createTestProductIn(t, categoryID, 1)
+	other := createTestProductIn(t, categoryID, 1)
+	execTestSQL(t, `UPDATE products SET description = 'Mantel bordado de lino' WHERE id = $1`, match)
+	execTestSQL(t, `UPDATE products SET description = 'Silla plegable' WHERE id = $1`, other)
+
+	result, err := FilterCatalogProducts(CatalogProductFilterParams{
+		Search:     "mantel",
+		SearchMode: SearchModeFullText,
+		OnlyIDs:    []string{match, other},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Products) != 1 || result.Products[0].ID != match {
+		var got []string
+		for _, product := range result.Products {
+			got = append(got, product.ID)
+		}
+		t.Errorf("got products %v, want [%s]", got, match)
+	}
+}
+
+func TestFilterCatalogProductsWithFacets(t *testing.T) {
+	connectTestDB(t)
+
+	first, second := createTestCategory(t), createTestCategory(t)
+	cheap := createTestProductIn(t, first, 1)
+	unavailable := createTestProductIn(t, first, 1)
+	expensive := createTestProductIn(t, second, 1)
+	execTestSQL(t, `UPDATE products SET price = 50 WHERE id = $1`, cheap)
+	execTestSQL(t, `UPDATE products SET price = 600, available = false WHERE id = $1`, unavailable)
+	execTestSQL(t, `UPDATE products SET price = 2000 WHERE id = $1`, expensive)
+
+	result, err := FilterCatalogProductsWithFacets(CatalogProductFilterParams{
+		OnlyIDs: []string{cheap, unavailable, expensive},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	facets := result.Facets
+	if facets == nil {
+		t.Fatal("expected facets in the result")
+	}
+
+	categoryCounts := map[string]int{}
+	for _, facet := range facets.Categories {
+		categoryCounts[facet.CategoryID] = facet.Count
+	}
+	if want := map[string]int{first: 2, second: 1}; !maps.Equal(categoryCounts, want) {
+		t.Errorf("got category counts %v, want %v", categoryCounts, want)
+	}
+
+	if facets.Available != 2 || facets.Unavailable != 1 {
+		t.Errorf("got %d available and %d unavailable, want 2 and 1", facets.Available, facets.Unavailable)
+	}
+
+	var bucketCounts []int
+	for _, bucket := range facets.PriceBuckets {
+		bucketCounts = append(bucketCounts, bucket.Count)
+	}
+	// Buckets start at 0, 100, 500, 1000 and 5000
+	if want := []int{1, 0, 1, 1, 0}; !slices.Equal(bucketCounts, want) {
+		t.Errorf("got price bucket counts %v, want %v", bucketCounts, want)
+	}
+}
+
+func TestFindFeaturedProductsRejectsNegativeLimits(t *testing.T) {
+	if _, err := FindFeaturedProducts(-1); !errors.Is(err, ErrFeaturedProductsLimit) {
+		t.Errorf("got error %v, want %v", err, ErrFeaturedProductsLimit)
+	}
+}
+
+func TestFindFeaturedProductsPutsFeaturedFirst(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	// Created first so it would sort first by name if featured didn't matter
+	plain := createTestProductIn(t, categoryID, 1)
+	soldOut := createTestProductIn(t, categoryID, 0)
+	featured := createTestProductIn(t, categoryID, 1)
+	if err := SetProductFeatured(featured, true); err != nil {
+		t.Fatal(err)
+	}
+
+	products, err := FindFeaturedProducts(MaxFeaturedProductsLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	position := map[string]int{}
+	for i, product := range products {
+		position[product.ID] = i
+	}
+	featuredAt, ok := position[featured]
+	if !ok {
+		t.Fatal("expected the featured product to be selected")
+	}
+	if at, ok := position[plain]; ok && at < featuredAt {
+		t.Error("expected the featured product before the non-featured one")
+	}
+	if at, ok := position[soldOut]; ok {
+		if plainAt, ok := position[plain]; ok && at < plainAt {
+			t.Error("expected the available product before the sold out one")
+		}
+	}
+}
+
+func TestSetProductFeaturedOfMissingProduct(t *testing.T) {
+	connectTestDB(t)
+
+	err := SetProductFeatured(uuid.Must(uuid.NewV7()).String(), true)
+	if !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrProductNotFound)
+	}
+}
+
+func TestCatalogListingsUseTheDefaultImage(t *testing.T) {
+	connectTestDB(t)
+	useDefaultProductImage(t, "placeholder.webp")
+
+	categoryID := createTestCategory(t)
+	withoutImage := createTestProductIn(t, categoryID, 1)
+	createTestProductIn(t, categoryID, 1)
+
+	listings, err := FindOrderedCatalogListings(CatalogListingsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups []*CatalogListing
+	for _, listing := range listings {
+		if listing.CategoryID == categoryID {
+			groups = append(groups, listing)
+		}
+	}
+	if len(groups) != 1 {
+		t.Fatalf("got %d listings for the category, want 1", len(groups))
+	}
+	if len(groups[0].Products) != 2 {
+		t.Errorf("got %d products in the listing, want 2", len(groups[0].Products))
+	}
+	for _, product := range groups[0].Products {
+		if product.ID == withoutImage && product.ImageURL != "placeholder.webp" {
+			t.Errorf("got image %q, want the default", product.ImageURL)
+		}
+	}
+}
+
+func TestFindRelatedProductsHasNoDuplicatesOrSelf(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	productID := createTestProductIn(t, categoryID, 1)
+	siblings := []string{
+		createTestProductIn(t, categoryID, 1),
+		createTestProductIn(t, categoryID, 1),
+		createTestProductIn(t, categoryID, 1),
+	}
+
+	// Looked up by slug too, the product must still be excluded by its id
+	for _, ref := range []string{productID, "test-product-" + productID} {
+		result, err := FindRelatedProducts(ref, MaxRelatedProductsLimit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := map[string]bool{}
+		for _, product := range result.Products {
+			if product.ID == productID {
+				t.Errorf("%s: got the product related to itself", ref)
+			}
+			if seen[product.ID] {
+				t.Errorf("%s: got product %s more than once", ref, product.ID)
+			}
+			seen[product.ID] = true
+		}
+		for _, siblingID := range siblings {
+			if !seen[siblingID] {
+				t.Errorf("%s: expected the same category product %s to be related", ref, siblingID)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math"
 	"strings"
@@ -13,6 +14,31 @@ import (
 	"github.com/vladwithcode/qrcatalog/internal/utils"
 )
 
+var (
+	ErrCategoryNotFound          = errors.New("category not found")
+	ErrCategoryPatchEmpty        = errors.New("no fields provided for category patch")
+	ErrCategoryPatchInvalidField = errors.New("field can't be patched on category")
+	ErrCategoryPatchInvalidValue = errors.New("invalid value type for category field")
+)
+
+// categoryPatchColumns maps the accepted patch keys (both json and column
+// names) to the column they update
+var categoryPatchColumns = map[string]string{
+	"name":             "name",
+	"slug":             "slug",
+	"description":      "description",
+	"long_description": "long_description",
+	"longDescription":  "long_description",
+	"header_img":       "header_img",
+	"headerImg":        "header_img",
+	"headerImgId":      "header_img",
+	"display_img":      "display_img",
+	"displayImg":       "display_img",
+	"displayImgId":     "display_img",
+	"qrcode_filename":  "qrcode_filename",
+	"qrcodeFilename":   "qrcode_filename",
+}
+
 type Category struct {
 	ID              string `db:"id" json:"id"`
 	Name            string `db:"name" json:"name"`
@@ -48,6 +74,7 @@ type CategoryFilterResult struct {
 }
 
 func CreateCategory(category *Category) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -227,7 +254,10 @@ func FindCategoryByID(id string) (*Category, error) {
 	return &category, nil
 }
 
-func FindAllCategories() ([]*Category, error) {
+// FindAllCategories returns every category sorted by name. ProductCount is
+// only populated when includeCounts is set, otherwise products aren't queried
+// and it's left at 0
+func FindAllCategories(includeCounts bool) ([]*Category, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -236,19 +266,26 @@ func FindAllCategories() ([]*Category, error) {
 	}
 	defer conn.Release()
 
+	productCount := "0"
+	if includeCounts {
+		productCount = `(SELECT COUNT(*) FROM products p
+			WHERE p.category_id = ctg.id AND p.deleted_at IS NULL)`
+	}
+
 	rows, err := conn.Query(
 		ctx,
-		`SELECT
+		fmt.Sprintf(`SELECT
 			ctg.id, ctg.name, ctg.slug, ctg.description, 
 			header.filename AS header_img,
 			header.id AS header_img_id,
 			display.filename AS display_img,
 			display.id AS display_img_id,
-			ctg.qrcode_filename
+			ctg.qrcode_filename,
+			%s AS product_count
 		FROM categories ctg
 			LEFT JOIN images header ON header.id = ctg.header_img
 			LEFT JOIN images display ON display.id = ctg.display_img
-		ORDER BY ctg.name`,
+		ORDER BY ctg.name`, productCount),
 	)
 	if err != nil {
 		return nil, err
@@ -275,6 +312,7 @@ func FindAllCategories() ([]*Category, error) {
 			&displayImg,
 			&displayImgID,
 			&category.QRCodeFilename,
+			&category.ProductCount,
 		)
 		if err != nil {
 			return nil, err
@@ -300,6 +338,7 @@ func FindAllCategories() ([]*Category, error) {
 }
 
 func UpdateCategory(category *Category) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -352,7 +391,90 @@ func UpdateCategory(category *Category) error {
 	return nil
 }
 
+// PatchCategory updates only the provided fields of the category with the
+// given id, leaving every other column untouched. Image fields accept an
+// empty string or nil to clear the image
+func PatchCategory(ctx context.Context, id string, fields map[string]any) error {
+	setClauses, args, err := buildCategoryPatch(fields)
+	if err != nil {
+		return err
+	}
+	args["id"] = id
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		fmt.Sprintf(`UPDATE categories SET %s WHERE id = @id`, strings.Join(setClauses, ", ")),
+		args,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// buildCategoryPatch validates the patch fields, returning the SET clauses
+// and the args they reference
+func buildCategoryPatch(fields map[string]any) ([]string, pgx.NamedArgs, error) {
+	if len(fields) == 0 {
+		return nil, nil, ErrCategoryPatchEmpty
+	}
+
+	args := pgx.NamedArgs{}
+	setClauses := []string{}
+	for key, value := range fields {
+		column, ok := categoryPatchColumns[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrCategoryPatchInvalidField, key)
+		}
+		if _, exists := args[column]; exists {
+			continue
+		}
+
+		var strVal string
+		if value != nil {
+			v, ok := value.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: %s", ErrCategoryPatchInvalidValue, key)
+			}
+			strVal = v
+		}
+
+		switch column {
+		case "header_img", "display_img", "long_description":
+			args[column] = sql.NullString{String: strVal, Valid: strVal != ""}
+		case "slug":
+			if strVal == "" {
+				return nil, nil, fmt.Errorf("%w: %s", ErrCategoryPatchInvalidValue, key)
+			}
+			args[column] = utils.Slugify(strVal)
+		case "name", "description":
+			if strVal == "" {
+				return nil, nil, fmt.Errorf("%w: %s", ErrCategoryPatchInvalidValue, key)
+			}
+			args[column] = strVal
+		default:
+			args[column] = strVal
+		}
+		setClauses = append(setClauses, fmt.Sprintf("%s = @%s", column, column))
+	}
+
+	return setClauses, args, nil
+}
+
 func DeleteCategory(id string) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -400,7 +522,7 @@ func FilterCategories(filters CategoryFilterParams) (*CategoryFilterResult, erro
 	// Base query with explicit column selection
 	baseQuery := `
 		FROM categories ctg
-		LEFT JOIN products p ON ctg.id = p.category_id
+		LEFT JOIN products p ON ctg.id = p.category_id AND p.deleted_at IS NULL
 		LEFT JOIN images header ON header.id = ctg.header_img
 		LEFT JOIN images display ON display.id = ctg.display_img
 		`
@@ -711,3 +833,27 @@ func DeleteCategoryDisplayImg(categoryId string) error {
 
 	return nil
 }
+
+// UpdateCategoryQRCode stores the filename of the category's generated qr
+func UpdateCategoryQRCode(ctx context.Context, id, filename string) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE categories SET qrcode_filename = $1 WHERE id = $2`,
+		filename,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
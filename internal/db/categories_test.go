@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestBuildCategoryPatch(t *testing.T) {
+	setClauses, args, err := buildCategoryPatch(map[string]any{
+		"name":       "Mesas",
+		"slug":       "Mesas Plegables",
+		"headerImg":  nil,
+		"displayImg": "cover.jpg",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(setClauses)
+	want := []string{
+		"display_img = @display_img",
+		"header_img = @header_img",
+		"name = @name",
+		"slug = @slug",
+	}
+	if !slices.Equal(setClauses, want) {
+		t.Errorf("got set clauses %v, want %v", setClauses, want)
+	}
+
+	if args["name"] != "Mesas" {
+		t.Errorf("got name %v", args["name"])
+	}
+	if args["slug"] != "mesas-plegables" {
+		t.Errorf("expected the slug to be slugified, got %v", args["slug"])
+	}
+	if args["header_img"] != (sql.NullString{}) {
+		t.Errorf("expected nil to clear header_img, got %v", args["header_img"])
+	}
+	if args["display_img"] != (sql.NullString{String: "cover.jpg", Valid: true}) {
+		t.Errorf("got display_img %v", args["display_img"])
+	}
+}
+
+func TestBuildCategoryPatchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]any
+		want   error
+	}{
+		{"empty", map[string]any{}, ErrCategoryPatchEmpty},
+		{"unknown field", map[string]any{"id": "x"}, ErrCategoryPatchInvalidField},
+		{"non string value", map[string]any{"name": 1}, ErrCategoryPatchInvalidValue},
+		{"empty name", map[string]any{"name": ""}, ErrCategoryPatchInvalidValue},
+		{"empty slug", map[string]any{"slug": nil}, ErrCategoryPatchInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := buildCategoryPatch(tt.fields)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFindAllCategoriesProductCounts(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	createTestProductIn(t, categoryID, 1)
+	createTestProductIn(t, categoryID, 0)
+	deleted := createTestProductIn(t, categoryID, 1)
+	execTestSQL(t, `UPDATE products SET deleted_at = NOW() WHERE id = $1`, deleted)
+
+	tests := []struct {
+		name          string
+		includeCounts bool
+		want          int
+	}{
+		{"with counts", true, 2},
+		{"without counts", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			categories, err := FindAllCategories(tt.includeCounts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			i := slices.IndexFunc(categories, func(c *Category) bool { return c.ID == categoryID })
+			if i < 0 {
+				t.Fatal("expected the category to be listed")
+			}
+			if got := categories[i].ProductCount; got != tt.want {
+				t.Errorf("got %d products, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,9 +6,13 @@ package db
 import (
 	"context"
 	"errors"
+	"log"
 	"os"
+	"strconv"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vladwithcode/qrcatalog/internal/metrics"
 )
 
 var (
@@ -16,14 +20,60 @@ var (
 	ErrUUIDFail  = errors.New("failed to generate new uuid")
 )
 
+const (
+	EnvVarDefaultProductImage  = "DEFAULT_PRODUCT_IMAGE"
+	EnvVarProductSearchWeights = "PRODUCT_SEARCH_WEIGHTS"
+	// EnvVarUniqueProductNames enables UniqueProductNamesPerCategory if "true"
+	EnvVarUniqueProductNames = "UNIQUE_PRODUCT_NAMES_PER_CATEGORY"
+	EnvVarMaxWizardSteps     = "MAX_WIZARD_STEPS"
+)
+
 var dbPool *pgxpool.Pool
 
+// DefaultProductImage is the image filename used for products without a main
+// image. Empty means no fallback
+var DefaultProductImage string
+
+// UniqueProductNamesPerCategory rejects creating or renaming a product to a
+// name (case insensitive) another product of its category already has
+var UniqueProductNamesPerCategory bool
+
+// SetDBParameters reads the optional db configuration from the environment
+func SetDBParameters() {
+	DefaultProductImage = os.Getenv(EnvVarDefaultProductImage)
+	UniqueProductNamesPerCategory = os.Getenv(EnvVarUniqueProductNames) == "true"
+
+	if envMaxSteps := os.Getenv(EnvVarMaxWizardSteps); envMaxSteps != "" {
+		maxSteps, err := strconv.Atoi(envMaxSteps)
+		if err != nil || maxSteps < 1 {
+			log.Printf("ignoring %s: must be a positive number\n", EnvVarMaxWizardSteps)
+		} else {
+			MaxWizardSteps = maxSteps
+		}
+	}
+
+	if envWeights := os.Getenv(EnvVarProductSearchWeights); envWeights != "" {
+		weights, err := ParseSearchWeights(envWeights)
+		if err != nil {
+			log.Printf("ignoring %s: %v\n", EnvVarProductSearchWeights, err)
+		} else {
+			ProductSearchWeights = weights
+		}
+	}
+}
+
 func Connect() (*pgxpool.Pool, error) {
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		return nil, ErrNoConnStr
 	}
-	pool, err := pgxpool.New(context.Background(), dbURL)
+	config, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig.Tracer = metricsTracer{}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, err
 	}
@@ -39,11 +89,29 @@ func Connect() (*pgxpool.Pool, error) {
 }
 
 func GetConn() (*pgxpool.Conn, error) {
-	return dbPool.Acquire(context.Background())
+	return GetConnWithContext(context.Background())
 }
 
 func GetConnWithContext(ctx context.Context) (*pgxpool.Conn, error) {
-	return dbPool.Acquire(ctx)
+	conn, err := dbPool.Acquire(ctx)
+	if err != nil {
+		metrics.IncDBError()
+	}
+	return conn, err
+}
+
+// metricsTracer counts failed queries. Missing rows aren't counted as
+// they're an expected outcome for lookups
+type metricsTracer struct{}
+
+func (metricsTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (metricsTracer) TraceQueryEnd(_ context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		metrics.IncDBError()
+	}
 }
 
 type PaginationData struct {
@@ -0,0 +1,348 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// EnvVarTestDatabaseURL points the tests that need a database to one with the
+// app's schema. They're skipped when it isn't set
+const EnvVarTestDatabaseURL = "TEST_DATABASE_URL"
+
+// connectTestDB connects the package pool to the test database, skipping the
+// test if there isn't one
+func connectTestDB(t *testing.T) {
+	t.Helper()
+
+	dbURL := os.Getenv(EnvVarTestDatabaseURL)
+	if dbURL == "" {
+		t.Skipf("%s is not set", EnvVarTestDatabaseURL)
+	}
+	t.Setenv("DATABASE_URL", dbURL)
+
+	pool, err := Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+}
+
+// createTestProduct inserts a product with the given stock, deleting it
+// once the test ends
+func createTestProduct(t *testing.T, quantity int) string {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	id := uuid.Must(uuid.NewV7()).String()
+	_, err = conn.Exec(
+		ctx,
+		`INSERT INTO products (id, name, slug, description, quantity) VALUES ($1, $2, $2, '', $3)`,
+		id,
+		"test-product-"+id,
+		quantity,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn, err := GetConnWithContext(ctx)
+		if err != nil {
+			return
+		}
+		defer conn.Release()
+		conn.Exec(ctx, `DELETE FROM quotes WHERE cart_id IN (SELECT cart_id FROM cart_items WHERE product_id = $1)`, id)
+		conn.Exec(ctx, `DELETE FROM carts WHERE id IN (SELECT cart_id FROM cart_items WHERE product_id = $1)`, id)
+		conn.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+	})
+
+	return id
+}
+
+// createTestCart saves a cart holding qty of each of the products
+func createTestCart(t *testing.T, qty int, productIDs ...string) *Cart {
+	t.Helper()
+
+	cart := NewCart()
+	cart.CustomerEmail = "cliente@example.com"
+	for _, id := range productIDs {
+		cart.AddItem(&CartItem{
+			ProductID: id,
+			Quantity:  qty,
+			Source:    string(CartItemSourceCatalog),
+		})
+	}
+	if err := cart.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return cart
+}
+
+// productQuantity reads the stored stock of the product
+func productQuantity(t *testing.T, id string) int {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	var qty int
+	err = conn.QueryRow(ctx, `SELECT quantity FROM products WHERE id = $1`, id).Scan(&qty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return qty
+}
+
+// setProductQuantity overwrites the stored stock of the product
+func setProductQuantity(t *testing.T, id string, qty int) {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `UPDATE products SET quantity = $2 WHERE id = $1`, id, qty)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cartQuote builds a quote submitting the cart
+func cartQuote(cart *Cart) *Quote {
+	return &Quote{
+		CustomerName: "Cliente",
+		RequestType:  QuoteRequestTypeBudget,
+		Status:       QuoteStatusPending,
+		CartID:       sql.NullString{String: cart.ID, Valid: true},
+	}
+}
+
+// createTestCategory inserts a category, deleting it once the test ends.
+// Products left in it must be deleted by their own cleanup first
+func createTestCategory(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	id := uuid.Must(uuid.NewV7()).String()
+	_, err = conn.Exec(
+		ctx,
+		`INSERT INTO categories (id, name, slug, description) VALUES ($1, $2, $2, '')`,
+		id,
+		"test-category-"+id,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn, err := GetConnWithContext(ctx)
+		if err != nil {
+			return
+		}
+		defer conn.Release()
+		conn.Exec(ctx, `DELETE FROM categories WHERE id = $1`, id)
+	})
+
+	return id
+}
+
+// createTestSubcategory inserts a subcategory of the category, whose name and
+// slug are "test-subcategory-" followed by its id
+func createTestSubcategory(t *testing.T, categoryID string) string {
+	t.Helper()
+
+	id := uuid.Must(uuid.NewV7()).String()
+	execTestSQL(
+		t,
+		`INSERT INTO subcategories (id, name, slug, description, category_id) VALUES ($1, $2, $2, '', $3)`,
+		id,
+		"test-subcategory-"+id,
+		categoryID,
+	)
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM subcategories WHERE id = $1`, id)
+	})
+
+	return id
+}
+
+// execTestSQL runs a statement against the test database
+func execTestSQL(t *testing.T, sql string, args ...any) {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, sql, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createTestSection saves the section, deleting it once the test ends
+func createTestSection(t *testing.T, section *Section) *Section {
+	t.Helper()
+
+	if err := CreateSection(context.Background(), section); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		DeleteSection(context.Background(), section.ID)
+	})
+
+	return section
+}
+
+// filteredSectionIDs runs FilterSections and returns the ids it found
+func filteredSectionIDs(t *testing.T, filters SectionFilterParams) []string {
+	t.Helper()
+
+	result, err := FilterSections(context.Background(), filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, section := range result.Sections {
+		ids = append(ids, section.ID)
+	}
+	return ids
+}
+
+// createTestImage inserts an image, deleting it and its product links once
+// the test ends
+func createTestImage(t *testing.T) string {
+	t.Helper()
+
+	id := uuid.Must(uuid.NewV7()).String()
+	execTestSQL(
+		t,
+		`INSERT INTO images (id, filename, name, no_optimize, size) VALUES ($1, $2, $2, true, 0)`,
+		id,
+		"test-image-"+id,
+	)
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM images_products WHERE image_id = $1`, id)
+		execTestSQL(t, `DELETE FROM images WHERE id = $1`, id)
+	})
+
+	return id
+}
+
+// countTestRows runs a count query against the test database
+func countTestRows(t *testing.T, sql string, args ...any) int {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	var count int
+	if err := conn.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// createTestWizardStep saves a step for the given categories, deleting it
+// once the test ends
+func createTestWizardStep(t *testing.T, step *WizardStep) *WizardStep {
+	t.Helper()
+
+	if step.Name == "" {
+		step.Name = "test-step"
+	}
+	if err := CreateWizardStep(context.Background(), step); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM wizard_steps_wizards WHERE wizard_step_id = $1`, step.ID)
+		execTestSQL(t, `DELETE FROM wizard_step_categories WHERE wizard_step_id = $1`, step.ID)
+		DeleteWizardStep(context.Background(), step.ID)
+	})
+
+	return step
+}
+
+// createTestProductIn inserts a product with the given stock in the category
+func createTestProductIn(t *testing.T, categoryID string, quantity int) string {
+	t.Helper()
+
+	id := createTestProduct(t, quantity)
+	execTestSQL(t, `UPDATE products SET category_id = $2 WHERE id = $1`, id, categoryID)
+	return id
+}
+
+// useDefaultProductImage sets the fallback product image for the test
+func useDefaultProductImage(t *testing.T, filename string) {
+	t.Helper()
+
+	prev := DefaultProductImage
+	t.Cleanup(func() { DefaultProductImage = prev })
+	t.Setenv(EnvVarDefaultProductImage, filename)
+	SetDBParameters()
+}
+
+// createTestQuote saves a quote without a cart for the customer, deleting it
+// once the test ends
+func createTestQuote(t *testing.T, customerName string) *Quote {
+	t.Helper()
+
+	quote := &Quote{
+		CustomerName: customerName,
+		RequestType:  QuoteRequestTypeBudget,
+		Status:       QuoteStatusPending,
+	}
+	if err := CreateQuote(quote); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM quotes WHERE id = $1`, quote.ID)
+	})
+
+	return quote
+}
+
+// createTestWizard saves an empty wizard, deleting it once the test ends.
+// Steps are attached with AttachStepToWizard
+func createTestWizard(t *testing.T) *Wizard {
+	t.Helper()
+
+	wizard := &Wizard{Name: "test-wizard", Enabled: true}
+	if err := CreateWizard(context.Background(), wizard); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM wizard_steps_wizards WHERE wizard_id = $1`, wizard.ID)
+		DeleteWizard(context.Background(), wizard.ID)
+	})
+
+	return wizard
+}
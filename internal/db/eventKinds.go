@@ -128,6 +128,60 @@ func FindEventKindByID(id string) (*EventKind, error) {
 	return &eventKind, nil
 }
 
+// FindEventKindsByIDs returns the event kinds with the given ids keyed by
+// their id. Ids that don't exist (or aren't valid) are left out of the map
+func FindEventKindsByIDs(ids []string) (map[string]*EventKind, error) {
+	eventKinds := make(map[string]*EventKind, len(ids))
+
+	validIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err == nil {
+			validIDs = append(validIDs, id)
+		}
+	}
+	if len(validIDs) == 0 {
+		return eventKinds, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT id, name, description, created_at, updated_at FROM event_kinds WHERE id = ANY($1::uuid[])`,
+		validIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventKind EventKind
+		err = rows.Scan(
+			&eventKind.ID,
+			&eventKind.Name,
+			&eventKind.Description,
+			&eventKind.CreatedAt,
+			&eventKind.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		eventKinds[eventKind.ID] = &eventKind
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return eventKinds, nil
+}
+
 func UpdateEventKind(eventKind *EventKind) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFindEventKindsByIDs(t *testing.T) {
+	connectTestDB(t)
+
+	var ids []string
+	for _, name := range []string{"Boda", "XV años"} {
+		eventKind := &EventKind{Name: name}
+		if err := CreateEventKind(eventKind); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			DeleteEventKind(eventKind.ID)
+		})
+		ids = append(ids, eventKind.ID)
+	}
+	missing := uuid.Must(uuid.NewV7()).String()
+
+	eventKinds, err := FindEventKindsByIDs(append(ids, missing, "not-an-id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(eventKinds) != len(ids) {
+		t.Errorf("got %d event kinds, want %d", len(eventKinds), len(ids))
+	}
+	for _, id := range ids {
+		if eventKinds[id] == nil {
+			t.Errorf("expected event kind %s to be found", id)
+		}
+	}
+	if eventKinds[missing] != nil {
+		t.Error("expected the missing id to be left out")
+	}
+}
+
+func TestFindEventKindsByIDsWithoutValidIDs(t *testing.T) {
+	eventKinds, err := FindEventKindsByIDs([]string{"not-an-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eventKinds == nil || len(eventKinds) != 0 {
+		t.Errorf("got %v, want an empty map", eventKinds)
+	}
+}
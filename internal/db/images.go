@@ -18,6 +18,8 @@ const (
 var (
 	ErrImageInsert                = errors.New("failed to insert image")
 	ErrDeleteImageProductRelation = errors.New("failed to delete image product relation")
+	ErrImageProductsLink          = errors.New("failed to link image to products")
+	ErrImageInUse                 = errors.New("image is in use")
 )
 
 type Image struct {
@@ -139,7 +141,10 @@ func LinkImagesToProduct(imgIDs []string, prodID string) error {
 		_, err = tx.Exec(
 			ctx,
 			`INSERT INTO images_products (image_id, product_id)
-				VALUES ($1, $2)`,
+				SELECT $1, $2
+				WHERE NOT EXISTS (
+					SELECT 1 FROM images_products WHERE image_id = $1 AND product_id = $2
+				)`,
 			id,
 			prodID,
 		)
@@ -149,18 +154,51 @@ func LinkImagesToProduct(imgIDs []string, prodID string) error {
 		}
 	}
 
+	// Unlink the images that are no longer part of the product's gallery
 	_, err = tx.Exec(
 		ctx,
-		`DELETE FROM images WHERE id NOT IN @ids::uuid[]`,
-		pgx.NamedArgs{"ids": imgIDs},
+		`DELETE FROM images_products WHERE product_id = @product_id AND image_id != ALL(@ids::uuid[])`,
+		pgx.NamedArgs{"product_id": prodID, "ids": imgIDs},
 	)
 	if err != nil {
-		return ErrDeleteImageProductRelation
+		return errors.Join(ErrDeleteImageProductRelation, err)
 	}
 
 	return tx.Commit(ctx)
 }
 
+// LinkImageToProducts adds the image to the gallery of every given product,
+// skipping the products that already have it
+func LinkImageToProducts(ctx context.Context, imageID string, productIDs []string) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(
+		ctx,
+		`INSERT INTO images_products (image_id, product_id)
+			SELECT @image_id, prod_id FROM unnest(@product_ids::uuid[]) AS prod_id
+		ON CONFLICT DO NOTHING`,
+		pgx.NamedArgs{
+			"image_id":    imageID,
+			"product_ids": productIDs,
+		},
+	)
+	if err != nil {
+		return errors.Join(ErrImageProductsLink, err)
+	}
+
+	return nil
+}
+
 func UnlinkImagesFromProduct(imgIDs []string, prodID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -355,7 +393,28 @@ func DeleteImages(ids []string) ([]string, error) {
 	return deletedFilenames, nil
 }
 
+// ImageReference is a record using an image as its main/header/display image
+type ImageReference struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+}
+
+// DeleteImage deletes the image with the given id and returns its filename.
+// Fails with ErrImageInUse if the image is used as a product main image or
+// a category/subcategory image
 func DeleteImage(id string) (string, error) {
+	return deleteImage(id, false)
+}
+
+// DeleteImageClearingRefs deletes the image with the given id, clearing
+// every product/category/subcategory reference to it in the same transaction
+func DeleteImageClearingRefs(id string) (string, error) {
+	return deleteImage(id, true)
+}
+
+func deleteImage(id string, clearRefs bool) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -363,19 +422,97 @@ func DeleteImage(id string) (string, error) {
 		return "", err
 	}
 	defer conn.Release()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	refs, err := findImageReferences(ctx, tx, id)
+	if err != nil {
+		return "", err
+	}
+	if len(refs) > 0 {
+		if !clearRefs {
+			return "", fmt.Errorf("%w: referenced by %d record(s)", ErrImageInUse, len(refs))
+		}
+
+		for _, ref := range imageRefColumns {
+			_, err = tx.Exec(
+				ctx,
+				fmt.Sprintf(`UPDATE %s SET %s = NULL WHERE %s = $1`, ref.table, ref.column, ref.column),
+				id,
+			)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
 
 	var filename string
-	row := conn.QueryRow(
+	err = tx.QueryRow(
 		ctx,
 		`DELETE FROM images WHERE id = $1 RETURNING filename`,
 		id,
-	)
-	err = row.Scan(&filename)
+	).Scan(&filename)
 	if err != nil {
 		return "", err
 	}
 
-	return filename, nil
+	return filename, tx.Commit(ctx)
+}
+
+// imageRefColumns lists every column holding a reference to a single image
+var imageRefColumns = []struct{ table, column string }{
+	{"products", "main_img_id"},
+	{"categories", "header_img"},
+	{"categories", "display_img"},
+	{"subcategories", "display_img"},
+}
+
+// FindImageReferences returns the records using the image as their
+// main/header/display image
+func FindImageReferences(ctx context.Context, id string) ([]*ImageReference, error) {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	return findImageReferences(ctx, conn, id)
+}
+
+// rowsQuerier is satisfied by both pool connections and transactions
+type rowsQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func findImageReferences(ctx context.Context, q rowsQuerier, id string) ([]*ImageReference, error) {
+	var queries []string
+	for _, ref := range imageRefColumns {
+		queries = append(queries, fmt.Sprintf(
+			`SELECT '%s', '%s', id::text, name FROM %s WHERE %s = $1`,
+			ref.table, ref.column, ref.table, ref.column,
+		))
+	}
+
+	rows, err := q.Query(ctx, strings.Join(queries, " UNION ALL "), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []*ImageReference{}
+	for rows.Next() {
+		var ref ImageReference
+		err = rows.Scan(&ref.Table, &ref.Column, &ref.ID, &ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, &ref)
+	}
+
+	return refs, rows.Err()
 }
 
 func FilterImages(filters ImageFilterParams) (*ImageFilterResult, error) {
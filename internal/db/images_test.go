@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLinkImageToProducts(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	productIDs := []string{createTestProduct(t, 1), createTestProduct(t, 1), createTestProduct(t, 1)}
+	imageID := createTestImage(t)
+
+	if err := LinkImageToProducts(ctx, imageID, productIDs); err != nil {
+		t.Fatal(err)
+	}
+	// Linking again skips the existing relations
+	if err := LinkImageToProducts(ctx, imageID, productIDs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, productID := range productIDs {
+		got := countTestRows(
+			t,
+			`SELECT COUNT(*) FROM images_products WHERE image_id = $1 AND product_id = $2`,
+			imageID,
+			productID,
+		)
+		if got != 1 {
+			t.Errorf("got %d relations for product %s, want 1", got, productID)
+		}
+	}
+}
+
+func TestDeleteImageUsedAsCategoryHeader(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	imageID := createTestImage(t)
+	execTestSQL(t, `UPDATE categories SET header_img = $2 WHERE id = $1`, categoryID, imageID)
+
+	refs, err := FindImageReferences(context.Background(), imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Table != "categories" || refs[0].Column != "header_img" || refs[0].ID != categoryID {
+		t.Fatalf("got references %+v, want the category header", refs)
+	}
+
+	if _, err := DeleteImage(imageID); !errors.Is(err, ErrImageInUse) {
+		t.Fatalf("expected ErrImageInUse, got %v", err)
+	}
+	if got := countTestRows(t, `SELECT COUNT(*) FROM images WHERE id = $1`, imageID); got != 1 {
+		t.Fatal("expected the image to be kept")
+	}
+
+	if _, err := DeleteImageClearingRefs(imageID); err != nil {
+		t.Fatal(err)
+	}
+	if got := countTestRows(t, `SELECT COUNT(*) FROM images WHERE id = $1`, imageID); got != 0 {
+		t.Error("expected the image to be deleted")
+	}
+	got := countTestRows(t, `SELECT COUNT(*) FROM categories WHERE id = $1 AND header_img IS NULL`, categoryID)
+	if got != 1 {
+		t.Error("expected the category header to be cleared")
+	}
+}
+
+func TestLinkImagesToProductUnlinksTheRest(t *testing.T) {
+	connectTestDB(t)
+
+	productID := createTestProduct(t, 1)
+	kept := []string{createTestImage(t), createTestImage(t)}
+	dropped := createTestImage(t)
+
+	if err := LinkImagesToProduct(append([]string{dropped}, kept...), productID); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkImagesToProduct(kept, productID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, imageID := range kept {
+		got := countTestRows(
+			t,
+			`SELECT COUNT(*) FROM images_products WHERE image_id = $1 AND product_id = $2`,
+			imageID,
+			productID,
+		)
+		if got != 1 {
+			t.Errorf("got %d relations for image %s, want 1", got, imageID)
+		}
+	}
+	got := countTestRows(t, `SELECT COUNT(*) FROM images_products WHERE image_id = $1`, dropped)
+	if got != 0 {
+		t.Errorf("got %d relations for the unlinked image, want 0", got)
+	}
+}
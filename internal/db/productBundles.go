@@ -0,0 +1,297 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ProductBundleVersion is the version of the bundle format written by
+// ExportProduct. ImportProductBundle rejects any other version
+const ProductBundleVersion = 1
+
+var (
+	ErrProductBundleVersion = errors.New("unsupported product bundle version")
+	ErrProductBundleInvalid = errors.New("invalid product bundle")
+)
+
+// ProductBundle is a portable copy of a product, used to move products
+// between environments. It references its category, subcategory and images
+// by slug and filename instead of by id, as ids differ between databases
+type ProductBundle struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+
+	Name            string  `json:"name"`
+	Slug            string  `json:"slug"`
+	Description     string  `json:"description"`
+	LongDescription string  `json:"longDescription"`
+	Price           float64 `json:"price"`
+	Unit            string  `json:"unit"`
+	Quantity        int     `json:"quantity"`
+	MinOrderQty     int     `json:"minOrderQty"`
+	Available       bool    `json:"available"`
+	Featured        bool    `json:"featured"`
+	CategorySlug    string  `json:"categorySlug"`
+	SubcategorySlug string  `json:"subcategorySlug"`
+	// MainImg is the filename of the main image, which is one of Images
+	MainImg string          `json:"mainImg"`
+	Images  []*BundledImage `json:"images"`
+}
+
+// BundledImage is an image referenced by a ProductBundle. Data holds the
+// file contents (base64 encoded in JSON) when they were embedded
+type BundledImage struct {
+	Filename   string `json:"filename"`
+	Name       string `json:"name"`
+	NoOptimize bool   `json:"noOptimize"`
+	// Size is the file size in bytes, used when Data isn't embedded
+	Size int `json:"size"`
+	// Gallery is set for images linked to the product's gallery
+	Gallery bool   `json:"gallery"`
+	Data    []byte `json:"data,omitempty"`
+}
+
+// ExportProduct returns the bundle of the product with the given id. Image
+// contents aren't embedded, only referenced by filename
+func ExportProduct(ctx context.Context, id string) (*ProductBundle, error) {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	bundle := ProductBundle{
+		Version:    ProductBundleVersion,
+		ExportedAt: time.Now(),
+		Images:     []*BundledImage{},
+	}
+	err = conn.QueryRow(
+		ctx,
+		`SELECT prod.name, prod.slug, prod.description, COALESCE(prod.long_description, ''),
+			COALESCE(prod.price, 0), COALESCE(prod.unit, ''), prod.quantity, prod.min_order_qty,
+			prod.available, prod.featured,
+			COALESCE(ctg.slug, ''), COALESCE(sc.slug, ''), COALESCE(main.filename, '')
+		FROM products prod
+			LEFT JOIN categories ctg ON ctg.id = prod.category_id
+			LEFT JOIN subcategories sc ON sc.id = prod.subcategory_id
+			LEFT JOIN images main ON main.id = prod.main_img_id
+		WHERE prod.id = $1 AND prod.deleted_at IS NULL`,
+		id,
+	).Scan(
+		&bundle.Name, &bundle.Slug, &bundle.Description, &bundle.LongDescription,
+		&bundle.Price, &bundle.Unit, &bundle.Quantity, &bundle.MinOrderQty,
+		&bundle.Available, &bundle.Featured,
+		&bundle.CategorySlug, &bundle.SubcategorySlug, &bundle.MainImg,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	// The main image is included even if it isn't part of the gallery
+	rows, err := conn.Query(
+		ctx,
+		`SELECT img.filename, img.name, img.no_optimize, img.size,
+			EXISTS (SELECT 1 FROM images_products ip WHERE ip.image_id = img.id AND ip.product_id = $1)
+		FROM images img
+		WHERE img.id IN (
+			SELECT image_id FROM images_products WHERE product_id = $1
+			UNION
+			SELECT main_img_id FROM products WHERE id = $1
+		)
+		ORDER BY img.filename`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		img := &BundledImage{}
+		err = rows.Scan(&img.Filename, &img.Name, &img.NoOptimize, &img.Size, &img.Gallery)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Images = append(bundle.Images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &bundle, nil
+}
+
+// ImportProductBundle creates a new product from a bundle made by
+// ExportProduct. The category and subcategory must already exist, images are
+// matched by filename and created if missing, so their files must be written
+// to the uploads dir beforehand. The slug is suffixed if it's already taken
+func ImportProductBundle(ctx context.Context, bundle *ProductBundle) (*Product, error) {
+	if bundle.Version != ProductBundleVersion {
+		return nil, fmt.Errorf("%w: %d", ErrProductBundleVersion, bundle.Version)
+	}
+	if bundle.Name == "" || bundle.Slug == "" {
+		return nil, fmt.Errorf("%w: name and slug are required", ErrProductBundleInvalid)
+	}
+	defer InvalidateCategoryTree()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	slug, err := uniqueSlug(ctx, tx, "products", bundle.Slug, "")
+	if err != nil {
+		return nil, err
+	}
+
+	categoryID, err := findIDBySlug(ctx, tx, "categories", bundle.CategorySlug, ErrCategoryNotFound)
+	if err != nil {
+		return nil, err
+	}
+	subcategoryID, err := findIDBySlug(ctx, tx, "subcategories", bundle.SubcategorySlug, ErrSubcategoryNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	imageIDs := make(map[string]string, len(bundle.Images))
+	for _, img := range bundle.Images {
+		var imgID string
+		err = tx.QueryRow(ctx, `SELECT id FROM images WHERE filename = $1`, img.Filename).Scan(&imgID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			size := img.Size
+			if len(img.Data) > 0 {
+				size = len(img.Data)
+			}
+			imgID = uuid.Must(uuid.NewV7()).String()
+			_, err = tx.Exec(
+				ctx,
+				`INSERT INTO images (id, filename, name, no_optimize, size) VALUES ($1, $2, $3, $4, $5)`,
+				imgID,
+				img.Filename,
+				img.Name,
+				img.NoOptimize,
+				size,
+			)
+			if err != nil {
+				return nil, errors.Join(ErrImageInsert, err)
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		imageIDs[img.Filename] = imgID
+	}
+
+	var mainImgID *string
+	if bundle.MainImg != "" {
+		id, ok := imageIDs[bundle.MainImg]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrProductMainImgInvalid, bundle.MainImg)
+		}
+		mainImgID = &id
+	}
+
+	product := &Product{
+		ID:              uuid.Must(uuid.NewV7()).String(),
+		Name:            bundle.Name,
+		Slug:            slug,
+		Description:     bundle.Description,
+		LongDescription: bundle.LongDescription,
+		Price:           bundle.Price,
+		Unit:            bundle.Unit,
+		Quantity:        bundle.Quantity,
+		MinOrderQty:     max(bundle.MinOrderQty, 1),
+		Available:       bundle.Available,
+		CategoryID:      categoryID,
+		SubcategoryID:   subcategoryID,
+		MainImg:         bundle.MainImg,
+	}
+	if mainImgID != nil {
+		product.MainImgID = *mainImgID
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO products
+		(id, name, slug, description, long_description, price, unit, quantity, min_order_qty,
+			available, featured, category_id, subcategory_id, main_img_id)
+		VALUES (@id, @name, @slug, @description, @long_description, @price, NULLIF(@unit, ''), @quantity, @min_order_qty,
+			@available, @featured, NULLIF(@category_id, '')::uuid, NULLIF(@subcategory_id, '')::uuid, @main_img_id)`,
+		pgx.NamedArgs{
+			"id":               product.ID,
+			"name":             product.Name,
+			"slug":             product.Slug,
+			"description":      product.Description,
+			"long_description": product.LongDescription,
+			"price":            product.Price,
+			"unit":             product.Unit,
+			"quantity":         product.Quantity,
+			"min_order_qty":    product.MinOrderQty,
+			"available":        product.Available,
+			"featured":         bundle.Featured,
+			"category_id":      categoryID,
+			"subcategory_id":   subcategoryID,
+			"main_img_id":      mainImgID,
+		},
+	)
+	if err != nil {
+		return nil, errors.Join(ErrProductInsert, err)
+	}
+
+	for _, img := range bundle.Images {
+		if !img.Gallery {
+			continue
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO images_products (image_id, product_id) VALUES ($1, $2)`,
+			imageIDs[img.Filename],
+			product.ID,
+		)
+		if err != nil {
+			return nil, errors.Join(ErrGalleryInsert, err)
+		}
+		product.Gallery = append(product.Gallery, img.Filename)
+		product.GalleryIDs = append(product.GalleryIDs, imageIDs[img.Filename])
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// findIDBySlug returns the id of the record of table with the given slug, or
+// an empty id if slug is empty. notFound is returned if no record matches
+func findIDBySlug(ctx context.Context, tx pgx.Tx, table, slug string, notFound error) (string, error) {
+	if slug == "" {
+		return "", nil
+	}
+
+	var id string
+	err := tx.QueryRow(ctx, fmt.Sprintf(`SELECT id FROM %s WHERE slug = $1`, table), slug).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%w: %s", notFound, slug)
+		}
+		return "", err
+	}
+
+	return id, nil
+}
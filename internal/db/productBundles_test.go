@@ -0,0 +1,44 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestProductBundleJSONRoundTrip(t *testing.T) {
+	bundle := ProductBundle{
+		Version:      ProductBundleVersion,
+		Name:         "Mesa redonda",
+		Slug:         "mesa-redonda",
+		Price:        120.5,
+		CategorySlug: "mesas",
+		MainImg:      "mesa.png",
+		Images: []*BundledImage{
+			{Filename: "mesa.png", Name: "Mesa", Gallery: true, Data: []byte{0x89, 'P', 'N', 'G'}},
+			{Filename: "mesa-2.png", Name: "Mesa 2", Size: 2048},
+		},
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ProductBundle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Slug != bundle.Slug || decoded.Price != bundle.Price || decoded.MainImg != bundle.MainImg {
+		t.Errorf("decoded bundle = %+v, want %+v", decoded, bundle)
+	}
+	if len(decoded.Images) != 2 {
+		t.Fatalf("decoded %d images, want 2", len(decoded.Images))
+	}
+	if !bytes.Equal(decoded.Images[0].Data, bundle.Images[0].Data) || !decoded.Images[0].Gallery {
+		t.Errorf("embedded image = %+v, want %+v", decoded.Images[0], bundle.Images[0])
+	}
+	if decoded.Images[1].Data != nil || decoded.Images[1].Size != 2048 {
+		t.Errorf("referenced image = %+v, want no data and its size", decoded.Images[1])
+	}
+}
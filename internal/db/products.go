@@ -3,9 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,12 +17,21 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vladwithcode/qrcatalog/internal/notify"
 	"github.com/vladwithcode/qrcatalog/internal/utils"
 )
 
 var (
-	ErrProductInsert = errors.New("failed to insert product")
-	ErrGalleryInsert = errors.New("failed to insert gallery images")
+	ErrProductInsert              = errors.New("failed to insert product")
+	ErrGalleryInsert              = errors.New("failed to insert gallery images")
+	ErrProductCategoryUnknown     = errors.New("product category doesn't exist")
+	ErrProductNotFound            = errors.New("product not found")
+	ErrProductVideoInsert         = errors.New("failed to insert product video")
+	ErrProductMainImgInvalid      = errors.New("product main image doesn't exist")
+	ErrProductWindowInvalid       = errors.New("product availability window must end after it starts")
+	ErrProductCursorInvalid       = errors.New("invalid product cursor")
+	ErrProductNameTakenInCategory = errors.New("another product of the category has the same name")
+	ErrProductCursorSort          = errors.New("sort doesn't support cursor pagination")
 )
 
 type Product struct {
@@ -30,16 +43,49 @@ type Product struct {
 	Price           float64  `db:"price" json:"price"`
 	Unit            string   `db:"unit" json:"unit"`
 	Quantity        int      `db:"quantity" json:"quantity"`
+	MinOrderQty     int      `db:"min_order_qty" json:"minOrderQty"`
 	MainImg         string   `db:"main_img" json:"mainImg"`
 	MainImgID       string   `db:"main_img_id" json:"mainImgId"`
 	Gallery         []string `db:"gallery" json:"gallery"`
 	GalleryIDs      []string `db:"gallery_ids" json:"galleryIds"`
+	Videos          []string `db:"videos" json:"videos"`
 	Category        string   `db:"category" json:"category"`
 	CategoryID      string   `db:"category_id" json:"categoryId"`
 	Subcategory     string   `db:"subcategory" json:"subcategory"`
 	SubcategoryID   string   `db:"subcategory_id" json:"subcategoryId"`
 	Available       bool     `db:"available" json:"available"`
 	QRCodeFilename  string   `db:"qrcode_filename" json:"qrcodeFilename"`
+	// AvailableFrom and AvailableUntil bound when the product is shown in the
+	// public catalog. A nil bound leaves that side of the window open
+	AvailableFrom  *time.Time `db:"available_from" json:"availableFrom,omitempty"`
+	AvailableUntil *time.Time `db:"available_until" json:"availableUntil,omitempty"`
+	// DeletedAt is set once the product is soft-deleted
+	DeletedAt *time.Time `db:"deleted_at" json:"deletedAt,omitempty"`
+}
+
+// InWindow reports whether t falls within the product's availability window
+func (p *Product) InWindow(t time.Time) bool {
+	if p.AvailableFrom != nil && t.Before(*p.AvailableFrom) {
+		return false
+	}
+	if p.AvailableUntil != nil && !t.Before(*p.AvailableUntil) {
+		return false
+	}
+	return true
+}
+
+// IsAvailableAt reports whether the product is marked as available and t
+// falls within its availability window
+func (p *Product) IsAvailableAt(t time.Time) bool {
+	return p.Available && p.InWindow(t)
+}
+
+// validateWindow checks the availability window doesn't end before it starts
+func (p *Product) validateWindow() error {
+	if p.AvailableFrom != nil && p.AvailableUntil != nil && !p.AvailableFrom.Before(*p.AvailableUntil) {
+		return ErrProductWindowInvalid
+	}
+	return nil
 }
 
 // SearchMode defines how search should behave
@@ -51,17 +97,129 @@ const (
 	SearchModeFuzzy    SearchMode = "fuzzy"    // Use LIKE matching (fallback)
 )
 
+// SearchWeights holds the ts_rank weight given to each tsvector label.
+// Products label their name as A, description as B, long description as C
+// and category name as D
+type SearchWeights struct {
+	A float32 `json:"a"`
+	B float32 `json:"b"`
+	C float32 `json:"c"`
+	D float32 `json:"d"`
+}
+
+// ProductSearchWeights is used to rank product full-text search results
+var ProductSearchWeights = SearchWeights{A: 1.0, B: 0.4, C: 0.2, D: 0.1}
+
+// Array returns the weights in the {D, C, B, A} order expected by ts_rank
+func (sw SearchWeights) Array() []float32 {
+	return []float32{sw.D, sw.C, sw.B, sw.A}
+}
+
+// ParseSearchWeights parses a comma separated "A,B,C,D" list of weights
+func ParseSearchWeights(s string) (SearchWeights, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return SearchWeights{}, fmt.Errorf("expected 4 comma separated weights, got %d", len(parts))
+	}
+
+	var weights [4]float32
+	for i, part := range parts {
+		w, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil || w < 0 || w > 1 {
+			return SearchWeights{}, fmt.Errorf("invalid weight %q: must be between 0 and 1", part)
+		}
+		weights[i] = float32(w)
+	}
+
+	return SearchWeights{A: weights[0], B: weights[1], C: weights[2], D: weights[3]}, nil
+}
+
 type ProductFilterParams struct {
 	IDs        []string   `json:"ids"`
 	Search     string     `json:"search"`
 	SearchMode SearchMode `json:"search_mode"`
 	Category   string     `json:"category"`
+	Categories []string   `json:"categories"` // Matched along with Category
 	Sort       string     `json:"sort"`
 	Page       int        `json:"page"`
 	Limit      int        `json:"limit"`
 	Available  int        `json:"available"` // -1 = unavailable, 0 = all, 1 = available
 	Quantity   int        `json:"quantity"`
+	MinPrice   float64    `json:"min_price"`    // Ignored if 0
+	MaxPrice   float64    `json:"max_price"`    // Ignored if 0
 	WithQRCode int        `json:"with_qr_code"` // -1 = unavailable, 0 = all, 1 = available
+	// KeepIDsOrder returns the products in the same order as IDs, overriding Sort
+	KeepIDsOrder bool `json:"keep_ids_order"`
+	// IncludeDeleted also returns soft-deleted products
+	IncludeDeleted bool `json:"include_deleted"`
+	// Cursor switches to keyset pagination, returning the products after the
+	// one it was generated from (see ProductFilterResult.NextCursor). Only the
+	// name sorts support it: "name_asc"/"name", "name_desc", and the default
+	// sort when not doing a full-text search. Page is ignored when it's set
+	Cursor string `json:"cursor"`
+}
+
+// NewProductFilterParamsFromRequest builds the filter params from the
+// request's query. ids and categories may be repeated, invalid ids and out of range numbers
+// are ignored and search_mode defaults to fulltext
+func NewProductFilterParamsFromRequest(r *http.Request) ProductFilterParams {
+	query := r.URL.Query()
+	params := ProductFilterParams{
+		SearchMode: SearchModeFullText,
+	}
+
+	for _, id := range query["ids"] {
+		if _, err := uuid.Parse(id); err == nil {
+			params.IDs = append(params.IDs, id)
+		}
+	}
+
+	if query.Get("search") != "" {
+		params.Search = query.Get("search")
+	}
+	switch mode := SearchMode(query.Get("search_mode")); mode {
+	case SearchModeFullText, SearchModeExact, SearchModeFuzzy:
+		params.SearchMode = mode
+	}
+
+	if query.Get("category") != "" {
+		params.Category = query.Get("category")
+	}
+	for _, id := range query["categories"] {
+		if _, err := uuid.Parse(id); err == nil {
+			params.Categories = append(params.Categories, id)
+		}
+	}
+	if query.Get("sort") != "" {
+		params.Sort = query.Get("sort")
+	}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		params.Page = page
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		params.Limit = limit
+	}
+	if available, err := strconv.Atoi(query.Get("available")); err == nil && available >= -1 && available <= 1 {
+		params.Available = available
+	}
+	if quantity, err := strconv.Atoi(query.Get("quantity")); err == nil && quantity > 0 {
+		params.Quantity = quantity
+	}
+	if minPrice, err := strconv.ParseFloat(query.Get("min_price"), 64); err == nil && minPrice > 0 {
+		params.MinPrice = minPrice
+	}
+	if maxPrice, err := strconv.ParseFloat(query.Get("max_price"), 64); err == nil && maxPrice > 0 {
+		params.MaxPrice = maxPrice
+	}
+	if query.Get("cursor") != "" {
+		params.Cursor = query.Get("cursor")
+	}
+	if withQR, err := strconv.Atoi(query.Get("with_qr_code")); err == nil && withQR >= -1 && withQR <= 1 {
+		params.WithQRCode = withQR
+	}
+
+	return params
 }
 
 type ProductFilterResult struct {
@@ -74,9 +232,16 @@ type ProductFilterResult struct {
 	HasPrevious bool       `json:"has_previous"`
 	HasError    bool       `json:"has_error"`
 	Error       string     `json:"error"`
+	// NextCursor fetches the next page through ProductFilterParams.Cursor. It's
+	// only set if there's a next page and the sort supports cursors
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 func CreateProduct(product *Product) error {
+	if err := product.validateWindow(); err != nil {
+		return err
+	}
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -95,6 +260,9 @@ func CreateProduct(product *Product) error {
 		return ErrUUIDFail
 	}
 	product.ID = id.String()
+	if product.MinOrderQty < 1 {
+		product.MinOrderQty = 1
+	}
 	mainImg := uuid.NullUUID{}
 	if product.MainImg != "" {
 		id, err := uuid.Parse(product.MainImg)
@@ -112,13 +280,23 @@ func CreateProduct(product *Product) error {
 		"category":         product.CategoryID,
 		"available":        product.Available,
 		"quantity":         product.Quantity,
+		"min_order_qty":    product.MinOrderQty,
 		"qrcode_filename":  product.QRCodeFilename,
+		"available_from":   product.AvailableFrom,
+		"available_until":  product.AvailableUntil,
 	}
+	err = checkProductNameInCategory(ctx, tx, product)
+	if err != nil {
+		return err
+	}
+
 	_, err = tx.Exec(
 		ctx,
 		`INSERT INTO products 
-		(id, name, slug, description, long_description, main_img_id, category_id, available, quantity, qrcode_filename)
-		VALUES (@id, @name, @slug, @description, @long_description, @main_img_id, @category, @available, @quantity, @qrcode_filename)`,
+		(id, name, slug, description, long_description, main_img_id, category_id, available, quantity, min_order_qty, qrcode_filename,
+			available_from, available_until)
+		VALUES (@id, @name, @slug, @description, @long_description, @main_img_id, @category, @available, @quantity, @min_order_qty, @qrcode_filename,
+			@available_from, @available_until)`,
 		args,
 	)
 	if err != nil {
@@ -137,8 +315,7 @@ func CreateProduct(product *Product) error {
 		}
 	}
 
-	tx.Commit(ctx)
-	return nil
+	return tx.Commit(ctx)
 }
 
 func FindProductBySlug(slug string) (*Product, error) {
@@ -162,19 +339,26 @@ func FindProductBySlug(slug string) (*Product, error) {
 			prod.id, prod.name, prod.slug, prod.description, prod.long_description,
 			ctg.name AS category,
 			ctg.id AS category_id,
+			COALESCE(sc.name, '') AS subcategory,
+			COALESCE(sc.id::text, '') AS subcategory_id,
 			main.filename AS main_img,
 			main.id AS main_img_id,
-			prod.available, prod.quantity,
-			prod.qrcode_filename,
-			ARRAY_AGG(img.filename) AS gallery,
-			ARRAY_AGG(img.id) AS gallery_ids
+			prod.available, prod.quantity, prod.min_order_qty,
+			prod.qrcode_filename, prod.available_from, prod.available_until,
+			ARRAY_AGG(img.filename ORDER BY img.filename, img.id) AS gallery,
+			ARRAY_AGG(img.id ORDER BY img.filename, img.id) AS gallery_ids,
+			COALESCE((
+				SELECT ARRAY_AGG(pv.filename ORDER BY pv.created_at)
+				FROM product_videos pv WHERE pv.product_id = prod.id
+			), '{}') AS videos
 		FROM products prod 
 			LEFT JOIN images_products img_prod ON prod.id = img_prod.product_id
 			LEFT JOIN images img ON img_prod.image_id = img.id
 			LEFT JOIN images main ON main.id = prod.main_img_id
 			LEFT JOIN categories ctg ON ctg.id = prod.category_id
-		WHERE prod.slug = $1
-		GROUP BY prod.id, prod.name, prod.slug, prod.description, prod.long_description, prod.available, prod.quantity, main.filename, main.id, ctg.name, ctg.id, prod.qrcode_filename`,
+			LEFT JOIN subcategories sc ON sc.id = prod.subcategory_id
+		WHERE prod.slug = $1 AND prod.deleted_at IS NULL
+		GROUP BY prod.id, prod.name, prod.slug, prod.description, prod.long_description, prod.available, prod.quantity, prod.min_order_qty, main.filename, main.id, ctg.name, ctg.id, sc.name, sc.id, prod.qrcode_filename, prod.available_from, prod.available_until`,
 		slug,
 	).Scan(
 		&product.ID,
@@ -184,13 +368,19 @@ func FindProductBySlug(slug string) (*Product, error) {
 		&longDescription,
 		&product.Category,
 		&product.CategoryID,
+		&product.Subcategory,
+		&product.SubcategoryID,
 		&mainImg,
 		&mainImgID,
 		&product.Available,
 		&product.Quantity,
+		&product.MinOrderQty,
 		&product.QRCodeFilename,
+		&product.AvailableFrom,
+		&product.AvailableUntil,
 		&gallery,
 		&galleryIDs,
+		&product.Videos,
 	)
 	if err != nil {
 		return nil, err
@@ -246,19 +436,26 @@ func FindProductByID(id string) (*Product, error) {
 			prod.id, prod.name, prod.slug, prod.description, prod.long_description,
 			ctg.name AS category,
 			ctg.id AS category_id,
+			COALESCE(sc.name, '') AS subcategory,
+			COALESCE(sc.id::text, '') AS subcategory_id,
 			main.filename AS main_img,
 			main.id AS main_img_id,
-			prod.available, prod.quantity,
-			prod.qrcode_filename,
-			ARRAY_AGG(img.filename) AS gallery,
-			ARRAY_AGG(img.id) AS gallery_ids
+			prod.available, prod.quantity, prod.min_order_qty,
+			prod.qrcode_filename, prod.available_from, prod.available_until,
+			ARRAY_AGG(img.filename ORDER BY img.filename, img.id) AS gallery,
+			ARRAY_AGG(img.id ORDER BY img.filename, img.id) AS gallery_ids,
+			COALESCE((
+				SELECT ARRAY_AGG(pv.filename ORDER BY pv.created_at)
+				FROM product_videos pv WHERE pv.product_id = prod.id
+			), '{}') AS videos
 		FROM products prod
 			LEFT JOIN images_products img_prod ON prod.id = img_prod.product_id
 			LEFT JOIN images img ON img_prod.image_id = img.id
 			LEFT JOIN images main ON main.id = prod.main_img_id
 			LEFT JOIN categories ctg ON ctg.id = prod.category_id
-		WHERE prod.id = $1
-		GROUP BY prod.id, prod.name, prod.slug, prod.description, prod.long_description, prod.available, prod.quantity, main.filename, main.id, ctg.name, ctg.id, prod.qrcode_filename`,
+			LEFT JOIN subcategories sc ON sc.id = prod.subcategory_id
+		WHERE prod.id = $1 AND prod.deleted_at IS NULL
+		GROUP BY prod.id, prod.name, prod.slug, prod.description, prod.long_description, prod.available, prod.quantity, prod.min_order_qty, main.filename, main.id, ctg.name, ctg.id, sc.name, sc.id, prod.qrcode_filename, prod.available_from, prod.available_until`,
 		id,
 	).Scan(
 		&product.ID,
@@ -268,13 +465,19 @@ func FindProductByID(id string) (*Product, error) {
 		&longDescription,
 		&product.Category,
 		&product.CategoryID,
+		&product.Subcategory,
+		&product.SubcategoryID,
 		&mainImg,
 		&mainImgID,
 		&product.Available,
 		&product.Quantity,
+		&product.MinOrderQty,
 		&product.QRCodeFilename,
+		&product.AvailableFrom,
+		&product.AvailableUntil,
 		&gallery,
 		&galleryIDs,
+		&product.Videos,
 	)
 	if err != nil {
 		return nil, err
@@ -321,26 +524,77 @@ func FindAllProducts() ([]*Product, error) {
 		ctx,
 		`SELECT 
 			prod.id, prod.name, prod.slug, prod.description, prod.long_description,
-			ctg.name AS category,
-			ctg.id AS category_id,
-			img.filename AS main_img
+			COALESCE(ctg.name, '') AS category,
+			COALESCE(ctg.id::text, '') AS category_id,
+			img.filename AS main_img,
 			prod.available, prod.quantity,
 			prod.qrcode_filename
 		FROM products prod
 			LEFT JOIN images img ON img.id = prod.main_img_id
-			LEFT JOIN categories ctg ON ctg.id = prod.category_id`,
+			LEFT JOIN categories ctg ON ctg.id = prod.category_id
+		WHERE prod.deleted_at IS NULL`,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanListedProducts(rows)
+}
+
+// FindProductsByIDs returns the products with the given ids in the same
+// order as ids. Missing, deleted or invalid ids are skipped
+func FindProductsByIDs(ids []string) ([]*Product, error) {
+	validIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err == nil {
+			validIDs = append(validIDs, id)
+		}
+	}
+	if len(validIDs) == 0 {
+		return []*Product{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT 
+			prod.id, prod.name, prod.slug, prod.description, prod.long_description,
+			COALESCE(ctg.name, '') AS category,
+			COALESCE(ctg.id::text, '') AS category_id,
+			img.filename AS main_img,
+			prod.available, prod.quantity,
+			prod.qrcode_filename
+		FROM products prod
+			LEFT JOIN images img ON img.id = prod.main_img_id
+			LEFT JOIN categories ctg ON ctg.id = prod.category_id
+		WHERE prod.id = ANY(@ids::uuid[]) AND prod.deleted_at IS NULL
+		ORDER BY array_position(@ids::uuid[], prod.id)`,
+		pgx.NamedArgs{"ids": validIDs},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanListedProducts(rows)
+}
+
+// scanListedProducts scans the rows of FindAllProducts and FindProductsByIDs
+func scanListedProducts(rows pgx.Rows) ([]*Product, error) {
 	var products []*Product
 	for rows.Next() {
 		var product Product
 		var mainImg sql.NullString
 		var longDescription sql.NullString
-		err = rows.Scan(
+		err := rows.Scan(
 			&product.ID,
 			&product.Name,
 			&product.Slug,
@@ -366,11 +620,18 @@ func FindAllProducts() ([]*Product, error) {
 		}
 		products = append(products, &product)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return products, nil
 }
 
 func UpdateProduct(product *Product) error {
+	if err := product.validateWindow(); err != nil {
+		return err
+	}
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -379,13 +640,15 @@ func UpdateProduct(product *Product) error {
 	}
 	defer conn.Release()
 
-	mainImg := sql.NullString{
-		String: product.MainImg,
-		Valid:  product.MainImg != "",
+	mainImg, err := resolveMainImgID(ctx, conn, product)
+	if err != nil {
+		return err
 	}
-	if _, err := uuid.Parse(product.MainImg); err != nil {
-		mainImg.String = product.MainImgID
-		mainImg.Valid = product.MainImgID != ""
+	product.MainImgID = mainImg.String
+
+	err = checkProductNameInCategory(ctx, conn, product)
+	if err != nil {
+		return err
 	}
 
 	args := pgx.NamedArgs{
@@ -398,26 +661,106 @@ func UpdateProduct(product *Product) error {
 		"main_img_id":      mainImg,
 		"available":        product.Available,
 		"quantity":         product.Quantity,
+		"min_order_qty":    max(product.MinOrderQty, 1),
 		"qrcode_filename":  product.QRCodeFilename,
+		"available_from":   product.AvailableFrom,
+		"available_until":  product.AvailableUntil,
 	}
-	_, err = conn.Exec(
+	var prevQty int
+	err = conn.QueryRow(
 		ctx,
-		`UPDATE products SET
+		`UPDATE products AS p SET
 			name = @name, slug = @slug, description = @description,
 			long_description = @long_description, category_id = @category,
-			main_img = @main_img_id, available = @available, quantity = @quantity,
-			qrcode_filename = @qrcode_filename
-		WHERE id = @id`,
+			main_img_id = @main_img_id, available = @available, quantity = @quantity,
+			min_order_qty = @min_order_qty, qrcode_filename = @qrcode_filename,
+			available_from = @available_from, available_until = @available_until
+		FROM (SELECT id, quantity FROM products WHERE id = @id FOR UPDATE) AS prev
+		WHERE p.id = prev.id
+		RETURNING prev.quantity`,
 		args,
-	)
+	).Scan(&prevQty)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrProductNotFound
+		}
 		return err
 	}
 
+	emitSoldOut(product.ID, prevQty, product.Quantity)
+
 	return nil
 }
 
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// checkProductNameInCategory returns ErrProductNameTakenInCategory if
+// UniqueProductNamesPerCategory is set and another product of the product's
+// category has its name
+func checkProductNameInCategory(ctx context.Context, q rowQuerier, product *Product) error {
+	if !UniqueProductNamesPerCategory || product.CategoryID == "" {
+		return nil
+	}
+
+	var taken bool
+	err := q.QueryRow(
+		ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM products
+			WHERE category_id = $1 AND LOWER(name) = LOWER($2) AND id != $3 AND deleted_at IS NULL
+		)`,
+		product.CategoryID,
+		strings.TrimSpace(product.Name),
+		product.ID,
+	).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%w: %q", ErrProductNameTakenInCategory, product.Name)
+	}
+
+	return nil
+}
+
+// resolveMainImgID returns the image id to store as the product's main image.
+// MainImg takes precedence when it holds an image id, otherwise MainImgID is
+// used, and as a last resort MainImg is looked up as an image filename (which
+// is what the finders fill it with)
+func resolveMainImgID(ctx context.Context, conn *pgxpool.Conn, product *Product) (sql.NullString, error) {
+	if _, err := uuid.Parse(product.MainImg); err == nil {
+		return sql.NullString{String: product.MainImg, Valid: true}, nil
+	}
+	if product.MainImgID != "" {
+		if _, err := uuid.Parse(product.MainImgID); err != nil {
+			return sql.NullString{}, fmt.Errorf("%w: %q", ErrProductMainImgInvalid, product.MainImgID)
+		}
+		return sql.NullString{String: product.MainImgID, Valid: true}, nil
+	}
+	if product.MainImg == "" || product.MainImg == DefaultProductImage {
+		return sql.NullString{}, nil
+	}
+
+	var imgID string
+	err := conn.QueryRow(
+		ctx,
+		`SELECT id FROM images WHERE filename = $1 LIMIT 1`,
+		product.MainImg,
+	).Scan(&imgID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.NullString{}, fmt.Errorf("%w: %q", ErrProductMainImgInvalid, product.MainImg)
+		}
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: imgID, Valid: true}, nil
+}
+
 func UpdateProductBatch(products []*Product) error {
+	defer InvalidateCategoryTree()
 	conn, err := GetConn()
 	if err != nil {
 		return err
@@ -445,10 +788,12 @@ func UpdateProductBatch(products []*Product) error {
 			"id":               product.ID,
 		}
 		batch.Queue(
-			`UPDATE products SET
+			`UPDATE products AS p SET
 				name = @name, slug = @slug, description = @description, long_description = @long_description,
 				category_id = @category, available = @available, quantity = @quantity, qrcode_filename = @qrcode_filename
-			WHERE id = @id`,
+			FROM (SELECT id, quantity FROM products WHERE id = @id FOR UPDATE) AS prev
+			WHERE p.id = prev.id
+			RETURNING prev.quantity`,
 			args,
 		)
 	}
@@ -456,13 +801,47 @@ func UpdateProductBatch(products []*Product) error {
 	results := tx.SendBatch(ctx, &batch)
 	defer results.Close()
 
-	_, err = results.Exec()
+	// Unknown ids match no row and are skipped, as they were before the
+	// previous quantity was returned
+	prevQtys := make([]int, len(products))
+	found := make([]bool, len(products))
+	for i := range products {
+		err = results.QueryRow().Scan(&prevQtys[i])
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found[i] = true
+	}
+
+	results.Close()
+	err = tx.Commit(ctx)
 	if err != nil {
 		return err
 	}
 
-	results.Close()
-	return tx.Commit(ctx)
+	for i, product := range products {
+		if found[i] {
+			emitSoldOut(product.ID, prevQtys[i], product.Quantity)
+		}
+	}
+
+	return nil
+}
+
+// emitSoldOut notifies a sold out product only when its quantity
+// transitions to zero, so repeated zero writes don't re-fire the event
+func emitSoldOut(productID string, prevQty, newQty int) {
+	if prevQty <= 0 || newQty > 0 {
+		return
+	}
+
+	notify.Emit(notify.EventProductSoldOut, map[string]any{
+		"product_id":    productID,
+		"last_quantity": prevQty,
+	})
 }
 
 func UpdateProductImages(productId string, imageIds []string) error {
@@ -498,7 +877,51 @@ func UpdateProductImages(productId string, imageIds []string) error {
 	return tx.Commit(ctx)
 }
 
+// LinkVideoToProduct registers an uploaded video file as part of the product
+func LinkVideoToProduct(ctx context.Context, productID, filename string, size int64) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(
+		ctx,
+		`INSERT INTO product_videos (product_id, filename, size) VALUES ($1, $2, $3)
+		ON CONFLICT (product_id, filename) DO NOTHING`,
+		productID,
+		filename,
+		size,
+	)
+	if err != nil {
+		return errors.Join(ErrProductVideoInsert, err)
+	}
+
+	return nil
+}
+
+// UnlinkVideoFromProduct removes the video from the product. The file itself
+// must be removed by the caller
+func UnlinkVideoFromProduct(ctx context.Context, productID, filename string) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(
+		ctx,
+		`DELETE FROM product_videos WHERE product_id = $1 AND filename = $2`,
+		productID,
+		filename,
+	)
+	return err
+}
+
+// DeleteProduct soft-deletes the product, hiding it from every listing until
+// it's restored with RestoreProduct. Use PurgeProduct to remove it for good
 func DeleteProduct(id string) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -507,7 +930,110 @@ func DeleteProduct(id string) error {
 	}
 	defer conn.Release()
 
-	_, err = conn.Exec(
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE products SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// IncrementProductView adds one to the view count of the product, used to
+// sort listings by popularity. Deleted products aren't counted
+func IncrementProductView(ctx context.Context, productID string) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE products SET view_count = view_count + 1 WHERE id = $1 AND deleted_at IS NULL`,
+		productID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// SetProductFeatured marks or unmarks the product as featured, which puts it
+// first in the featured selection and the listings that prefer featured ones
+func SetProductFeatured(id string, featured bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE products SET featured = $2 WHERE id = $1 AND deleted_at IS NULL`,
+		id,
+		featured,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// RestoreProduct undoes a soft delete
+func RestoreProduct(id string) error {
+	defer InvalidateCategoryTree()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE products SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// PurgeProduct permanently deletes the product, whether it was soft-deleted or not
+func PurgeProduct(id string) error {
+	defer InvalidateCategoryTree()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
 		ctx,
 		`DELETE FROM products WHERE id = $1`,
 		id,
@@ -515,6 +1041,9 @@ func DeleteProduct(id string) error {
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
 
 	return nil
 }
@@ -540,17 +1069,30 @@ func FilterProducts(filters ProductFilterParams) (*ProductFilterResult, error) {
 		filters.SearchMode = SearchModeFullText
 	}
 
+	cursorOp, cursorErr := productCursorOperator(filters)
+	var cursor *productCursor
+	if filters.Cursor != "" {
+		if cursorErr != nil {
+			return nil, cursorErr
+		}
+		cursor, err = decodeProductCursor(filters.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Build query conditions and named arguments
 	conditions, namedArgs := buildQueryConditions(filters)
 
 	// Base query with explicit column selection
-	baseQuery := `
+	fromClause := `
 		FROM products prod
 		LEFT JOIN categories ctg ON prod.category_id = ctg.id
 		LEFT JOIN images_products imgs_prod ON imgs_prod.product_id = prod.id
 		LEFT JOIN images imgs ON imgs_prod.image_id = imgs.id
 		LEFT JOIN images img ON prod.main_img_id = img.id
 		`
+	baseQuery := fromClause
 	if len(conditions) > 0 {
 		baseQuery += " WHERE " + strings.Join(conditions, " AND ")
 	}
@@ -571,16 +1113,28 @@ func FilterProducts(filters ProductFilterParams) (*ProductFilterResult, error) {
 	namedArgs["limit"] = filters.Limit
 	namedArgs["offset"] = offset
 
+	// In cursor mode the total still counts every match, but the page starts
+	// after the cursor. One extra row is fetched to know if there's a next page
+	if cursor != nil {
+		cursorConditions := append(conditions, fmt.Sprintf("(prod.name, prod.id) %s (@cursor_name, @cursor_id::uuid)", cursorOp))
+		baseQuery = fromClause + " WHERE " + strings.Join(cursorConditions, " AND ")
+		namedArgs["cursor_name"] = cursor.Name
+		namedArgs["cursor_id"] = cursor.ID
+		namedArgs["limit"] = filters.Limit + 1
+		namedArgs["offset"] = 0
+	}
+
 	// Build final query with sorting and pagination
 	orderBy := buildProductsOrderByClause(filters)
 	selectQuery := fmt.Sprintf(`
 		SELECT 
 			prod.id, prod.name, prod.description, prod.long_description, ctg.id as category_id, ctg.name as category,
 			img.filename as main_img, prod.available, prod.quantity, prod.qrcode_filename, prod.slug,
-			COALESCE(ARRAY_AGG(imgs.filename) FILTER (WHERE imgs.filename IS NOT NULL), '{}') as images,
+			COALESCE(ARRAY_AGG(imgs.filename ORDER BY imgs.filename) FILTER (WHERE imgs.filename IS NOT NULL), '{}') as images,
+			prod.deleted_at, COALESCE(prod.price, 0) as price,
 			%s
 		%s GROUP BY prod.id, prod.name, prod.description, prod.long_description,
-		ctg.id, ctg.name, img.filename, prod.available, prod.quantity, prod.qrcode_filename, prod.slug %s
+		ctg.id, ctg.name, img.filename, prod.available, prod.quantity, prod.qrcode_filename, prod.slug, prod.deleted_at, prod.price %s
 		LIMIT @limit OFFSET @offset`,
 		buildSearchRankSelect(filters), baseQuery, orderBy)
 
@@ -607,17 +1161,83 @@ func FilterProducts(filters ProductFilterParams) (*ProductFilterResult, error) {
 		HasNext:     filters.Page < totalPages,
 		HasPrevious: filters.Page > 1,
 	}
+	if cursor != nil {
+		result.HasNext = len(products) > filters.Limit
+		result.HasPrevious = true
+		if result.HasNext {
+			result.Products = products[:filters.Limit]
+		}
+	}
+	if result.HasNext && cursorErr == nil && len(result.Products) > 0 {
+		result.NextCursor = encodeProductCursor(result.Products[len(result.Products)-1])
+	}
 
 	return result, nil
 }
 
+// productCursor is the position a cursor paginated listing continues from
+type productCursor struct {
+	Name string `json:"n"`
+	ID   string `json:"id"`
+}
+
+func encodeProductCursor(p *Product) string {
+	data, _ := json.Marshal(productCursor{Name: p.Name, ID: p.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeProductCursor(s string) (*productCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Join(ErrProductCursorInvalid, err)
+	}
+
+	var cursor productCursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return nil, errors.Join(ErrProductCursorInvalid, err)
+	}
+	if _, err := uuid.Parse(cursor.ID); err != nil {
+		return nil, errors.Join(ErrProductCursorInvalid, err)
+	}
+
+	return &cursor, nil
+}
+
+// productCursorOperator returns the comparison a cursor condition must use
+// for the filters' sort, or ErrProductCursorSort if it can't be cursored
+func productCursorOperator(filters ProductFilterParams) (string, error) {
+	if filters.KeepIDsOrder && len(filters.IDs) > 0 {
+		return "", fmt.Errorf("%w: ids order", ErrProductCursorSort)
+	}
+
+	sort := strings.ToLower(filters.Sort)
+	switch sort {
+	case "name_asc", "name":
+		return ">", nil
+	case "name_desc":
+		return "<", nil
+	case "":
+		if filters.Search == "" || filters.SearchMode != SearchModeFullText {
+			return ">", nil
+		}
+		return "", fmt.Errorf("%w: relevance", ErrProductCursorSort)
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrProductCursorSort, sort)
+}
+
 // buildQueryConditions creates WHERE conditions and named arguments
 func buildQueryConditions(filters ProductFilterParams) ([]string, pgx.NamedArgs) {
 	var conditions []string
 	namedArgs := make(pgx.NamedArgs)
 
+	if !filters.IncludeDeleted {
+		conditions = append(conditions, "prod.deleted_at IS NULL")
+	}
+
 	if len(filters.IDs) > 0 {
-		conditions = append(conditions, "id = ANY(@ids)")
+		conditions = append(conditions, "prod.id = ANY(@ids::uuid[])")
 		namedArgs["ids"] = filters.IDs
 	}
 
@@ -628,6 +1248,7 @@ func buildQueryConditions(filters ProductFilterParams) ([]string, pgx.NamedArgs)
 			// Full-text search with ranking
 			conditions = append(conditions, "prod.search_vector @@ plainto_tsquery('spanish', @search_query)")
 			namedArgs["search_query"] = filters.Search
+			namedArgs["search_weights"] = ProductSearchWeights.Array()
 
 		case SearchModeExact:
 			// Exact match search
@@ -641,8 +1262,15 @@ func buildQueryConditions(filters ProductFilterParams) ([]string, pgx.NamedArgs)
 		}
 	}
 
-	// Add category filter
-	if filters.Category != "" {
+	// Add category filter. Category and Categories are OR'ed together
+	if len(filters.Categories) > 0 {
+		categories := filters.Categories
+		if filters.Category != "" {
+			categories = append([]string{filters.Category}, categories...)
+		}
+		conditions = append(conditions, "prod.category_id = ANY(@categories::uuid[])")
+		namedArgs["categories"] = categories
+	} else if filters.Category != "" {
 		conditions = append(conditions, "category_id = @category_id")
 		namedArgs["category_id"] = filters.Category
 	}
@@ -658,10 +1286,19 @@ func buildQueryConditions(filters ProductFilterParams) ([]string, pgx.NamedArgs)
 		namedArgs["quantity"] = filters.Quantity
 	}
 
+	if filters.MinPrice > 0 {
+		conditions = append(conditions, "prod.price >= @min_price")
+		namedArgs["min_price"] = filters.MinPrice
+	}
+	if filters.MaxPrice > 0 {
+		conditions = append(conditions, "prod.price <= @max_price")
+		namedArgs["max_price"] = filters.MaxPrice
+	}
+
 	if filters.WithQRCode > 0 {
-		conditions = append(conditions, "qr_code_filename IS NOT NULL AND qr_code_filename != ''")
+		conditions = append(conditions, "prod.qrcode_filename IS NOT NULL AND prod.qrcode_filename != ''")
 	} else if filters.WithQRCode < 0 {
-		conditions = append(conditions, "qr_code_filename IS NULL OR qr_code_filename = ''")
+		conditions = append(conditions, "(prod.qrcode_filename IS NULL OR prod.qrcode_filename = '')")
 	}
 
 	return conditions, namedArgs
@@ -670,26 +1307,32 @@ func buildQueryConditions(filters ProductFilterParams) ([]string, pgx.NamedArgs)
 // buildSearchRankSelect adds search ranking column when using full-text search
 func buildSearchRankSelect(filters ProductFilterParams) string {
 	if filters.Search != "" && filters.SearchMode == SearchModeFullText {
-		return "ts_rank(prod.search_vector, plainto_tsquery('spanish', @search_query)) as search_rank"
+		return "ts_rank(@search_weights::real[], prod.search_vector, plainto_tsquery('spanish', @search_query)) as search_rank"
 	}
 	return "0 as search_rank"
 }
 
 // buildProductsOrderByClause constructs the ORDER BY clause
 func buildProductsOrderByClause(filters ProductFilterParams) string {
+	if filters.KeepIDsOrder && len(filters.IDs) > 0 {
+		return "ORDER BY array_position(@ids::uuid[], prod.id)"
+	}
+
 	// If using full-text search with a query, prioritize search ranking
 	if filters.Search != "" && filters.SearchMode == SearchModeFullText {
 		switch strings.ToLower(filters.Sort) {
 		case "relevance", "":
 			return "ORDER BY search_rank DESC, name ASC"
 		case "name_asc", "name":
-			return "ORDER BY name ASC"
+			return "ORDER BY name ASC, id ASC"
 		case "name_desc":
-			return "ORDER BY name DESC"
+			return "ORDER BY name DESC, id DESC"
 		case "price_asc":
-			return "ORDER BY price ASC, search_rank DESC"
+			return "ORDER BY price ASC, search_rank DESC, name ASC"
 		case "price_desc":
-			return "ORDER BY price DESC, search_rank DESC"
+			return "ORDER BY price DESC, search_rank DESC, name ASC"
+		case "views_desc":
+			return "ORDER BY prod.view_count DESC, search_rank DESC, name ASC"
 		default:
 			return "ORDER BY search_rank DESC, name ASC"
 		}
@@ -698,19 +1341,21 @@ func buildProductsOrderByClause(filters ProductFilterParams) string {
 	// Regular sorting without search ranking
 	switch strings.ToLower(filters.Sort) {
 	case "name_asc", "name", "":
-		return "ORDER BY name ASC"
+		return "ORDER BY name ASC, id ASC"
 	case "name_desc":
-		return "ORDER BY name DESC"
+		return "ORDER BY name DESC, id DESC"
 	case "price_asc":
-		return "ORDER BY price ASC"
+		return "ORDER BY price ASC, name ASC"
 	case "price_desc":
-		return "ORDER BY price DESC"
+		return "ORDER BY price DESC, name ASC"
 	case "newest":
 		return "ORDER BY id DESC"
 	case "oldest":
 		return "ORDER BY id ASC"
 	case "category":
 		return "ORDER BY category ASC, name ASC"
+	case "views_desc":
+		return "ORDER BY prod.view_count DESC, name ASC"
 	default:
 		return "ORDER BY name ASC"
 	}
@@ -741,6 +1386,8 @@ func scanProducts(rows pgx.Rows, includeRank bool) ([]*Product, error) {
 				&product.QRCodeFilename,
 				&product.Slug,
 				&images,
+				&product.DeletedAt,
+				&product.Price,
 				&searchRank,
 			)
 			if err != nil {
@@ -751,6 +1398,7 @@ func scanProducts(rows pgx.Rows, includeRank bool) ([]*Product, error) {
 				&product.ID,
 				&product.Name,
 				&product.Description,
+				&longDescription,
 				&product.CategoryID,
 				&product.Category,
 				&mainImg,
@@ -759,6 +1407,8 @@ func scanProducts(rows pgx.Rows, includeRank bool) ([]*Product, error) {
 				&product.QRCodeFilename,
 				&product.Slug,
 				&images,
+				&product.DeletedAt,
+				&product.Price,
 				&searchRank, // Still need to scan the rank column (will be 0)
 			)
 			if err != nil {
@@ -766,8 +1416,10 @@ func scanProducts(rows pgx.Rows, includeRank bool) ([]*Product, error) {
 			}
 		}
 
-		if mainImg.Valid {
+		if mainImg.Valid && mainImg.String != "" {
 			product.MainImg = mainImg.String
+		} else {
+			product.MainImg = DefaultProductImage
 		}
 		if len(images) > 0 {
 			product.Gallery = images
@@ -788,7 +1440,11 @@ func scanProducts(rows pgx.Rows, includeRank bool) ([]*Product, error) {
 	return products, nil
 }
 
-func SCreateProducts(product []*Product) error {
+// SCreateProducts inserts the products in a single transaction, resolving
+// their category by name. Unknown categories fail with ErrProductCategoryUnknown
+// unless createMissingCategories is set, in which case they're created
+func SCreateProducts(product []*Product, createMissingCategories bool) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -801,7 +1457,7 @@ func SCreateProducts(product []*Product) error {
 		return err
 	}
 	defer tx.Rollback(ctx)
-	ctgs, err := FindAllCategories()
+	ctgs, err := FindAllCategories(false)
 	if err != nil {
 		return err
 	}
@@ -811,6 +1467,28 @@ func SCreateProducts(product []*Product) error {
 	}
 
 	for _, prod := range product {
+		if _, ok := ctgMap[prod.Category]; !ok {
+			if !createMissingCategories || strings.TrimSpace(prod.Category) == "" {
+				return fmt.Errorf("%w: product %q has category %q", ErrProductCategoryUnknown, prod.Name, prod.Category)
+			}
+
+			ctgID, err := uuid.NewV7()
+			if err != nil {
+				return ErrUUIDFail
+			}
+			_, err = tx.Exec(
+				ctx,
+				`INSERT INTO categories (id, name, slug, description) VALUES ($1, $2, $3, '')`,
+				ctgID.String(),
+				prod.Category,
+				utils.Slugify(prod.Category),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create category %q: %w", prod.Category, err)
+			}
+			ctgMap[prod.Category] = ctgID.String()
+		}
+
 		id, err := uuid.NewV7()
 		if err != nil {
 			return ErrUUIDFail
@@ -861,8 +1539,7 @@ func SCreateProducts(product []*Product) error {
 		}
 	}
 
-	tx.Commit(ctx)
-	return nil
+	return tx.Commit(ctx)
 }
 
 func setProdMainImg(prod *Product, conn *pgxpool.Conn) {
@@ -877,3 +1554,239 @@ func setProdMainImg(prod *Product, conn *pgxpool.Conn) {
 		prod.MainImg = imgID.String
 	}
 }
+
+// UpdateProductQRCode stores the filename of the product's generated qr
+func UpdateProductQRCode(ctx context.Context, id, filename string) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE products SET qrcode_filename = $1 WHERE id = $2`,
+		filename,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// FindCategoryProductSlugs returns the id, name and slug of every product in
+// the category
+func FindCategoryProductSlugs(ctx context.Context, categoryID string) ([]*Product, error) {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT id, name, COALESCE(slug, '') FROM products WHERE category_id = $1 AND deleted_at IS NULL ORDER BY name ASC`,
+		categoryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+	for rows.Next() {
+		var product Product
+		err := rows.Scan(&product.ID, &product.Name, &product.Slug)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, &product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// GetStockLevels returns the quantity that can currently be ordered of each
+// of the given products, keyed by id. Products that aren't available or are
+// outside their availability window report 0, unknown or deleted ones are
+// left out of the map
+func GetStockLevels(ctx context.Context, productIDs []string) (map[string]int, error) {
+	levels := make(map[string]int, len(productIDs))
+
+	ids := make([]string, 0, len(productIDs))
+	for _, id := range productIDs {
+		if _, err := uuid.Parse(id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return levels, nil
+	}
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT id::text,
+			CASE WHEN available AND product_in_window(available_from, available_until)
+				THEN GREATEST(quantity, 0) ELSE 0 END
+		FROM products
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id  string
+			qty int
+		)
+		if err := rows.Scan(&id, &qty); err != nil {
+			return nil, err
+		}
+		levels[id] = qty
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return levels, nil
+}
+
+// ReassignProductsCategory moves the given products to the category with id
+// newCategoryID in a single statement, returning how many were updated.
+// Subcategories that don't belong to the new category are cleared
+func ReassignProductsCategory(ctx context.Context, productIDs []string, newCategoryID string) (int, error) {
+	if _, err := uuid.Parse(newCategoryID); err != nil {
+		return 0, ErrCategoryNotFound
+	}
+	ids := make([]string, 0, len(productIDs))
+	for _, id := range productIDs {
+		if _, err := uuid.Parse(id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	defer InvalidateCategoryTree()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)`, newCategoryID).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrCategoryNotFound
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE products p SET
+			category_id = @category_id,
+			subcategory_id = CASE
+				WHEN EXISTS (SELECT 1 FROM subcategories sc WHERE sc.id = p.subcategory_id AND sc.category_id = @category_id)
+				THEN p.subcategory_id
+				ELSE NULL
+			END
+		WHERE p.id = ANY(@ids::uuid[]) AND p.deleted_at IS NULL`,
+		pgx.NamedArgs{
+			"category_id": newCategoryID,
+			"ids":         ids,
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// FindUncategorizedProducts returns the products whose category is null or
+// points to a category that no longer exists
+func FindUncategorizedProducts(ctx context.Context) ([]*Product, error) {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT
+			prod.id, prod.name, COALESCE(prod.slug, ''), prod.description,
+			COALESCE(prod.category_id::text, ''),
+			COALESCE(img.filename, ''),
+			prod.available, prod.quantity
+		FROM products prod
+			LEFT JOIN categories ctg ON ctg.id = prod.category_id
+			LEFT JOIN images img ON img.id = prod.main_img_id
+		WHERE ctg.id IS NULL AND prod.deleted_at IS NULL
+		ORDER BY prod.name ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+	for rows.Next() {
+		var product Product
+		err := rows.Scan(
+			&product.ID,
+			&product.Name,
+			&product.Slug,
+			&product.Description,
+			&product.CategoryID,
+			&product.MainImg,
+			&product.Available,
+			&product.Quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if product.MainImg == "" {
+			product.MainImg = DefaultProductImage
+		}
+		products = append(products, &product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
@@ -0,0 +1,854 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/vladwithcode/qrcatalog/internal/notify"
+)
+
+// soldOutEvents collects the sold out events of productID. Handlers can't be
+// unsubscribed, so events of other products are ignored
+func soldOutEvents(productID string) func() []notify.Event {
+	var (
+		mu     sync.Mutex
+		events []notify.Event
+	)
+	notify.Subscribe(notify.EventProductSoldOut, func(e notify.Event) {
+		if e.Payload["product_id"] != productID {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+
+	return func() []notify.Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]notify.Event{}, events...)
+	}
+}
+
+func TestEmitSoldOutFiresOnceOnTransitionToZero(t *testing.T) {
+	id := "sold-out-transition"
+	events := soldOutEvents(id)
+
+	emitSoldOut(id, 3, 0)
+	got := events()
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+	if got[0].Payload["product_id"] != id {
+		t.Errorf("got product_id %v, want %q", got[0].Payload["product_id"], id)
+	}
+	if got[0].Payload["last_quantity"] != 3 {
+		t.Errorf("got last_quantity %v, want 3", got[0].Payload["last_quantity"])
+	}
+
+	emitSoldOut(id, 0, 0)
+	if got := events(); len(got) != 1 {
+		t.Errorf("got %d events after a repeated zero write, want 1", len(got))
+	}
+}
+
+func TestEmitSoldOutIgnoresRestocks(t *testing.T) {
+	id := "sold-out-restock"
+	events := soldOutEvents(id)
+
+	emitSoldOut(id, 0, 5)
+	emitSoldOut(id, 5, 2)
+
+	if got := events(); len(got) != 0 {
+		t.Errorf("got %d events, want 0", len(got))
+	}
+}
+
+func TestUpdateProductBatchSkipsUnknownIDs(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	id := createTestProduct(t, 2)
+	execTestSQL(t, `UPDATE products SET category_id = $2 WHERE id = $1`, id, categoryID)
+	product, err := FindProductByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := soldOutEvents(id)
+	unknown := &Product{ID: "00000000-0000-0000-0000-000000000000", Name: "x", Slug: "x", CategoryID: categoryID}
+
+	product.Quantity = 0
+	err = UpdateProductBatch([]*Product{unknown, product})
+	if err != nil {
+		t.Fatalf("expected unknown ids to be skipped, got %v", err)
+	}
+
+	if got := productQuantity(t, id); got != 0 {
+		t.Errorf("got stock %d, want 0", got)
+	}
+	if got := events(); len(got) != 1 {
+		t.Errorf("got %d sold out events, want 1", len(got))
+	}
+}
+
+// failCommitsOfProduct installs a deferred constraint trigger that makes
+// committing an insert of a product named name fail
+func failCommitsOfProduct(t *testing.T, name string) {
+	t.Helper()
+
+	execTestSQL(t, `
+		CREATE OR REPLACE FUNCTION test_fail_commit() RETURNS trigger LANGUAGE plpgsql AS $$
+		BEGIN
+			RAISE EXCEPTION 'injected commit failure';
+		END
+		$$`)
+	execTestSQL(t, `DROP TRIGGER IF EXISTS test_fail_commit ON products`)
+	execTestSQL(t, `
+		CREATE CONSTRAINT TRIGGER test_fail_commit AFTER INSERT ON products
+		DEFERRABLE INITIALLY DEFERRED
+		FOR EACH ROW WHEN (NEW.name = '`+name+`')
+		EXECUTE FUNCTION test_fail_commit()`)
+	t.Cleanup(func() {
+		execTestSQL(t, `DROP TRIGGER IF EXISTS test_fail_commit ON products`)
+		execTestSQL(t, `DROP FUNCTION IF EXISTS test_fail_commit()`)
+		execTestSQL(t, `DELETE FROM products WHERE name = $1`, name)
+	})
+}
+
+func TestCreateProductReturnsCommitErrors(t *testing.T) {
+	connectTestDB(t)
+
+	name := "test-fail-commit-" + uuid.Must(uuid.NewV7()).String()
+	failCommitsOfProduct(t, name)
+
+	err := CreateProduct(&Product{
+		Name:       name,
+		Slug:       name,
+		CategoryID: createTestCategory(t),
+		Quantity:   1,
+	})
+	if err == nil || !strings.Contains(err.Error(), "injected commit failure") {
+		t.Errorf("expected the commit error, got %v", err)
+	}
+}
+
+func TestImportProductWithUnknownCategory(t *testing.T) {
+	connectTestDB(t)
+
+	category := "test-category-" + uuid.Must(uuid.NewV7()).String()
+	products := []*Product{{Name: "test-product-" + category, Category: category}}
+
+	err := SCreateProducts(products, false)
+	if !errors.Is(err, ErrProductCategoryUnknown) {
+		t.Fatalf("expected ErrProductCategoryUnknown, got %v", err)
+	}
+	if !strings.Contains(err.Error(), category) {
+		t.Errorf("expected the error to name the category, got %v", err)
+	}
+}
+
+func TestImportProductCreatingMissingCategory(t *testing.T) {
+	connectTestDB(t)
+
+	// The import uses the image named as the product as its main image
+	imageID := createTestImage(t)
+	name := "test-image-" + imageID
+	category := "test-category-" + imageID
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM images_products WHERE image_id = $1`, imageID)
+		execTestSQL(t, `DELETE FROM products WHERE name = $1`, name)
+		execTestSQL(t, `DELETE FROM categories WHERE name = $1`, category)
+	})
+
+	products := []*Product{{Name: name, Category: category, Quantity: 1}}
+	if err := SCreateProducts(products, true); err != nil {
+		t.Fatal(err)
+	}
+
+	got := countTestRows(
+		t,
+		`SELECT COUNT(*) FROM products p JOIN categories c ON c.id = p.category_id WHERE p.id = $1 AND c.name = $2`,
+		products[0].ID,
+		category,
+	)
+	if got != 1 {
+		t.Error("expected the product to be in the created category")
+	}
+}
+
+func TestLinkVideoToProduct(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	categoryID := createTestCategory(t)
+	productID := createTestProduct(t, 1)
+	execTestSQL(t, `UPDATE products SET category_id = $2 WHERE id = $1`, productID, categoryID)
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM product_videos WHERE product_id = $1`, productID)
+	})
+
+	for _, filename := range []string{"video_a.mp4", "video_b.webm", "video_a.mp4"} {
+		if err := LinkVideoToProduct(ctx, productID, filename, 1024); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	product, err := FindProductByID(productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(product.Videos) != 2 || product.Videos[0] != "video_a.mp4" || product.Videos[1] != "video_b.webm" {
+		t.Errorf("got videos %v, want [video_a.mp4 video_b.webm]", product.Videos)
+	}
+
+	if err := UnlinkVideoFromProduct(ctx, productID, "video_a.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	product, err = FindProductByID(productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(product.Videos) != 1 || product.Videos[0] != "video_b.webm" {
+		t.Errorf("got videos %v after unlinking, want [video_b.webm]", product.Videos)
+	}
+}
+
+func TestProductGalleryOrderIsStable(t *testing.T) {
+	connectTestDB(t)
+
+	productID := createTestProductIn(t, createTestCategory(t), 1)
+	// Test image filenames sort in creation order, so linking them in
+	// reverse doesn't match it
+	imageIDs := []string{createTestImage(t), createTestImage(t), createTestImage(t)}
+	for _, imageID := range slices.Backward(imageIDs) {
+		if err := LinkImageToProducts(context.Background(), imageID, []string{productID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := make([]string, len(imageIDs))
+	for i, imageID := range imageIDs {
+		want[i] = "test-image-" + imageID
+	}
+	for range 3 {
+		byID, err := FindProductByID(productID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(byID.Gallery, want) || !slices.Equal(byID.GalleryIDs, imageIDs) {
+			t.Fatalf("got gallery %v %v, want %v %v", byID.Gallery, byID.GalleryIDs, want, imageIDs)
+		}
+
+		bySlug, err := FindProductBySlug(byID.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(bySlug.Gallery, want) {
+			t.Fatalf("got gallery %v by slug, want %v", bySlug.Gallery, want)
+		}
+	}
+}
+
+func TestFilterProductsKeepsIDsOrder(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	first := createTestProductIn(t, categoryID, 1)
+	second := createTestProductIn(t, categoryID, 1)
+	third := createTestProductIn(t, categoryID, 1)
+	ids := []string{third, first, second}
+
+	result, err := FilterProducts(ProductFilterParams{IDs: ids, KeepIDsOrder: true, Sort: "name_asc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, product := range result.Products {
+		got = append(got, product.ID)
+	}
+	if !slices.Equal(got, ids) {
+		t.Errorf("got products %v, want %v", got, ids)
+	}
+}
+
+func TestSetDBParametersReadsTheDefaultProductImage(t *testing.T) {
+	useDefaultProductImage(t, "placeholder.webp")
+	if DefaultProductImage != "placeholder.webp" {
+		t.Errorf("got %q, want placeholder.webp", DefaultProductImage)
+	}
+}
+
+func TestProductsWithoutImageGetTheDefault(t *testing.T) {
+	connectTestDB(t)
+	useDefaultProductImage(t, "placeholder.webp")
+
+	categoryID := createTestCategory(t)
+	productID := createTestProductIn(t, categoryID, 1)
+
+	products, err := FilterProducts(ProductFilterParams{IDs: []string{productID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products.Products) != 1 || products.Products[0].MainImg != "placeholder.webp" {
+		t.Errorf("got products %+v, want one with the default image", products.Products)
+	}
+
+	catalog, err := FilterCatalogProducts(CatalogProductFilterParams{Categories: []string{categoryID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Products) != 1 || catalog.Products[0].ImageURL != "placeholder.webp" {
+		t.Errorf("got catalog products %+v, want one with the default image", catalog.Products)
+	}
+}
+
+func TestParseSearchWeights(t *testing.T) {
+	got, err := ParseSearchWeights("1, 0.5,0.25,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SearchWeights{A: 1, B: 0.5, C: 0.25, D: 0}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	// ts_rank takes the weights from D to A
+	if want := []float32{0, 0.25, 0.5, 1}; !slices.Equal(got.Array(), want) {
+		t.Errorf("got array %v, want %v", got.Array(), want)
+	}
+
+	for _, invalid := range []string{"1,0.5,0.25", "1,0.5,0.25,x", "1,0.5,0.25,2", "1,-0.5,0.25,0"} {
+		if _, err := ParseSearchWeights(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestNameMatchesOutrankLongDescriptionMatches(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	inLongDescription := createTestProductIn(t, categoryID, 1)
+	inName := createTestProductIn(t, categoryID, 1)
+	execTestSQL(
+		t,
+		`UPDATE products SET long_description = 'Incluye un zumbadorcito de regalo' WHERE id = $1`,
+		inLongDescription,
+	)
+	execTestSQL(t, `UPDATE products SET name = 'Zumbadorcito ' || id WHERE id = $1`, inName)
+
+	result, err := FilterProducts(ProductFilterParams{
+		Search:     "zumbadorcito",
+		SearchMode: SearchModeFullText,
+		Categories: []string{categoryID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, product := range result.Products {
+		got = append(got, product.ID)
+	}
+	if want := []string{inName, inLongDescription}; !slices.Equal(got, want) {
+		t.Errorf("got products %v, want %v", got, want)
+	}
+}
+
+func TestFindUncategorizedProducts(t *testing.T) {
+	connectTestDB(t)
+
+	uncategorized := createTestProduct(t, 1)
+	categorized := createTestProductIn(t, createTestCategory(t), 1)
+
+	products, err := FindUncategorizedProducts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, product := range products {
+		found[product.ID] = true
+	}
+	if !found[uncategorized] {
+		t.Error("expected the product without category to be found")
+	}
+	if found[categorized] {
+		t.Error("expected the categorized product to be left out")
+	}
+}
+
+func TestUpdateProductMainImage(t *testing.T) {
+	connectTestDB(t)
+
+	productID := createTestProductIn(t, createTestCategory(t), 1)
+	byID, byFilename := createTestImage(t), createTestImage(t)
+
+	tests := []struct {
+		name    string
+		mainImg string
+		want    string
+	}{
+		{"image id", byID, byID},
+		{"image filename", "test-image-" + byFilename, byFilename},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product, err := FindProductByID(productID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			product.MainImg = tt.mainImg
+			product.MainImgID = ""
+			if err := UpdateProduct(product); err != nil {
+				t.Fatal(err)
+			}
+
+			product, err = FindProductByID(productID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if product.MainImgID != tt.want {
+				t.Errorf("got main image %q, want %q", product.MainImgID, tt.want)
+			}
+			if want := "test-image-" + tt.want; product.MainImg != want {
+				t.Errorf("got main image filename %q, want %q", product.MainImg, want)
+			}
+		})
+	}
+}
+
+func TestUpdateProductRejectsUnknownMainImage(t *testing.T) {
+	connectTestDB(t)
+
+	product, err := FindProductByID(createTestProductIn(t, createTestCategory(t), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.MainImg = "missing-image.webp"
+	product.MainImgID = ""
+
+	if err := UpdateProduct(product); !errors.Is(err, ErrProductMainImgInvalid) {
+		t.Errorf("got error %v, want %v", err, ErrProductMainImgInvalid)
+	}
+}
+
+func TestFilterProductsByQRCode(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	withQR := createTestProductIn(t, categoryID, 1)
+	withoutQR := createTestProductIn(t, categoryID, 1)
+	execTestSQL(t, `UPDATE products SET qrcode_filename = 'test-qr.png' WHERE id = $1`, withQR)
+	ids := []string{withQR, withoutQR}
+
+	tests := []struct {
+		name       string
+		withQRCode int
+		want       string
+	}{
+		{"with qr code", 1, withQR},
+		{"without qr code", -1, withoutQR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := FilterProducts(ProductFilterParams{IDs: ids, WithQRCode: tt.withQRCode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Products) != 1 || result.Products[0].ID != tt.want {
+				t.Errorf("got %d products, want only %s", len(result.Products), tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAllProducts(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	categorized := createTestProductIn(t, categoryID, 2)
+	uncategorized := createTestProduct(t, 3)
+
+	products, err := FindAllProducts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]*Product{}
+	for _, product := range products {
+		found[product.ID] = product
+	}
+	if product := found[categorized]; product == nil {
+		t.Error("expected the categorized product to be listed")
+	} else if product.CategoryID != categoryID || product.Quantity != 2 {
+		t.Errorf("got category %q and quantity %d, want %q and 2", product.CategoryID, product.Quantity, categoryID)
+	}
+	if product := found[uncategorized]; product == nil {
+		t.Error("expected the uncategorized product to be listed")
+	} else if product.CategoryID != "" || product.Quantity != 3 {
+		t.Errorf("got category %q and quantity %d, want no category and 3", product.CategoryID, product.Quantity)
+	}
+}
+
+func TestBuildQueryConditionsPriceRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max float64
+		want     []string
+	}{
+		{"min only", 100, 0, []string{"prod.price >= @min_price"}},
+		{"max only", 0, 300, []string{"prod.price <= @max_price"}},
+		{"both bounds", 100, 300, []string{"prod.price >= @min_price", "prod.price <= @max_price"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions, args := buildQueryConditions(ProductFilterParams{MinPrice: tt.min, MaxPrice: tt.max})
+			for _, want := range tt.want {
+				if !slices.Contains(conditions, want) {
+					t.Errorf("expected condition %q in %v", want, conditions)
+				}
+			}
+			if _, ok := args["min_price"]; ok != (tt.min > 0) {
+				t.Errorf("got min_price arg %v, want it only with a min", args["min_price"])
+			}
+			if _, ok := args["max_price"]; ok != (tt.max > 0) {
+				t.Errorf("got max_price arg %v, want it only with a max", args["max_price"])
+			}
+		})
+	}
+}
+
+func TestFilterProductsByPriceRange(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	var ids []string
+	for _, price := range []float64{300, 100, 200} {
+		id := createTestProductIn(t, categoryID, 1)
+		execTestSQL(t, `UPDATE products SET price = $2 WHERE id = $1`, id, price)
+		ids = append(ids, id)
+	}
+	expensive, cheap, mid := ids[0], ids[1], ids[2]
+
+	tests := []struct {
+		name     string
+		min, max float64
+		want     []string
+	}{
+		{"min only", 150, 0, []string{mid, expensive}},
+		{"max only", 0, 250, []string{cheap, mid}},
+		{"both bounds", 150, 250, []string{mid}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := FilterProducts(ProductFilterParams{
+				IDs:      ids,
+				MinPrice: tt.min,
+				MaxPrice: tt.max,
+				Sort:     "price_asc",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, product := range result.Products {
+				got = append(got, product.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got products %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductInWindow(t *testing.T) {
+	now := time.Now()
+	yesterday, tomorrow := now.Add(-24*time.Hour), now.Add(24*time.Hour)
+
+	tests := []struct {
+		name        string
+		from, until *time.Time
+		want        bool
+	}{
+		{"no window", nil, nil, true},
+		{"before the window", &tomorrow, nil, false},
+		{"during the window", &yesterday, &tomorrow, true},
+		{"after the window", nil, &yesterday, false},
+		{"at the window end", nil, &now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := &Product{Available: true, AvailableFrom: tt.from, AvailableUntil: tt.until}
+			if got := product.InWindow(now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := product.IsAvailableAt(now); got != tt.want {
+				t.Errorf("got available %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateProductRejectsInvertedWindow(t *testing.T) {
+	from := time.Now()
+	until := from.Add(-time.Hour)
+
+	err := CreateProduct(&Product{Name: "Mesa", AvailableFrom: &from, AvailableUntil: &until})
+	if !errors.Is(err, ErrProductWindowInvalid) {
+		t.Errorf("got error %v, want %v", err, ErrProductWindowInvalid)
+	}
+}
+
+func TestCatalogHidesProductsOutsideTheirWindow(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	before := createTestProductIn(t, categoryID, 1)
+	during := createTestProductIn(t, categoryID, 1)
+	after := createTestProductIn(t, categoryID, 1)
+	execTestSQL(t, `UPDATE products SET available_from = NOW() + INTERVAL '1 day' WHERE id = $1`, before)
+	execTestSQL(
+		t,
+		`UPDATE products SET available_from = NOW() - INTERVAL '1 day', available_until = NOW() + INTERVAL '1 day' WHERE id = $1`,
+		during,
+	)
+	execTestSQL(t, `UPDATE products SET available_until = NOW() - INTERVAL '1 day' WHERE id = $1`, after)
+
+	result, err := FilterCatalogProducts(CatalogProductFilterParams{OnlyIDs: []string{before, during, after}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, product := range result.Products {
+		got = append(got, product.ID)
+	}
+	if !slices.Equal(got, []string{during}) {
+		t.Errorf("got products %v, want only the one within its window %s", got, during)
+	}
+}
+
+func TestFindProductIncludesSubcategory(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	subcategoryID := createTestSubcategory(t, categoryID)
+	withSubcategory := createTestProductIn(t, categoryID, 1)
+	execTestSQL(t, `UPDATE products SET subcategory_id = $2 WHERE id = $1`, withSubcategory, subcategoryID)
+	withoutSubcategory := createTestProductIn(t, categoryID, 1)
+
+	tests := []struct {
+		name          string
+		productID     string
+		subcategoryID string
+		subcategory   string
+	}{
+		{"with subcategory", withSubcategory, subcategoryID, "test-subcategory-" + subcategoryID},
+		{"without subcategory", withoutSubcategory, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			byID, err := FindProductByID(tt.productID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bySlug, err := FindProductBySlug("test-product-" + tt.productID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, product := range []*Product{byID, bySlug} {
+				if product.SubcategoryID != tt.subcategoryID || product.Subcategory != tt.subcategory {
+					t.Errorf(
+						"got subcategory %q (%q), want %q (%q)",
+						product.SubcategoryID, product.Subcategory, tt.subcategoryID, tt.subcategory,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestGetStockLevels(t *testing.T) {
+	connectTestDB(t)
+
+	inStock := createTestProduct(t, 5)
+	soldOut := createTestProduct(t, 0)
+	unavailable := createTestProduct(t, 3)
+	execTestSQL(t, `UPDATE products SET available = false WHERE id = $1`, unavailable)
+	outOfWindow := createTestProduct(t, 4)
+	execTestSQL(t, `UPDATE products SET available_until = NOW() - INTERVAL '1 day' WHERE id = $1`, outOfWindow)
+	deleted := createTestProduct(t, 2)
+	execTestSQL(t, `UPDATE products SET deleted_at = NOW() WHERE id = $1`, deleted)
+	missing := uuid.Must(uuid.NewV7()).String()
+
+	levels, err := GetStockLevels(
+		context.Background(),
+		[]string{inStock, soldOut, unavailable, outOfWindow, deleted, missing, "not-an-id"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{inStock: 5, soldOut: 0, unavailable: 0, outOfWindow: 0}
+	if !maps.Equal(levels, want) {
+		t.Errorf("got stock levels %v, want %v", levels, want)
+	}
+}
+
+func TestFindProductsByIDsKeepsTheGivenOrder(t *testing.T) {
+	connectTestDB(t)
+
+	// Names sort in creation order, so this asks for them out of order
+	first, second, third := createTestProduct(t, 1), createTestProduct(t, 1), createTestProduct(t, 1)
+	missing := uuid.Must(uuid.NewV7()).String()
+
+	products, err := FindProductsByIDs([]string{third, missing, first, "not-an-id", second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, product := range products {
+		got = append(got, product.ID)
+	}
+	if want := []string{third, first, second}; !slices.Equal(got, want) {
+		t.Errorf("got products %v, want %v", got, want)
+	}
+}
+
+// takenNameQuerier answers the product name check with taken
+type takenNameQuerier struct {
+	taken   bool
+	queried bool
+}
+
+func (q *takenNameQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.queried = true
+	return takenNameRow{q.taken}
+}
+
+type takenNameRow struct{ taken bool }
+
+func (r takenNameRow) Scan(dest ...any) error {
+	*dest[0].(*bool) = r.taken
+	return nil
+}
+
+// useUniqueProductNames sets UniqueProductNamesPerCategory for the test
+func useUniqueProductNames(t *testing.T, enabled bool) {
+	t.Helper()
+
+	prev := UniqueProductNamesPerCategory
+	t.Cleanup(func() { UniqueProductNamesPerCategory = prev })
+	UniqueProductNamesPerCategory = enabled
+}
+
+func TestCheckProductNameInCategory(t *testing.T) {
+	product := &Product{Name: "Mesa", CategoryID: "category"}
+
+	useUniqueProductNames(t, false)
+	q := &takenNameQuerier{taken: true}
+	if err := checkProductNameInCategory(context.Background(), q, product); err != nil || q.queried {
+		t.Errorf("got error %v and queried %v with the check disabled", err, q.queried)
+	}
+
+	useUniqueProductNames(t, true)
+	err := checkProductNameInCategory(context.Background(), &takenNameQuerier{taken: true}, product)
+	if !errors.Is(err, ErrProductNameTakenInCategory) {
+		t.Errorf("got error %v, want %v", err, ErrProductNameTakenInCategory)
+	}
+	if err := checkProductNameInCategory(context.Background(), &takenNameQuerier{}, product); err != nil {
+		t.Errorf("got error %v for a free name", err)
+	}
+}
+
+func TestUniqueProductNamesPerCategory(t *testing.T) {
+	connectTestDB(t)
+	useUniqueProductNames(t, true)
+
+	categoryID, otherCategoryID := createTestCategory(t), createTestCategory(t)
+	original, err := FindProductByID(createTestProductIn(t, categoryID, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		categoryID string
+		wantErr    error
+	}{
+		{"same category", categoryID, ErrProductNameTakenInCategory},
+		{"different category", otherCategoryID, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product, err := FindProductByID(createTestProductIn(t, tt.categoryID, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			product.Name = strings.ToUpper(original.Name)
+
+			if err := UpdateProduct(product); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReassignProductsCategory(t *testing.T) {
+	connectTestDB(t)
+
+	from, to := createTestCategory(t), createTestCategory(t)
+	subcategoryID := createTestSubcategory(t, from)
+	ids := []string{createTestProductIn(t, from, 1), createTestProductIn(t, from, 1), createTestProductIn(t, from, 1)}
+	execTestSQL(t, `UPDATE products SET subcategory_id = $2 WHERE id = ANY($1::uuid[])`, ids, subcategoryID)
+
+	updated, err := ReassignProductsCategory(context.Background(), ids, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != len(ids) {
+		t.Errorf("got %d products updated, want %d", updated, len(ids))
+	}
+
+	got := countTestRows(
+		t,
+		`SELECT COUNT(*) FROM products WHERE id = ANY($1::uuid[]) AND category_id = $2 AND subcategory_id IS NULL`,
+		ids,
+		to,
+	)
+	if got != len(ids) {
+		t.Errorf("got %d products moved without the old subcategory, want %d", got, len(ids))
+	}
+}
+
+func TestReassignProductsCategoryToUnknownCategory(t *testing.T) {
+	_, err := ReassignProductsCategory(context.Background(), []string{uuid.Must(uuid.NewV7()).String()}, "not-an-id")
+	if !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrCategoryNotFound)
+	}
+
+	connectTestDB(t)
+	productID := createTestProduct(t, 1)
+	_, err = ReassignProductsCategory(context.Background(), []string{productID}, uuid.Must(uuid.NewV7()).String())
+	if !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrCategoryNotFound)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"strings"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type EventKindDetails struct {
@@ -27,6 +29,21 @@ const (
 	QuoteRequestTypeContact     QuoteRequestType = "contacto"
 )
 
+var (
+	ErrInvalidRequestType = errors.New("invalid quote request type")
+	ErrQuoteNotFound      = errors.New("quote not found")
+	ErrQuoteNoteEmpty     = errors.New("quote note is empty")
+)
+
+// Valid reports whether t is one of the known request types
+func (t QuoteRequestType) Valid() bool {
+	switch t {
+	case QuoteRequestTypeReservation, QuoteRequestTypeBudget, QuoteRequestTypeContact:
+		return true
+	}
+	return false
+}
+
 type QuoteStatus string
 
 const (
@@ -52,6 +69,10 @@ type Quote struct {
 	EventKindName sql.NullString   `json:"event_kind_name"`
 	CreatedAt     time.Time        `json:"created_at"`
 	UpdatedAt     time.Time        `json:"updated_at"`
+
+	// InternalNotes are staff only notes. They're never read by the regular
+	// finders, call LoadInternalNotes on authenticated reads to fill them
+	InternalNotes string `json:"internal_notes,omitempty"`
 }
 
 type QuoteFilterParams struct {
@@ -82,8 +103,27 @@ type QuoteFilterResult struct {
 }
 
 func CreateQuote(quote *Quote) error {
+	if !quote.RequestType.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidRequestType, quote.RequestType)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+
+	if quote.CartID.Valid && quote.CartID.String != "" {
+		cart := quote.Cart
+		if cart == nil {
+			var err error
+			cart, err = FindCartByID(ctx, quote.CartID.String)
+			if err != nil {
+				return err
+			}
+		}
+		if err := cart.CanSubmit(); err != nil {
+			return err
+		}
+	}
+
 	conn, err := GetConn()
 	if err != nil {
 		return err
@@ -103,7 +143,13 @@ func CreateQuote(quote *Quote) error {
 		timeEnd = sql.NullTime{Time: *quote.TimeEnd, Valid: true}
 	}
 
-	_, err = conn.Exec(
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
 		ctx,
 		`INSERT INTO quotes (
 			id, customer_name, customer_phone, time_start, time_end, status, comments, cart_id, request_type, event_kind_id
@@ -123,6 +169,41 @@ func CreateQuote(quote *Quote) error {
 		return err
 	}
 
+	// Lock the attached cart so it can't be edited after being submitted, and
+	// take its items out of stock. The flag is flipped first and only if it
+	// wasn't set, so concurrent submissions of the same cart can't both pass
+	// CanSubmit and decrement the stock twice
+	var changes stockChanges
+	if quote.CartID.Valid && quote.CartID.String != "" {
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE carts SET is_submitted = true WHERE id = $1 AND NOT is_submitted`,
+			quote.CartID.String,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to mark cart as submitted: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrCartSubmitted
+		}
+
+		changes, err = decrementStockForCartTx(ctx, tx, quote.CartID.String)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	changes.emitSoldOut()
+
+	quote.ID = id.String()
+	if quote.Cart != nil {
+		quote.Cart.IsSubmitted = true
+	}
+
 	return nil
 }
 
@@ -183,11 +264,55 @@ func FindQuoteByID(id string) (*Quote, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal cart items: %w", err)
 		}
+
+		if quote.CartID.Valid && quote.CartID.String != "" {
+			err = loadCartItemNotes(ctx, conn, quote.CartID.String, quote.Cart.Items)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load cart item notes: %w", err)
+			}
+		}
 	}
 
 	return &quote, nil
 }
 
+// loadCartItemNotes fills the note and customizations of the snapshot items
+// from the cart they were submitted with
+func loadCartItemNotes(ctx context.Context, conn *pgxpool.Conn, cartID string, items []*CartItem) error {
+	rows, err := conn.Query(
+		ctx,
+		`SELECT product_id, note, customizations FROM cart_items WHERE cart_id = $1`,
+		cartID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byProduct := make(map[string]*CartItem, len(items))
+	for _, item := range items {
+		byProduct[item.ProductID] = item
+	}
+
+	for rows.Next() {
+		var (
+			productID      string
+			note           string
+			customizations map[string]string
+		)
+		err := rows.Scan(&productID, &note, &customizations)
+		if err != nil {
+			return err
+		}
+		if item, ok := byProduct[productID]; ok {
+			item.Note = note
+			item.Customizations = customizations
+		}
+	}
+
+	return rows.Err()
+}
+
 func FindAllQuotes() ([]*Quote, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -221,6 +346,10 @@ func FindAllQuotes() ([]*Quote, error) {
 }
 
 func UpdateQuote(quote *Quote) error {
+	if !quote.RequestType.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidRequestType, quote.RequestType)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -543,35 +672,70 @@ func scanQuotes(rows pgx.Rows) ([]*Quote, error) {
 	return quotes, nil
 }
 
-func FindQuotesByCustomerName(customerName string) ([]*Quote, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	conn, err := GetConn()
+// FindQuotesByCustomerName returns the quotes whose customer name contains
+// customerName, ignoring case, paginated like FilterQuotes
+func FindQuotesByCustomerName(customerName string, page int, limit int) (*QuoteFilterResult, error) {
+	return FilterQuotes(QuoteFilterParams{
+		CustomerName: customerName,
+		Page:         page,
+		Limit:        limit,
+	})
+}
+
+// LoadInternalNotes fills the staff only notes of the quote. Only call it
+// when serving authenticated users
+func (q *Quote) LoadInternalNotes(ctx context.Context) error {
+	conn, err := GetConnWithContext(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(
+	err = conn.QueryRow(
 		ctx,
-		`SELECT 
-			q.id, q.customer_name, q.customer_phone, q.time_start, q.time_end, 
-			q.cart_id, q.request_type, q.event_kind_id, q.status, q.comments,
-			ek.name AS event_kind_name, q.created_at, q.updated_at
-		FROM quotes q
-			LEFT JOIN event_kinds ek ON q.event_kind_id = ek.id
-		WHERE q.customer_name = $1`,
-		customerName,
-	)
+		`SELECT internal_notes FROM quotes WHERE id = $1`,
+		q.ID,
+	).Scan(&q.InternalNotes)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrQuoteNotFound
+		}
+		return err
 	}
-	defer rows.Close()
 
-	quotes, err := scanQuotes(rows)
+	return nil
+}
+
+// AppendQuoteNote adds a line to the internal notes of the quote, prefixed
+// with the current time and the id of the user who wrote it
+func AppendQuoteNote(ctx context.Context, id, note, userID string) error {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return ErrQuoteNoteEmpty
+	}
+
+	conn, err := GetConnWithContext(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer conn.Release()
 
-	return quotes, nil
+	entry := fmt.Sprintf("[%s %s] %s", time.Now().Format(time.RFC3339), userID, note)
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE quotes SET internal_notes = CASE
+			WHEN internal_notes = '' THEN @entry
+			ELSE internal_notes || E'\n' || @entry
+		END
+		WHERE id = @id`,
+		pgx.NamedArgs{"id": id, "entry": entry},
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrQuoteNotFound
+	}
+
+	return nil
 }
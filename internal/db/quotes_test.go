@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateQuoteDecrementsStock(t *testing.T) {
+	connectTestDB(t)
+
+	productID := createTestProduct(t, 5)
+	cart := createTestCart(t, 3, productID)
+
+	if err := CreateQuote(cartQuote(cart)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := productQuantity(t, productID); got != 2 {
+		t.Errorf("got stock %d, want 2", got)
+	}
+	stored, err := FindCartByID(context.Background(), cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsSubmitted {
+		t.Error("expected the cart to be submitted")
+	}
+}
+
+func TestCreateQuoteOversellRollsBack(t *testing.T) {
+	connectTestDB(t)
+
+	enough := createTestProduct(t, 10)
+	short := createTestProduct(t, 10)
+	cart := createTestCart(t, 3, enough, short)
+	// Stock sold elsewhere after the items were added
+	setProductQuantity(t, short, 2)
+
+	err := CreateQuote(cartQuote(cart))
+	if !errors.Is(err, ErrCartInsufficientStock) {
+		t.Fatalf("expected ErrCartInsufficientStock, got %v", err)
+	}
+
+	if got := productQuantity(t, enough); got != 10 {
+		t.Errorf("got stock %d for the product with enough stock, want 10", got)
+	}
+	if got := productQuantity(t, short); got != 2 {
+		t.Errorf("got stock %d for the short product, want 2", got)
+	}
+	stored, err := FindCartByID(context.Background(), cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.IsSubmitted {
+		t.Error("expected the cart to stay open after the rollback")
+	}
+}
+
+func TestCreateQuoteWithDeletedProductRollsBack(t *testing.T) {
+	connectTestDB(t)
+
+	available := createTestProduct(t, 10)
+	deleted := createTestProduct(t, 10)
+	cart := createTestCart(t, 3, available, deleted)
+	// Product deleted after it was added to the cart
+	execTestSQL(t, `UPDATE products SET deleted_at = NOW() WHERE id = $1`, deleted)
+
+	err := CreateQuote(cartQuote(cart))
+	if !errors.Is(err, ErrCartProductUnavailable) {
+		t.Fatalf("expected ErrCartProductUnavailable, got %v", err)
+	}
+
+	if got := productQuantity(t, available); got != 10 {
+		t.Errorf("got stock %d for the available product, want 10", got)
+	}
+	stored, err := FindCartByID(context.Background(), cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.IsSubmitted {
+		t.Error("expected the cart to stay open after the rollback")
+	}
+}
+
+func TestCreateQuoteWithStaleCartDoesNotDecrementTwice(t *testing.T) {
+	connectTestDB(t)
+
+	productID := createTestProduct(t, 10)
+	cart := createTestCart(t, 3, productID)
+
+	if err := CreateQuote(cartQuote(cart)); err != nil {
+		t.Fatal(err)
+	}
+
+	// cart is still unsubmitted in memory, as a concurrent request would see it
+	stale := cartQuote(cart)
+	stale.Cart = cart
+	err := CreateQuote(stale)
+	if !errors.Is(err, ErrCartSubmitted) {
+		t.Fatalf("expected ErrCartSubmitted, got %v", err)
+	}
+
+	if got := productQuantity(t, productID); got != 7 {
+		t.Errorf("got stock %d, want 7", got)
+	}
+}
+
+func TestQuoteRequestTypeValid(t *testing.T) {
+	valid := []QuoteRequestType{QuoteRequestTypeReservation, QuoteRequestTypeBudget, QuoteRequestTypeContact}
+	for _, rt := range valid {
+		if !rt.Valid() {
+			t.Errorf("expected %q to be valid", rt)
+		}
+	}
+
+	invalid := []QuoteRequestType{"", "reservacion", "Cotización", "otro"}
+	for _, rt := range invalid {
+		if rt.Valid() {
+			t.Errorf("expected %q to be invalid", rt)
+		}
+	}
+}
+
+// The request type is checked before a connection is acquired, so these run
+// without a database
+func TestQuoteWritesRejectInvalidRequestType(t *testing.T) {
+	quote := &Quote{CustomerName: "Cliente", RequestType: "bogus"}
+
+	if err := CreateQuote(quote); !errors.Is(err, ErrInvalidRequestType) {
+		t.Errorf("CreateQuote: expected ErrInvalidRequestType, got %v", err)
+	}
+	if err := UpdateQuote(quote); !errors.Is(err, ErrInvalidRequestType) {
+		t.Errorf("UpdateQuote: expected ErrInvalidRequestType, got %v", err)
+	}
+}
+
+func TestFindQuotesByCustomerName(t *testing.T) {
+	connectTestDB(t)
+
+	marker := uuid.Must(uuid.NewV7()).String()
+	for range 3 {
+		createTestQuote(t, "Cliente "+marker+" Pérez")
+	}
+	createTestQuote(t, "Otro cliente")
+
+	// Partial and case insensitive
+	first, err := FindQuotesByCustomerName(strings.ToUpper(marker), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Total != 3 || len(first.Quotes) != 2 || !first.HasNext {
+		t.Errorf("got total %d, %d quotes and has next %v on page 1, want 3, 2 and true", first.Total, len(first.Quotes), first.HasNext)
+	}
+
+	second, err := FindQuotesByCustomerName(marker, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Quotes) != 1 || second.HasNext || !second.HasPrevious {
+		t.Errorf("got %d quotes, has next %v and has previous %v on page 2, want 1, false and true", len(second.Quotes), second.HasNext, second.HasPrevious)
+	}
+
+	seen := map[string]bool{}
+	for _, quote := range append(first.Quotes, second.Quotes...) {
+		if seen[quote.ID] {
+			t.Errorf("quote %s is on both pages", quote.ID)
+		}
+		seen[quote.ID] = true
+	}
+}
+
+func TestAppendQuoteNoteRejectsEmptyNotes(t *testing.T) {
+	err := AppendQuoteNote(context.Background(), "quote-1", "  ", "user-1")
+	if !errors.Is(err, ErrQuoteNoteEmpty) {
+		t.Errorf("expected ErrQuoteNoteEmpty, got %v", err)
+	}
+}
+
+func TestQuoteInternalNotes(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	quote := createTestQuote(t, "Cliente")
+	for _, note := range []string{"Llamar el lunes", "Pidió descuento"} {
+		if err := AppendQuoteNote(ctx, quote.ID, note, "user-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	public, err := FindQuoteByID(quote.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "internal_notes") || strings.Contains(string(data), "Llamar") {
+		t.Errorf("expected the notes to be left out of the public payload, got %s", data)
+	}
+
+	if err := public.LoadInternalNotes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(public.InternalNotes, "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got notes %q, want 2 lines", public.InternalNotes)
+	}
+	for i, want := range []string{"user-1] Llamar el lunes", "user-1] Pidió descuento"} {
+		if !strings.HasPrefix(lines[i], "[") || !strings.HasSuffix(lines[i], want) {
+			t.Errorf("got note %q, want a timestamped %q", lines[i], want)
+		}
+	}
+
+	err = AppendQuoteNote(ctx, uuid.Must(uuid.NewV7()).String(), "Nota", "user-1")
+	if !errors.Is(err, ErrQuoteNotFound) {
+		t.Errorf("expected ErrQuoteNotFound for a missing quote, got %v", err)
+	}
+}
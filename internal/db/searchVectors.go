@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSearchEntityInvalid = errors.New("entity doesn't have a search vector")
+)
+
+// searchEntityTables maps the entities with a search_vector to their table
+var searchEntityTables = map[string]string{
+	"products":   "products",
+	"categories": "categories",
+	"sections":   "sections",
+}
+
+// RebuildSearchVectors recomputes the search_vector of every record of entity
+// and returns how many were updated. The vectors are computed by each table's
+// BEFORE UPDATE trigger, so touching the rows is enough to refresh them after
+// the weighting or language changes
+func RebuildSearchVectors(ctx context.Context, entity string) (int, error) {
+	table, ok := searchEntityTables[entity]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrSearchEntityInvalid, entity)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		fmt.Sprintf(`UPDATE %s SET search_vector = NULL`, table),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRebuildSearchVectorsRejectsUnknownEntities(t *testing.T) {
+	_, err := RebuildSearchVectors(context.Background(), "users")
+	if !errors.Is(err, ErrSearchEntityInvalid) {
+		t.Errorf("expected ErrSearchEntityInvalid, got %v", err)
+	}
+}
+
+func TestRebuildSearchVectorsAfterCategoryRename(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	productID := createTestProductIn(t, categoryID, 1)
+
+	// Products index their category name, which renaming the category
+	// doesn't refresh
+	execTestSQL(t, `UPDATE categories SET name = 'Trampolines ' || id WHERE id = $1`, categoryID)
+	matches := func() int {
+		return countTestRows(
+			t,
+			`SELECT COUNT(*) FROM products WHERE id = $1 AND search_vector @@ plainto_tsquery('spanish', 'trampolines')`,
+			productID,
+		)
+	}
+	if matches() != 0 {
+		t.Fatal("expected the product vector to be stale before the rebuild")
+	}
+
+	updated, err := RebuildSearchVectors(context.Background(), "products")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated < 1 {
+		t.Errorf("got %d updated products, want at least 1", updated)
+	}
+	if matches() != 1 {
+		t.Error("expected the product vector to include the new category name")
+	}
+}
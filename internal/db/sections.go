@@ -36,6 +36,10 @@ type SectionFilterParams struct {
 	ServiceCount   int `json:"service_count"`   // Minimum number of services
 	ItemCount      int `json:"item_count"`      // Minimum number of service items
 
+	// Service content filters
+	ServicesWithItems       int `json:"services_with_items"`       // -1 = no service has items, 0 = all, 1 = some service has items
+	ServicesWithDescription int `json:"services_with_description"` // -1 = no service has description, 0 = all, 1 = some service has description
+
 	// Price filters (services)
 	MinPrice int `json:"min_price"` // Minimum service price (in cents)
 	MaxPrice int `json:"max_price"` // Maximum service price (in cents)
@@ -77,6 +81,13 @@ func NewSectionFilterParamsFromRequest(r *http.Request) SectionFilterParams {
 		params.ItemCount, _ = strconv.Atoi(r.URL.Query().Get("item_count"))
 	}
 
+	if r.URL.Query().Get("services_with_items") != "" {
+		params.ServicesWithItems, _ = strconv.Atoi(r.URL.Query().Get("services_with_items"))
+	}
+	if r.URL.Query().Get("services_with_description") != "" {
+		params.ServicesWithDescription, _ = strconv.Atoi(r.URL.Query().Get("services_with_description"))
+	}
+
 	if r.URL.Query().Get("min_price") != "" {
 		params.MinPrice, _ = strconv.Atoi(r.URL.Query().Get("min_price"))
 	}
@@ -110,6 +121,38 @@ func NewSectionFilterParamsFromRequest(r *http.Request) SectionFilterParams {
 	return params
 }
 
+// MaxPublicSectionsLimit bounds the sections returned by a single public
+// request, and is the limit used when none is given
+const MaxPublicSectionsLimit = 100
+
+// DefaultPublicSectionsSort is the sort of the public sections listing when
+// SettingSectionsDefaultSort isn't set
+const DefaultPublicSectionsSort = "order"
+
+// NewPublicSectionFilterParamsFromRequest builds the filter params for the
+// public sections listing. Only search, page and limit are read from the
+// request, sections are sorted by DefaultPublicSectionsSort
+func NewPublicSectionFilterParamsFromRequest(r *http.Request) SectionFilterParams {
+	params := SectionFilterParams{
+		Sort:  DefaultPublicSectionsSort,
+		Page:  1,
+		Limit: MaxPublicSectionsLimit,
+	}
+
+	if r.URL.Query().Get("search") != "" {
+		params.Search = r.URL.Query().Get("search")
+		params.SearchMode = SearchModeFullText
+	}
+	if page, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && page > 0 {
+		params.Page = page
+	}
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 {
+		params.Limit = min(limit, MaxPublicSectionsLimit)
+	}
+
+	return params
+}
+
 // SectionFilterResult contains filtered sections with pagination info
 type SectionFilterResult struct {
 	Sections    []*Section `json:"sections"`
@@ -135,8 +178,14 @@ var (
 	ErrSectionServiceUpdate     = errors.New("failed to update section service")
 	ErrSectionServiceItemUpdate = errors.New("failed to update section service item")
 	ErrSectionDelete            = errors.New("failed to delete section")
+	ErrSectionServicePricing    = errors.New("service can't have both a general price and priced items")
+	ErrSectionServiceNotFound   = errors.New("section service not found")
 )
 
+// SectionTimeFormat is the format of the CreatedAt/UpdatedAt strings of
+// sections and their paragraphs, services and items
+const SectionTimeFormat = time.RFC3339
+
 type Section struct {
 	ID string `db:"id" json:"id"`
 	// Name is used as a human-readable identifier
@@ -148,6 +197,9 @@ type Section struct {
 	Image string `db:"image" json:"image"`
 	// BGImage is the URL of the section's background image, if any
 	BGImage string `db:"bg_image" json:"bg_image"`
+	// Order sets the position of the section on the public page, lower first.
+	// Sections with the same order are shown newest first
+	Order int `db:"order_idx" json:"order"`
 
 	Paragraphs []SectionParagraph `json:"paragraphs"`
 	Services   []SectionService   `json:"services"`
@@ -210,6 +262,20 @@ type SectionServiceItem struct {
 	UpdatedAt   string   `db:"updated_at" json:"updated_at"`
 }
 
+// ValidatePricing checks the service is priced either as a whole, through
+// Price, or per item, but not both
+func (ss *SectionService) ValidatePricing() error {
+	if ss.Price == 0 {
+		return nil
+	}
+	for _, item := range ss.Items {
+		if item.Price != 0 {
+			return fmt.Errorf("%w: %q", ErrSectionServicePricing, ss.Title)
+		}
+	}
+	return nil
+}
+
 func (ssi *SectionServiceItem) ParseContentList() error {
 	if !ssi.ContentAsList {
 		return ErrSectionItemIsNotList
@@ -236,8 +302,27 @@ func CreateSection(ctx context.Context, section *Section) error {
 	}
 	defer tx.Rollback(ctx)
 
+	err = CreateSectionTx(ctx, tx, section)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CreateSectionTx inserts the section with its paragraphs, services and items
+// using tx, leaving the commit to the caller so several sections can be
+// created atomically
+func CreateSectionTx(ctx context.Context, tx pgx.Tx, section *Section) error {
+	for i := range section.Services {
+		if err := section.Services[i].ValidatePricing(); err != nil {
+			return err
+		}
+	}
+
 	section.ID = uuid.Must(uuid.NewV7()).String()
-	section.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+	section.CreatedAt = time.Now().Format(SectionTimeFormat)
+	section.UpdatedAt = section.CreatedAt
 
 	args := pgx.NamedArgs{
 		"id":         section.ID,
@@ -245,11 +330,13 @@ func CreateSection(ctx context.Context, section *Section) error {
 		"title":      section.Title,
 		"image":      section.Image,
 		"bg_image":   section.BGImage,
+		"order":      section.Order,
 		"created_at": section.CreatedAt,
+		"updated_at": section.UpdatedAt,
 	}
-	_, err = tx.Exec(
+	_, err := tx.Exec(
 		ctx,
-		`INSERT INTO sections (id, name, title, image, bg_image, created_at) VALUES (@id, @name, @title, @image, @bg_image, @created_at)`,
+		`INSERT INTO sections (id, name, title, image, bg_image, order_idx, created_at, updated_at) VALUES (@id, @name, @title, @image, @bg_image, @order, @created_at, @updated_at)`,
 		args,
 	)
 	if err != nil {
@@ -274,10 +361,11 @@ func CreateSection(ctx context.Context, section *Section) error {
 		}
 	}
 
-	for _, service := range section.Services {
-		id := uuid.Must(uuid.NewV7()).String()
+	for i := range section.Services {
+		service := &section.Services[i]
+		service.ID = uuid.Must(uuid.NewV7()).String()
 		serviceArgs := pgx.NamedArgs{
-			"id":          id,
+			"id":          service.ID,
 			"section_id":  section.ID,
 			"title":       service.Title,
 			"price":       service.Price,
@@ -304,7 +392,7 @@ func CreateSection(ctx context.Context, section *Section) error {
 			}
 			_, err = tx.Exec(
 				ctx,
-				`INSERT INTO section_service_items (id, service_id, order, price, content, content_as_list) VALUES (@id, @service_id, @order, @price, @content, @content_as_list)`,
+				`INSERT INTO section_service_items (id, service_id, order_idx, price, content, content_as_list) VALUES (@id, @service_id, @order, @price, @content, @content_as_list)`,
 				itemArgs,
 			)
 			if err != nil {
@@ -313,7 +401,7 @@ func CreateSection(ctx context.Context, section *Section) error {
 		}
 	}
 
-	return tx.Commit(ctx)
+	return nil
 }
 
 func FindSectionByID(ctx context.Context, id string) (*Section, error) {
@@ -330,13 +418,13 @@ func FindSectionByID(ctx context.Context, id string) (*Section, error) {
 		sectionTitle   sql.NullString
 		sectionImage   sql.NullString
 		sectionBGImage sql.NullString
-		sectionCreated sql.NullString
-		sectionUpdated sql.NullString
+		sectionCreated sql.NullTime
+		sectionUpdated sql.NullTime
 	)
 
 	err = conn.QueryRow(
 		ctx,
-		`SELECT id, name, title, image, bg_image, created_at, updated_at, paragraphs, services
+		`SELECT id, name, title, image, bg_image, order_idx, created_at, updated_at, paragraphs, services
 		 FROM detailed_sections WHERE id = $1`,
 		id,
 	).Scan(
@@ -345,6 +433,7 @@ func FindSectionByID(ctx context.Context, id string) (*Section, error) {
 		&sectionTitle,
 		&sectionImage,
 		&sectionBGImage,
+		&section.Order,
 		&sectionCreated,
 		&sectionUpdated,
 		&paragraphsJSON,
@@ -371,10 +460,10 @@ func FindSectionByID(ctx context.Context, id string) (*Section, error) {
 		section.BGImage = sectionBGImage.String
 	}
 	if sectionCreated.Valid {
-		section.CreatedAt = sectionCreated.String
+		section.CreatedAt = sectionCreated.Time.Format(SectionTimeFormat)
 	}
 	if sectionUpdated.Valid {
-		section.UpdatedAt = sectionUpdated.String
+		section.UpdatedAt = sectionUpdated.Time.Format(SectionTimeFormat)
 	}
 
 	// Parse paragraphs JSON
@@ -427,12 +516,13 @@ func UpdateSection(ctx context.Context, section *Section) error {
 			"title":    section.Title,
 			"image":    section.Image,
 			"bg_image": section.BGImage,
+			"order":    section.Order,
 		}
 
 		_, err = tx.Exec(
 			ctx,
 			`UPDATE sections SET
-				name = @name, title = @title, image = @image, bg_image = @bg_image
+				name = @name, title = @title, image = @image, bg_image = @bg_image, order_idx = @order
 			WHERE id = @id`,
 			sectionArgs,
 		)
@@ -530,7 +620,8 @@ func sectionChanged(current, updated *Section) bool {
 	return current.Name != updated.Name ||
 		current.Title != updated.Title ||
 		current.Image != updated.Image ||
-		current.BGImage != updated.BGImage
+		current.BGImage != updated.BGImage ||
+		current.Order != updated.Order
 }
 
 func paragraphChanged(current, updated *SectionParagraph) bool {
@@ -553,27 +644,27 @@ func serviceItemChanged(current, updated *SectionServiceItem) bool {
 
 // Helper functions to find items by ID
 func findParagraphByID(paragraphs []SectionParagraph, id string) *SectionParagraph {
-	for _, p := range paragraphs {
-		if p.ID == id {
-			return &p
+	for i := range paragraphs {
+		if paragraphs[i].ID == id {
+			return &paragraphs[i]
 		}
 	}
 	return nil
 }
 
 func findServiceByID(services []SectionService, id string) *SectionService {
-	for _, s := range services {
-		if s.ID == id {
-			return &s
+	for i := range services {
+		if services[i].ID == id {
+			return &services[i]
 		}
 	}
 	return nil
 }
 
 func findServiceItemByID(items []SectionServiceItem, id string) *SectionServiceItem {
-	for _, i := range items {
-		if i.ID == id {
-			return &i
+	for i := range items {
+		if items[i].ID == id {
+			return &items[i]
 		}
 	}
 	return nil
@@ -629,9 +720,9 @@ func FindAllSections(ctx context.Context) ([]*Section, error) {
 
 	rows, err := conn.Query(
 		ctx,
-		`SELECT id, name, title, image, bg_image, created_at, updated_at, paragraphs, services
+		`SELECT id, name, title, image, bg_image, order_idx, created_at, updated_at, paragraphs, services
 		 FROM detailed_sections
-		 ORDER BY created_at DESC`,
+		 ORDER BY order_idx ASC, created_at DESC`,
 	)
 	if err != nil {
 		return nil, err
@@ -648,8 +739,8 @@ func FindAllSections(ctx context.Context) ([]*Section, error) {
 			sectionTitle   sql.NullString
 			sectionImage   sql.NullString
 			sectionBGImage sql.NullString
-			sectionCreated sql.NullString
-			sectionUpdated sql.NullString
+			sectionCreated sql.NullTime
+			sectionUpdated sql.NullTime
 		)
 
 		err = rows.Scan(
@@ -658,6 +749,7 @@ func FindAllSections(ctx context.Context) ([]*Section, error) {
 			&sectionTitle,
 			&sectionImage,
 			&sectionBGImage,
+			&section.Order,
 			&sectionCreated,
 			&sectionUpdated,
 			&paragraphsJSON,
@@ -681,10 +773,10 @@ func FindAllSections(ctx context.Context) ([]*Section, error) {
 			section.BGImage = sectionBGImage.String
 		}
 		if sectionCreated.Valid {
-			section.CreatedAt = sectionCreated.String
+			section.CreatedAt = sectionCreated.Time.Format(SectionTimeFormat)
 		}
 		if sectionUpdated.Valid {
-			section.UpdatedAt = sectionUpdated.String
+			section.UpdatedAt = sectionUpdated.Time.Format(SectionTimeFormat)
 		}
 
 		// Parse paragraphs JSON
@@ -758,11 +850,10 @@ func FilterSections(ctx context.Context, filters SectionFilterParams) (*SectionF
 	namedArgs["offset"] = offset
 
 	// Build main query
-	selectClause := `SELECT id, name, title, image, bg_image, created_at, updated_at, paragraphs, services, search_vector`
-	searchRankClause := buildSectionSearchRankSelect(filters)
-	if searchRankClause != "" {
-		selectClause += ", " + searchRankClause
-	}
+	// The rank column is always selected so the scanned columns don't
+	// depend on the search mode
+	selectClause := `SELECT id, name, title, image, bg_image, order_idx, created_at, updated_at, paragraphs, services, ` +
+		buildSectionSearchRankSelect(filters)
 
 	orderByClause := buildSectionOrderByClause(filters)
 
@@ -781,14 +872,14 @@ func FilterSections(ctx context.Context, filters SectionFilterParams) (*SectionF
 	for rows.Next() {
 		var section Section
 		var paragraphsJSON, servicesJSON []byte
-		var searchVector []byte // tsvector as byte array
+		var searchRank float32
 		var (
 			sectionName    sql.NullString
 			sectionTitle   sql.NullString
 			sectionImage   sql.NullString
 			sectionBGImage sql.NullString
-			sectionCreated sql.NullString
-			sectionUpdated sql.NullString
+			sectionCreated sql.NullTime
+			sectionUpdated sql.NullTime
 		)
 
 		err = rows.Scan(
@@ -797,11 +888,12 @@ func FilterSections(ctx context.Context, filters SectionFilterParams) (*SectionF
 			&sectionTitle,
 			&sectionImage,
 			&sectionBGImage,
+			&section.Order,
 			&sectionCreated,
 			&sectionUpdated,
 			&paragraphsJSON,
 			&servicesJSON,
-			&searchVector,
+			&searchRank,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan section: %w", err)
@@ -821,10 +913,10 @@ func FilterSections(ctx context.Context, filters SectionFilterParams) (*SectionF
 			section.BGImage = sectionBGImage.String
 		}
 		if sectionCreated.Valid {
-			section.CreatedAt = sectionCreated.String
+			section.CreatedAt = sectionCreated.Time.Format(SectionTimeFormat)
 		}
 		if sectionUpdated.Valid {
-			section.UpdatedAt = sectionUpdated.String
+			section.UpdatedAt = sectionUpdated.Time.Format(SectionTimeFormat)
 		}
 
 		// Parse paragraphs JSON
@@ -936,6 +1028,25 @@ func buildSectionQueryConditions(filters SectionFilterParams) ([]string, pgx.Nam
 		namedArgs["item_count"] = filters.ItemCount
 	}
 
+	// Service content filters
+	servicesWithItems := `
+			EXISTS (SELECT 1 FROM json_array_elements(services) AS svc
+			        WHERE json_array_length(svc->'items') > 0)`
+	if filters.ServicesWithItems > 0 {
+		conditions = append(conditions, servicesWithItems)
+	} else if filters.ServicesWithItems < 0 {
+		conditions = append(conditions, "NOT"+servicesWithItems)
+	}
+
+	servicesWithDescription := `
+			EXISTS (SELECT 1 FROM json_array_elements(services) AS svc
+			        WHERE COALESCE(svc->>'description', '') != '')`
+	if filters.ServicesWithDescription > 0 {
+		conditions = append(conditions, servicesWithDescription)
+	} else if filters.ServicesWithDescription < 0 {
+		conditions = append(conditions, "NOT"+servicesWithDescription)
+	}
+
 	// Price filters
 	if filters.MinPrice > 0 || filters.MaxPrice > 0 {
 		if filters.MinPrice > 0 && filters.MaxPrice > 0 {
@@ -983,7 +1094,7 @@ func buildSectionSearchRankSelect(filters SectionFilterParams) string {
 	if filters.Search != "" && filters.SearchMode == SearchModeFullText {
 		return "ts_rank(search_vector, plainto_tsquery('spanish', @search_query)) as search_rank"
 	}
-	return ""
+	return "0::real as search_rank"
 }
 
 // buildSectionOrderByClause builds the ORDER BY clause for section queries
@@ -1032,6 +1143,8 @@ func buildSectionOrderByClause(filters SectionFilterParams) string {
 		return "ORDER BY updated_at ASC"
 	case "updated_desc", "recent":
 		return "ORDER BY updated_at DESC"
+	case "order":
+		return "ORDER BY order_idx ASC, created_at DESC"
 	case "paragraphs_asc":
 		return "ORDER BY json_array_length(paragraphs) ASC, name ASC"
 	case "paragraphs_desc":
@@ -1045,9 +1158,45 @@ func buildSectionOrderByClause(filters SectionFilterParams) string {
 	}
 }
 
+// ReorderSections sets the order of the sections to their position in ids.
+// Sections not in ids keep their current order
+func ReorderSections(ctx context.Context, ids []string) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE sections SET order_idx = pos.idx
+		FROM unnest(@ids::uuid[]) WITH ORDINALITY AS pos(id, idx)
+		WHERE sections.id = pos.id`,
+		pgx.NamedArgs{"ids": ids},
+	)
+	if err != nil {
+		return errors.Join(ErrSectionUpdate, err)
+	}
+	if int(tag.RowsAffected()) != len(ids) {
+		return ErrSectionNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
 // AddServiceToSection adds a new service to an existing section
 // This function creates the service and any associated service items in a transaction
 func AddServiceToSection(ctx context.Context, sectionID string, service *SectionService) error {
+	if err := service.ValidatePricing(); err != nil {
+		return err
+	}
+
 	conn, err := GetConnWithContext(ctx)
 	if err != nil {
 		return err
@@ -1073,7 +1222,7 @@ func AddServiceToSection(ctx context.Context, sectionID string, service *Section
 	// Generate UUID for the service
 	service.ID = uuid.Must(uuid.NewV7()).String()
 	service.SectionID = sectionID
-	service.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+	service.CreatedAt = time.Now().Format(SectionTimeFormat)
 
 	// Insert the service
 	serviceArgs := pgx.NamedArgs{
@@ -1098,7 +1247,7 @@ func AddServiceToSection(ctx context.Context, sectionID string, service *Section
 	for _, item := range service.Items {
 		item.ID = uuid.Must(uuid.NewV7()).String()
 		item.ServiceID = service.ID
-		item.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+		item.CreatedAt = time.Now().Format(SectionTimeFormat)
 
 		itemArgs := pgx.NamedArgs{
 			"id":              item.ID,
@@ -1131,6 +1280,12 @@ func AddServiceToSection(ctx context.Context, sectionID string, service *Section
 //
 // This provides a comprehensive update mechanism that can handle complex section modifications
 func UpdateSectionWithAdditions(ctx context.Context, section *Section) error {
+	for i := range section.Services {
+		if err := section.Services[i].ValidatePricing(); err != nil {
+			return err
+		}
+	}
+
 	// First, fetch the current section to compare changes
 	currentSection, err := FindSectionByID(ctx, section.ID)
 	if err != nil {
@@ -1157,12 +1312,13 @@ func UpdateSectionWithAdditions(ctx context.Context, section *Section) error {
 			"title":    section.Title,
 			"image":    section.Image,
 			"bg_image": section.BGImage,
+			"order":    section.Order,
 		}
 
 		_, err = tx.Exec(
 			ctx,
 			`UPDATE sections SET
-				name = @name, title = @title, image = @image, bg_image = @bg_image
+				name = @name, title = @title, image = @image, bg_image = @bg_image, order_idx = @order
 			WHERE id = @id`,
 			sectionArgs,
 		)
@@ -1201,7 +1357,7 @@ func UpdateSectionWithAdditions(ctx context.Context, section *Section) error {
 			// New paragraph - insert
 			newPara.ID = uuid.Must(uuid.NewV7()).String()
 			newPara.SectionID = section.ID
-			newPara.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+			newPara.CreatedAt = time.Now().Format(SectionTimeFormat)
 
 			paraArgs := pgx.NamedArgs{
 				"id":         newPara.ID,
@@ -1282,7 +1438,7 @@ func UpdateSectionWithAdditions(ctx context.Context, section *Section) error {
 					// New service item - insert
 					newItem.ID = uuid.Must(uuid.NewV7()).String()
 					newItem.ServiceID = newService.ID
-					newItem.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+					newItem.CreatedAt = time.Now().Format(SectionTimeFormat)
 
 					itemArgs := pgx.NamedArgs{
 						"id":              newItem.ID,
@@ -1308,7 +1464,7 @@ func UpdateSectionWithAdditions(ctx context.Context, section *Section) error {
 			// New service - insert
 			newService.ID = uuid.Must(uuid.NewV7()).String()
 			newService.SectionID = section.ID
-			newService.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+			newService.CreatedAt = time.Now().Format(SectionTimeFormat)
 
 			serviceArgs := pgx.NamedArgs{
 				"id":          newService.ID,
@@ -1332,7 +1488,7 @@ func UpdateSectionWithAdditions(ctx context.Context, section *Section) error {
 			for _, newItem := range newService.Items {
 				newItem.ID = uuid.Must(uuid.NewV7()).String()
 				newItem.ServiceID = newService.ID
-				newItem.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+				newItem.CreatedAt = time.Now().Format(SectionTimeFormat)
 
 				itemArgs := pgx.NamedArgs{
 					"id":              newItem.ID,
@@ -1387,7 +1543,7 @@ func AddParagraphToSection(ctx context.Context, sectionID string, paragraph *Sec
 	// Generate UUID for the paragraph
 	paragraph.ID = uuid.Must(uuid.NewV7()).String()
 	paragraph.SectionID = sectionID
-	paragraph.CreatedAt = time.Now().Format("2006-01-02T15:04:05-07:00")
+	paragraph.CreatedAt = time.Now().Format(SectionTimeFormat)
 
 	// Insert the paragraph
 	paraArgs := pgx.NamedArgs{
@@ -1431,3 +1587,118 @@ func AddMultipleServicesToSection(ctx context.Context, sectionID string, service
 	}
 	return nil
 }
+
+// UpdateServiceItems upserts the items of a service in a single transaction.
+// Items with an ID are updated only if they changed, items without one are
+// inserted and get their generated ID assigned. Items with an ID that doesn't
+// belong to the service are skipped
+func UpdateServiceItems(ctx context.Context, serviceID string, items []*SectionServiceItem) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	service := SectionService{ID: serviceID}
+	err = tx.QueryRow(
+		ctx,
+		`SELECT title, COALESCE(price, 0) FROM section_service WHERE id = $1 FOR UPDATE`,
+		serviceID,
+	).Scan(&service.Title, &service.Price)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSectionServiceNotFound
+		}
+		return err
+	}
+
+	for _, item := range items {
+		service.Items = append(service.Items, *item)
+	}
+	if err := service.ValidatePricing(); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT id, order_idx, price, content, content_as_list
+		FROM section_service_items WHERE service_id = $1`,
+		serviceID,
+	)
+	if err != nil {
+		return err
+	}
+	var currentItems []SectionServiceItem
+	for rows.Next() {
+		var item SectionServiceItem
+		err := rows.Scan(&item.ID, &item.Order, &item.Price, &item.Content, &item.ContentAsList)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		currentItems = append(currentItems, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.ID != "" {
+			currentItem := findServiceItemByID(currentItems, item.ID)
+			if currentItem == nil || !serviceItemChanged(currentItem, item) {
+				continue
+			}
+
+			itemArgs := pgx.NamedArgs{
+				"id":              item.ID,
+				"order":           item.Order,
+				"price":           item.Price,
+				"content":         item.Content,
+				"content_as_list": item.ContentAsList,
+			}
+			_, err = tx.Exec(
+				ctx,
+				`UPDATE section_service_items SET
+					order_idx = @order, price = @price, content = @content, content_as_list = @content_as_list
+				WHERE id = @id`,
+				itemArgs,
+			)
+			if err != nil {
+				return errors.Join(ErrSectionServiceItemUpdate, err)
+			}
+			continue
+		}
+
+		item.ID = uuid.Must(uuid.NewV7()).String()
+		item.ServiceID = serviceID
+		item.CreatedAt = time.Now().Format(SectionTimeFormat)
+
+		itemArgs := pgx.NamedArgs{
+			"id":              item.ID,
+			"service_id":      item.ServiceID,
+			"order":           item.Order,
+			"price":           item.Price,
+			"content":         item.Content,
+			"content_as_list": item.ContentAsList,
+			"created_at":      item.CreatedAt,
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO section_service_items (id, service_id, order_idx, price, content, content_as_list, created_at)
+			 VALUES (@id, @service_id, @order, @price, @content, @content_as_list, @created_at)`,
+			itemArgs,
+		)
+		if err != nil {
+			return errors.Join(ErrSectionServiceItemInsert, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,376 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindHelpersReturnPointersIntoTheSlice(t *testing.T) {
+	paragraphs := []SectionParagraph{{ID: "p1"}, {ID: "p2", Content: "antes"}}
+	p := findParagraphByID(paragraphs, "p2")
+	if p == nil {
+		t.Fatal("paragraph p2 not found")
+	}
+	p.Content = "después"
+	if paragraphs[1].Content != "después" {
+		t.Errorf("paragraph slice element wasn't changed, got %q", paragraphs[1].Content)
+	}
+
+	services := []SectionService{{ID: "s1"}, {ID: "s2", Title: "antes"}}
+	s := findServiceByID(services, "s2")
+	if s == nil {
+		t.Fatal("service s2 not found")
+	}
+	s.Title = "después"
+	if services[1].Title != "después" {
+		t.Errorf("service slice element wasn't changed, got %q", services[1].Title)
+	}
+
+	items := []SectionServiceItem{{ID: "i1"}, {ID: "i2", Price: 100}}
+	i := findServiceItemByID(items, "i2")
+	if i == nil {
+		t.Fatal("item i2 not found")
+	}
+	i.Price = 200
+	if items[1].Price != 200 {
+		t.Errorf("item slice element wasn't changed, got %d", items[1].Price)
+	}
+}
+
+func TestFindHelpersReturnNilWhenMissing(t *testing.T) {
+	if findParagraphByID([]SectionParagraph{{ID: "p1"}}, "x") != nil {
+		t.Error("expected no paragraph")
+	}
+	if findServiceByID([]SectionService{{ID: "s1"}}, "x") != nil {
+		t.Error("expected no service")
+	}
+	if findServiceItemByID(nil, "x") != nil {
+		t.Error("expected no item")
+	}
+}
+
+func TestValidatePricing(t *testing.T) {
+	tests := []struct {
+		name    string
+		service SectionService
+		wantErr bool
+	}{
+		{"price only", SectionService{Price: 1000, Items: []SectionServiceItem{{Content: "mesa"}}}, false},
+		{"items only", SectionService{Items: []SectionServiceItem{{Price: 500}, {Price: 700}}}, false},
+		{"unpriced", SectionService{Items: []SectionServiceItem{{Content: "mesa"}}}, false},
+		{"price and priced items", SectionService{Price: 1000, Items: []SectionServiceItem{{}, {Price: 500}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.service.ValidatePricing()
+			if tt.wantErr && !errors.Is(err, ErrSectionServicePricing) {
+				t.Errorf("expected ErrSectionServicePricing, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestFilterSectionsByServiceContent(t *testing.T) {
+	connectTestDB(t)
+
+	withItems := createTestSection(t, &Section{
+		Name: "test-items",
+		Services: []SectionService{{
+			Title: "Banquete",
+			Items: []SectionServiceItem{{Content: "Entrada"}, {Content: "Plato fuerte"}},
+		}},
+	})
+	withDescription := createTestSection(t, &Section{
+		Name: "test-description",
+		Services: []SectionService{{
+			Title:       "Decoración",
+			Description: "Flores y manteles a elegir",
+		}},
+	})
+	ids := []string{withItems.ID, withDescription.ID}
+
+	tests := []struct {
+		name    string
+		filters SectionFilterParams
+		want    string
+	}{
+		{"with items", SectionFilterParams{IDs: ids, ServicesWithItems: 1}, withItems.ID},
+		{"without items", SectionFilterParams{IDs: ids, ServicesWithItems: -1}, withDescription.ID},
+		{"with description", SectionFilterParams{IDs: ids, ServicesWithDescription: 1}, withDescription.ID},
+		{"without description", SectionFilterParams{IDs: ids, ServicesWithDescription: -1}, withItems.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filteredSectionIDs(t, tt.filters)
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got sections %v, want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSectionSearchRankSelectAlwaysSelectsRank(t *testing.T) {
+	for _, filters := range []SectionFilterParams{
+		{},
+		{Search: "boda", SearchMode: SearchModeExact, Sort: "name_asc"},
+		{Search: "boda", SearchMode: SearchModeFullText},
+	} {
+		got := buildSectionSearchRankSelect(filters)
+		if !strings.HasSuffix(got, " as search_rank") {
+			t.Errorf("%+v: got %q, want a search_rank column", filters, got)
+		}
+	}
+}
+
+func TestFilterSectionsScansEverySearchMode(t *testing.T) {
+	connectTestDB(t)
+
+	section := createTestSection(t, &Section{Name: "test-scan", Title: "Boda en jardín"})
+
+	tests := []struct {
+		name    string
+		filters SectionFilterParams
+	}{
+		{"empty search", SectionFilterParams{IDs: []string{section.ID}, Sort: "name_asc"}},
+		{"exact search", SectionFilterParams{IDs: []string{section.ID}, Search: "test-scan", SearchMode: SearchModeExact, Sort: "name_asc"}},
+		{"full text search", SectionFilterParams{IDs: []string{section.ID}, Search: "boda", SearchMode: SearchModeFullText}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filteredSectionIDs(t, tt.filters)
+			if len(got) != 1 || got[0] != section.ID {
+				t.Errorf("got sections %v, want [%s]", got, section.ID)
+			}
+		})
+	}
+}
+
+func TestCreatedSectionHasBothTimestamps(t *testing.T) {
+	connectTestDB(t)
+
+	section := createTestSection(t, &Section{Name: "test-timestamps"})
+	if section.UpdatedAt != section.CreatedAt {
+		t.Errorf("got updated_at %q, want it equal to created_at %q", section.UpdatedAt, section.CreatedAt)
+	}
+
+	stored, err := FindSectionByID(context.Background(), section.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"created_at": stored.CreatedAt, "updated_at": stored.UpdatedAt} {
+		if _, err := time.Parse(SectionTimeFormat, value); err != nil {
+			t.Errorf("%s %q isn't parseable: %v", name, value, err)
+		}
+	}
+}
+
+func TestCreateSectionLinksItemsToTheirService(t *testing.T) {
+	connectTestDB(t)
+
+	section := createTestSection(t, &Section{
+		Name: "test-service-items",
+		Services: []SectionService{{
+			Title: "Banquete",
+			Items: []SectionServiceItem{{Content: "Entrada"}, {Content: "Plato fuerte"}},
+		}},
+	})
+
+	serviceID := section.Services[0].ID
+	if serviceID == "" {
+		t.Fatal("expected CreateSection to set the service id")
+	}
+	if got := countTestRows(t, `SELECT COUNT(*) FROM section_service_items WHERE service_id = $1`, serviceID); got != 2 {
+		t.Errorf("got %d items for the service, want 2", got)
+	}
+}
+
+// serviceItemPrices returns the items of a service keyed by their content
+func serviceItemPrices(t *testing.T, serviceID string) map[string]SectionServiceItem {
+	t.Helper()
+	ctx := context.Background()
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT id, price, content FROM section_service_items WHERE service_id = $1`,
+		serviceID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	items := map[string]SectionServiceItem{}
+	for rows.Next() {
+		var item SectionServiceItem
+		if err := rows.Scan(&item.ID, &item.Price, &item.Content); err != nil {
+			t.Fatal(err)
+		}
+		items[item.Content] = item
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestUpdateServiceItemsUpdatesSeveralPrices(t *testing.T) {
+	connectTestDB(t)
+
+	section := createTestSection(t, &Section{
+		Name: "test-update-items",
+		Services: []SectionService{{
+			Title: "Banquete",
+			Items: []SectionServiceItem{
+				{Content: "Entrada", Price: 10000},
+				{Content: "Plato fuerte", Price: 25000},
+			},
+		}},
+	})
+	serviceID := section.Services[0].ID
+	current := serviceItemPrices(t, serviceID)
+
+	items := []*SectionServiceItem{
+		{ID: current["Entrada"].ID, Content: "Entrada", Price: 12000},
+		{ID: current["Plato fuerte"].ID, Content: "Plato fuerte", Price: 30000},
+		{Content: "Postre", Price: 8000},
+	}
+	if err := UpdateServiceItems(context.Background(), serviceID, items); err != nil {
+		t.Fatal(err)
+	}
+	if items[2].ID == "" {
+		t.Error("expected the new item to get an id")
+	}
+
+	got := serviceItemPrices(t, serviceID)
+	want := map[string]int{"Entrada": 12000, "Plato fuerte": 30000, "Postre": 8000}
+	if len(got) != len(want) {
+		t.Fatalf("got %d items, want %d", len(got), len(want))
+	}
+	for content, price := range want {
+		if got[content].Price != price {
+			t.Errorf("got price %d for %q, want %d", got[content].Price, content, price)
+		}
+	}
+}
+
+func TestUpdateServiceItemsOfMissingService(t *testing.T) {
+	connectTestDB(t)
+
+	err := UpdateServiceItems(context.Background(), "00000000-0000-0000-0000-000000000000", nil)
+	if !errors.Is(err, ErrSectionServiceNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrSectionServiceNotFound)
+	}
+}
+
+func TestReorderSectionsSetsThePublicOrder(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	first := createTestSection(t, &Section{Name: "test-order-first"})
+	second := createTestSection(t, &Section{Name: "test-order-second"})
+	third := createTestSection(t, &Section{Name: "test-order-third"})
+	want := []string{third.ID, first.ID, second.ID}
+
+	if err := ReorderSections(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+
+	sections, err := FindAllSections(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, section := range sections {
+		if slices.Contains(want, section.ID) {
+			got = append(got, section.ID)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got sections %v, want %v", got, want)
+	}
+
+	if got := filteredSectionIDs(t, SectionFilterParams{IDs: want, Sort: "order"}); !slices.Equal(got, want) {
+		t.Errorf("got filtered sections %v, want %v", got, want)
+	}
+}
+
+func TestReorderSectionsWithMissingSection(t *testing.T) {
+	connectTestDB(t)
+
+	section := createTestSection(t, &Section{Name: "test-order-missing"})
+	err := ReorderSections(context.Background(), []string{section.ID, "00000000-0000-0000-0000-000000000000"})
+	if !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrSectionNotFound)
+	}
+}
+
+func TestNewPublicSectionFilterParamsFromRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		page, limit int
+	}{
+		{"defaults", "", 1, MaxPublicSectionsLimit},
+		{"page and limit", "?page=3&limit=10", 3, 10},
+		{"limit over the max", "?limit=1000", 1, MaxPublicSectionsLimit},
+		{"invalid values", "?page=-1&limit=cero", 1, MaxPublicSectionsLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/sections"+tt.query, nil)
+			params := NewPublicSectionFilterParamsFromRequest(r)
+			if params.Page != tt.page || params.Limit != tt.limit {
+				t.Errorf("got page %d and limit %d, want %d and %d", params.Page, params.Limit, tt.page, tt.limit)
+			}
+			if params.Sort != DefaultPublicSectionsSort {
+				t.Errorf("got sort %q, want %q", params.Sort, DefaultPublicSectionsSort)
+			}
+		})
+	}
+}
+
+func TestPublicSectionsPagination(t *testing.T) {
+	connectTestDB(t)
+
+	var ids []string
+	for _, name := range []string{"test-page-first", "test-page-second", "test-page-third"} {
+		ids = append(ids, createTestSection(t, &Section{Name: name}).ID)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/sections?page=2&limit=2", nil)
+	params := NewPublicSectionFilterParamsFromRequest(r)
+	params.IDs = ids
+
+	result, err := FilterSections(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Sections) != 1 || result.Total != 3 || result.TotalPages != 2 {
+		t.Errorf(
+			"got %d sections of %d in %d pages, want 1 of 3 in 2 pages",
+			len(result.Sections), result.Total, result.TotalPages,
+		)
+	}
+	if result.HasNext || !result.HasPrevious {
+		t.Errorf("got has next %v and has previous %v on the last page", result.HasNext, result.HasPrevious)
+	}
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// SettingCatalogDefaultSort is the sort of the public catalog when none is
+	// requested, falling back to DefaultCatalogSort
+	SettingCatalogDefaultSort = "catalog_default_sort"
+	// SettingSectionsDefaultSort is the sort of the public sections, falling
+	// back to DefaultPublicSectionsSort
+	SettingSectionsDefaultSort = "sections_default_sort"
+)
+
+var (
+	ErrSettingNotFound = errors.New("setting not found")
+	ErrSettingUnknown  = errors.New("unknown setting")
+	ErrSettingInvalid  = errors.New("invalid setting value")
+)
+
+// settingValues lists the known settings along with the values they accept
+var settingValues = map[string][]string{
+	SettingCatalogDefaultSort: {
+		"name_asc", "name_desc", "quantity_asc", "quantity_desc", "category_asc", "category_desc",
+		"available_first", "available_last", "newest", "oldest", "views_desc",
+	},
+	SettingSectionsDefaultSort: {
+		"order", "name_asc", "name_desc", "title_asc", "title_desc",
+		"created_asc", "created_desc", "updated_asc", "updated_desc",
+	},
+}
+
+// SettingOptions returns the values accepted by each known setting
+func SettingOptions() map[string][]string {
+	return settingValues
+}
+
+// FindSettings returns the value of every setting that has been set
+func FindSettings(ctx context.Context) (map[string]string, error) {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, `SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// GetSetting returns the value of the setting, or ErrSettingNotFound if it
+// hasn't been set
+func GetSetting(ctx context.Context, key string) (string, error) {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+
+	return getSetting(ctx, conn, key)
+}
+
+// SetSetting validates and stores the value of a known setting
+func SetSetting(ctx context.Context, key, value string) error {
+	accepted, ok := settingValues[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSettingUnknown, key)
+	}
+	if !slices.Contains(accepted, value) {
+		return fmt.Errorf("%w: %s = %q", ErrSettingInvalid, key, value)
+	}
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(
+		ctx,
+		`INSERT INTO settings (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = $2, updated_at = CURRENT_TIMESTAMP`,
+		key,
+		value,
+	)
+	return err
+}
+
+// SettingOrDefault returns the value of the setting, or fallback if it hasn't
+// been set or can't be read
+func SettingOrDefault(ctx context.Context, key, fallback string) string {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		log.Printf("failed to read setting %s: %v\n", key, err)
+		return fallback
+	}
+	defer conn.Release()
+
+	return settingOrDefault(ctx, conn, key, fallback)
+}
+
+// settingOrDefault works as SettingOrDefault on an already acquired
+// connection or transaction
+func settingOrDefault(ctx context.Context, q rowQuerier, key, fallback string) string {
+	value, err := getSetting(ctx, q, key)
+	if err != nil {
+		if !errors.Is(err, ErrSettingNotFound) {
+			log.Printf("failed to read setting %s: %v\n", key, err)
+		}
+		return fallback
+	}
+
+	return value
+}
+
+func getSetting(ctx context.Context, q rowQuerier, key string) (string, error) {
+	var value string
+	err := q.QueryRow(ctx, `SELECT value FROM settings WHERE key = $1`, key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%w: %s", ErrSettingNotFound, key)
+		}
+		return "", err
+	}
+
+	return value, nil
+}
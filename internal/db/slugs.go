@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vladwithcode/qrcatalog/internal/utils"
+)
+
+var (
+	ErrSlugEntityInvalid = errors.New("entity doesn't support slug regeneration")
+)
+
+// slugEntityTables maps the entities with slugs to their table
+var slugEntityTables = map[string]string{
+	"products":      "products",
+	"categories":    "categories",
+	"subcategories": "subcategories",
+}
+
+// SlugChange describes what regenerating a record's slug from its name would do
+type SlugChange struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	CurrentSlug string `json:"current_slug"`
+	// ProposedSlug is the slug generated from the name
+	ProposedSlug string `json:"proposed_slug"`
+	// FinalSlug is the slug that would be written once collisions are suffixed
+	FinalSlug string `json:"final_slug"`
+	Changed   bool   `json:"changed"`
+	Collision bool   `json:"collision"`
+}
+
+// PreviewSlugRegeneration computes the slug every record of entity would get
+// if it was regenerated from its name, flagging the ones that collide with
+// another record's proposed slug. Nothing is written to the database
+func PreviewSlugRegeneration(ctx context.Context, entity string) ([]SlugChange, error) {
+	table, ok := slugEntityTables[entity]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSlugEntityInvalid, entity)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// Order by id so suffixes are assigned deterministically. Subcategories
+	// also need their category's slug, which scopes theirs
+	query := fmt.Sprintf(`SELECT id, name, slug, '' FROM %s ORDER BY id ASC`, table)
+	if entity == "subcategories" {
+		query = `SELECT sc.id, sc.name, sc.slug, COALESCE(c.slug, '')
+		FROM subcategories sc LEFT JOIN categories c ON c.id = sc.category_id
+		ORDER BY sc.id ASC`
+	}
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []SlugChange{}
+	for rows.Next() {
+		var change SlugChange
+		var categorySlug string
+		err := rows.Scan(&change.ID, &change.Name, &change.CurrentSlug, &categorySlug)
+		if err != nil {
+			return nil, err
+		}
+		change.ProposedSlug = utils.Slugify(change.Name)
+		if entity == "subcategories" {
+			change.ProposedSlug = SubcategorySlug(categorySlug, change.Name)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolveSlugCollisions(changes)
+
+	return changes, nil
+}
+
+// resolveSlugCollisions flags the changes whose proposed slug is shared and
+// sets their final slug, suffixing every repeat after the first with a number
+// no other change proposes
+func resolveSlugCollisions(changes []SlugChange) {
+	proposedCount := map[string]int{}
+	for _, change := range changes {
+		proposedCount[change.ProposedSlug]++
+	}
+
+	used := map[string]bool{}
+	seen := map[string]int{}
+	for i := range changes {
+		change := &changes[i]
+		change.Collision = proposedCount[change.ProposedSlug] > 1
+
+		final := change.ProposedSlug
+		seen[final]++
+		if seen[final] > 1 {
+			for n := seen[final]; ; n++ {
+				candidate := fmt.Sprintf("%s-%d", change.ProposedSlug, n)
+				if !used[candidate] && proposedCount[candidate] == 0 {
+					final = candidate
+					break
+				}
+			}
+		}
+		used[final] = true
+
+		change.FinalSlug = final
+		change.Changed = final != change.CurrentSlug
+	}
+}
+
+// SubcategorySlug builds a subcategory's slug from its name, prefixed by the
+// slug of its category so same-named subcategories in different categories
+// don't collide
+func SubcategorySlug(categorySlug, name string) string {
+	slug := utils.Slugify(name)
+	if categorySlug == "" {
+		return slug
+	}
+	return categorySlug + "-" + slug
+}
+
+// uniqueSlug returns slug, suffixed with -2, -3, etc. if another record of
+// entity, other than excludeID, already uses it
+func uniqueSlug(ctx context.Context, conn rowsQuerier, entity, slug, excludeID string) (string, error) {
+	table, ok := slugEntityTables[entity]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSlugEntityInvalid, entity)
+	}
+
+	rows, err := conn.Query(
+		ctx,
+		fmt.Sprintf(`SELECT slug FROM %s
+		WHERE (slug = $1 OR slug LIKE $1 || '-%%') AND id::text != $2`, table),
+		slug,
+		excludeID,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	used := map[string]bool{}
+	for rows.Next() {
+		var taken string
+		if err := rows.Scan(&taken); err != nil {
+			return "", err
+		}
+		used[taken] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	final := slug
+	for n := 2; used[final]; n++ {
+		final = fmt.Sprintf("%s-%d", slug, n)
+	}
+
+	return final, nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import "testing"
+
+func TestResolveSlugCollisions(t *testing.T) {
+	changes := []SlugChange{
+		{ID: "1", CurrentSlug: "mesa", ProposedSlug: "mesa"},
+		{ID: "2", CurrentSlug: "mesa-redonda", ProposedSlug: "mesa"},
+		{ID: "3", CurrentSlug: "mesa-2", ProposedSlug: "mesa-2"},
+		{ID: "4", CurrentSlug: "silla", ProposedSlug: "silla"},
+	}
+	resolveSlugCollisions(changes)
+
+	want := []struct {
+		final     string
+		changed   bool
+		collision bool
+	}{
+		{"mesa", false, true},
+		// mesa-2 is proposed by another record so it's skipped
+		{"mesa-3", true, true},
+		{"mesa-2", false, false},
+		{"silla", false, false},
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.FinalSlug != w.final || c.Changed != w.changed || c.Collision != w.collision {
+			t.Errorf(
+				"change %s: got final %q changed %v collision %v, want %q %v %v",
+				c.ID, c.FinalSlug, c.Changed, c.Collision, w.final, w.changed, w.collision,
+			)
+		}
+	}
+}
+
+func TestSubcategorySlug(t *testing.T) {
+	if got := SubcategorySlug("salas", "Sillas Tiffany"); got != "salas-sillas-tiffany" {
+		t.Errorf("got %q", got)
+	}
+	if got := SubcategorySlug("", "Sillas Tiffany"); got != "sillas-tiffany" {
+		t.Errorf("got %q", got)
+	}
+}
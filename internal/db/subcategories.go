@@ -3,13 +3,16 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	"github.com/vladwithcode/qrcatalog/internal/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrSubcategoryNotFound = errors.New("subcategory not found")
+
 type Subcategory struct {
 	ID              string `db:"id" json:"id"`
 	Name            string `db:"name" json:"name"`
@@ -21,9 +24,11 @@ type Subcategory struct {
 	CategoryID      string `db:"category_id" json:"categoryId"`
 	CategoryName    string `db:"category_name" json:"categoryName"`
 	ProductCount    int    `db:"product_count" json:"productCount"`
+	QRCodeFilename  string `db:"qrcode_filename" json:"qrcodeFilename"`
 }
 
 func CreateSubcategory(subcategory *Subcategory) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -51,9 +56,11 @@ func CreateSubcategory(subcategory *Subcategory) error {
 		Valid:  subcategory.CategoryID != "",
 	}
 
-	if subcategory.Slug == "" {
-		subcategory.Slug = utils.Slugify(subcategory.Name)
+	slug, err := subcategorySlug(ctx, conn, subcategory)
+	if err != nil {
+		return err
 	}
+	subcategory.Slug = slug
 
 	args := pgx.NamedArgs{
 		"id":               id.String(),
@@ -63,12 +70,13 @@ func CreateSubcategory(subcategory *Subcategory) error {
 		"long_description": subcategory.LongDescription,
 		"display_img":      displayImg,
 		"category_id":      categoryID,
+		"qrcode_filename":  subcategory.QRCodeFilename,
 	}
 
 	_, err = conn.Exec(
 		ctx,
-		`INSERT INTO subcategories (id, name, slug, description, long_description, display_img, category_id) 
-		VALUES (@id, @name, @slug, @description, @long_description, @display_img, @category_id)`,
+		`INSERT INTO subcategories (id, name, slug, description, long_description, display_img, category_id, qrcode_filename) 
+		VALUES (@id, @name, @slug, @description, @long_description, @display_img, @category_id, @qrcode_filename)`,
 		args,
 	)
 	if err != nil {
@@ -78,6 +86,29 @@ func CreateSubcategory(subcategory *Subcategory) error {
 	return nil
 }
 
+// subcategorySlug returns the slug to store for the subcategory. When it has
+// none, it's generated from its name scoped by its category's slug. Either
+// way it's suffixed if another subcategory already uses it
+func subcategorySlug(ctx context.Context, conn *pgxpool.Conn, subcategory *Subcategory) (string, error) {
+	slug := subcategory.Slug
+	if slug == "" {
+		var categorySlug string
+		if subcategory.CategoryID != "" {
+			err := conn.QueryRow(
+				ctx,
+				`SELECT COALESCE(slug, '') FROM categories WHERE id = $1`,
+				subcategory.CategoryID,
+			).Scan(&categorySlug)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return "", err
+			}
+		}
+		slug = SubcategorySlug(categorySlug, subcategory.Name)
+	}
+
+	return uniqueSlug(ctx, conn, "subcategories", slug, subcategory.ID)
+}
+
 func FindSubcategoryBySlug(slug string) (*Subcategory, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -103,7 +134,8 @@ func FindSubcategoryBySlug(slug string) (*Subcategory, error) {
 			display.filename AS display_img,
 			display.id AS display_img_id,
 			sc.category_id,
-			c.name AS category_name
+			c.name AS category_name,
+			sc.qrcode_filename
 		FROM subcategories sc
 			LEFT JOIN images display ON display.id = sc.display_img
 			LEFT JOIN categories c ON c.id = sc.category_id
@@ -119,6 +151,7 @@ func FindSubcategoryBySlug(slug string) (*Subcategory, error) {
 		&displayImgID,
 		&categoryID,
 		&categoryName,
+		&subcategory.QRCodeFilename,
 	)
 	if err != nil {
 		return nil, err
@@ -143,6 +176,39 @@ func FindSubcategoryBySlug(slug string) (*Subcategory, error) {
 	return &subcategory, nil
 }
 
+// SubcategoryWithProducts is a subcategory along with a page of its products
+type SubcategoryWithProducts struct {
+	*Subcategory
+	Products *CatalogProductFilterResult `json:"products"`
+}
+
+// FindSubcategoryWithProducts returns the subcategory with the given slug and
+// the requested page of its catalog products
+func FindSubcategoryWithProducts(slug string, page, limit int) (*SubcategoryWithProducts, error) {
+	subcategory, err := FindSubcategoryBySlug(slug)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSubcategoryNotFound
+		}
+		return nil, err
+	}
+
+	products, err := FilterCatalogProducts(CatalogProductFilterParams{
+		Subcategory: subcategory.ID,
+		Page:        page,
+		Limit:       limit,
+		Sort:        "name_asc",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubcategoryWithProducts{
+		Subcategory: subcategory,
+		Products:    products,
+	}, nil
+}
+
 func FindSubcategoryByID(id string) (*Subcategory, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -168,7 +234,8 @@ func FindSubcategoryByID(id string) (*Subcategory, error) {
 			display.filename AS display_img,
 			display.id AS display_img_id,
 			sc.category_id,
-			c.name AS category_name
+			c.name AS category_name,
+			sc.qrcode_filename
 		FROM subcategories sc
 			LEFT JOIN images display ON display.id = sc.display_img
 			LEFT JOIN categories c ON c.id = sc.category_id
@@ -184,6 +251,7 @@ func FindSubcategoryByID(id string) (*Subcategory, error) {
 		&displayImgID,
 		&categoryID,
 		&categoryName,
+		&subcategory.QRCodeFilename,
 	)
 	if err != nil {
 		return nil, err
@@ -225,13 +293,14 @@ func FindAllSubcategories() ([]*Subcategory, error) {
 			display.id AS display_img_id,
 			sc.category_id,
 			c.name AS category_name,
-			COUNT(p.id) AS product_count
+			COUNT(p.id) AS product_count,
+			sc.qrcode_filename
 		FROM subcategories sc
 			LEFT JOIN images display ON display.id = sc.display_img
 			LEFT JOIN categories c ON c.id = sc.category_id
-			LEFT JOIN products p ON p.subcategory_id = sc.id
+			LEFT JOIN products p ON p.subcategory_id = sc.id AND p.deleted_at IS NULL
 		GROUP BY sc.id, sc.name, sc.slug, sc.description, sc.long_description,
-			display.filename, display.id, sc.category_id, c.name
+			display.filename, display.id, sc.category_id, c.name, sc.qrcode_filename
 		ORDER BY c.name, sc.name`,
 	)
 	if err != nil {
@@ -261,6 +330,7 @@ func FindAllSubcategories() ([]*Subcategory, error) {
 			&categoryID,
 			&categoryName,
 			&subcategory.ProductCount,
+			&subcategory.QRCodeFilename,
 		)
 		if err != nil {
 			return nil, err
@@ -305,14 +375,15 @@ func FindSubcategoriesByCategoryID(categoryID string) ([]*Subcategory, error) {
 			display.id AS display_img_id,
 			sc.category_id,
 			c.name AS category_name,
-			COUNT(p.id) AS product_count
+			COUNT(p.id) AS product_count,
+			sc.qrcode_filename
 		FROM subcategories sc
 			LEFT JOIN images display ON display.id = sc.display_img
 			LEFT JOIN categories c ON c.id = sc.category_id
-			LEFT JOIN products p ON p.subcategory_id = sc.id
+			LEFT JOIN products p ON p.subcategory_id = sc.id AND p.deleted_at IS NULL
 		WHERE sc.category_id = $1
 		GROUP BY sc.id, sc.name, sc.slug, sc.description, sc.long_description,
-			display.filename, display.id, sc.category_id, c.name
+			display.filename, display.id, sc.category_id, c.name, sc.qrcode_filename
 		ORDER BY sc.name`,
 		categoryID,
 	)
@@ -343,6 +414,7 @@ func FindSubcategoriesByCategoryID(categoryID string) ([]*Subcategory, error) {
 			&categoryID,
 			&categoryName,
 			&subcategory.ProductCount,
+			&subcategory.QRCodeFilename,
 		)
 		if err != nil {
 			return nil, err
@@ -371,6 +443,7 @@ func FindSubcategoriesByCategoryID(categoryID string) ([]*Subcategory, error) {
 }
 
 func UpdateSubcategory(subcategory *Subcategory) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -393,9 +466,11 @@ func UpdateSubcategory(subcategory *Subcategory) error {
 		Valid:  subcategory.CategoryID != "",
 	}
 
-	if subcategory.Slug == "" {
-		subcategory.Slug = utils.Slugify(subcategory.Name)
+	slug, err := subcategorySlug(ctx, conn, subcategory)
+	if err != nil {
+		return err
 	}
+	subcategory.Slug = slug
 
 	args := pgx.NamedArgs{
 		"id":               subcategory.ID,
@@ -405,13 +480,15 @@ func UpdateSubcategory(subcategory *Subcategory) error {
 		"long_description": subcategory.LongDescription,
 		"display_img":      displayImg,
 		"category_id":      categoryID,
+		"qrcode_filename":  subcategory.QRCodeFilename,
 	}
 
 	_, err = conn.Exec(
 		ctx,
 		`UPDATE subcategories SET
 			name = @name, slug = @slug, description = @description, 
-			long_description = @long_description, display_img = @display_img, category_id = @category_id
+			long_description = @long_description, display_img = @display_img, category_id = @category_id,
+			qrcode_filename = @qrcode_filename
 		WHERE id = @id`,
 		args,
 	)
@@ -423,6 +500,7 @@ func UpdateSubcategory(subcategory *Subcategory) error {
 }
 
 func DeleteSubcategory(id string) error {
+	defer InvalidateCategoryTree()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -490,3 +568,27 @@ func DeleteSubcategoryDisplayImg(subcategoryId string) error {
 
 	return nil
 }
+
+// UpdateSubcategoryQRCode stores the filename of the subcategory's generated qr
+func UpdateSubcategoryQRCode(ctx context.Context, id, filename string) error {
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`UPDATE subcategories SET qrcode_filename = $1 WHERE id = $2`,
+		filename,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSubcategoryNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFindSubcategoryWithProducts(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID := createTestCategory(t)
+	subcategoryID := createTestSubcategory(t, categoryID)
+	otherSubcategoryID := createTestSubcategory(t, categoryID)
+
+	var want []string
+	for range 3 {
+		productID := createTestProductIn(t, categoryID, 1)
+		execTestSQL(t, `UPDATE products SET subcategory_id = $2 WHERE id = $1`, productID, subcategoryID)
+		want = append(want, productID)
+	}
+	other := createTestProductIn(t, categoryID, 1)
+	execTestSQL(t, `UPDATE products SET subcategory_id = $2 WHERE id = $1`, other, otherSubcategoryID)
+
+	slug := "test-subcategory-" + subcategoryID
+	var got []string
+	for page, wantLen := range map[int]int{1: 2, 2: 1} {
+		result, err := FindSubcategoryWithProducts(slug, page, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.ID != subcategoryID {
+			t.Fatalf("got subcategory %q, want %q", result.ID, subcategoryID)
+		}
+		if result.Products.Total != len(want) {
+			t.Errorf("got total %d, want %d", result.Products.Total, len(want))
+		}
+		if len(result.Products.Products) != wantLen {
+			t.Errorf("got %d products on page %d, want %d", len(result.Products.Products), page, wantLen)
+		}
+		for _, product := range result.Products.Products {
+			got = append(got, product.ID)
+		}
+	}
+
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("got products %v, want %v", got, want)
+	}
+}
+
+func TestFindSubcategoryWithProductsNotFound(t *testing.T) {
+	connectTestDB(t)
+
+	_, err := FindSubcategoryWithProducts("missing-subcategory", 1, 10)
+	if !errors.Is(err, ErrSubcategoryNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrSubcategoryNotFound)
+	}
+}
+
+func TestSameNamedSubcategoriesGetDistinctSlugs(t *testing.T) {
+	connectTestDB(t)
+
+	first, second := createTestCategory(t), createTestCategory(t)
+	var slugs []string
+	for _, categoryID := range []string{first, second, second} {
+		subcategory := &Subcategory{Name: "Grandes", CategoryID: categoryID}
+		if err := CreateSubcategory(subcategory); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			execTestSQL(t, `DELETE FROM subcategories WHERE slug = $1`, subcategory.Slug)
+		})
+		slugs = append(slugs, subcategory.Slug)
+	}
+
+	want := []string{
+		"test-category-" + first + "-grandes",
+		"test-category-" + second + "-grandes",
+		"test-category-" + second + "-grandes-2",
+	}
+	if !slices.Equal(slugs, want) {
+		t.Errorf("got slugs %v, want %v", slugs, want)
+	}
+}
@@ -2,13 +2,20 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrLastSuperAdmin = errors.New("can't remove the last super admin")
+)
+
 type User struct {
 	ID       string `db:"id" json:"id"`
 	Fullname string `db:"fullname" json:"fullname"`
@@ -44,9 +51,23 @@ func (u *User) HashPass(pw string) error {
 }
 
 const (
-	RoleAdmin  string = "admin"
-	RoleEditor string = "editor"
-	RoleUser   string = "user"
+	// UsernameMaxLength matches the size of the users.username column
+	UsernameMaxLength = 16
+	// PasswordMaxLength is the most bytes bcrypt takes into account
+	PasswordMaxLength = 72
+)
+
+// NormalizeUsername trims the surrounding whitespace of a username and
+// lowercases it, as usernames are looked up case-insensitively
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+const (
+	RoleSuperAdmin string = "superadmin"
+	RoleAdmin      string = "admin"
+	RoleEditor     string = "editor"
+	RoleUser       string = "user"
 )
 
 type UserDTO struct {
@@ -123,6 +144,9 @@ func GetUserByID(id string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserByUsername finds a user by its username, ignoring case and
+// surrounding whitespace. An exact match is preferred if several users only
+// differ by case
 func GetUserByUsername(username string) (*User, error) {
 	conn, err := GetConn()
 	if err != nil {
@@ -137,8 +161,12 @@ func GetUserByUsername(username string) (*User, error) {
 
 	err = conn.QueryRow(
 		ctx,
-		"SELECT id, fullname, password, username, role, email FROM users WHERE username = $1",
-		username,
+		`SELECT id, fullname, password, username, role, email FROM users
+		WHERE LOWER(username) = $1
+		ORDER BY username = $2 DESC
+		LIMIT 1`,
+		NormalizeUsername(username),
+		strings.TrimSpace(username),
 	).Scan(
 		&user.ID,
 		&user.Fullname,
@@ -155,6 +183,8 @@ func GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// UpdateUser writes the user's data. Demoting the last super admin fails with
+// ErrLastSuperAdmin
 func UpdateUser(user *User) error {
 	conn, err := GetConn()
 	if err != nil {
@@ -165,7 +195,20 @@ func UpdateUser(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	_, err = conn.Exec(
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if user.Role != RoleSuperAdmin {
+		err = guardLastSuperAdmin(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
 		ctx,
 		"UPDATE users SET fullname = $1, password = $2, username = $3, role = $4, email = $5 WHERE id = $6",
 		user.Fullname,
@@ -180,6 +223,73 @@ func UpdateUser(user *User) error {
 		return err
 	}
 
+	return tx.Commit(ctx)
+}
+
+// DeleteUser deletes the user with the given id. Deleting the last super
+// admin fails with ErrLastSuperAdmin
+func DeleteUser(id string) error {
+	conn, err := GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = guardLastSuperAdmin(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// guardLastSuperAdmin returns ErrLastSuperAdmin if the user with the given id
+// is the only super admin left. The super admin rows are locked until the
+// transaction ends so concurrent removals can't both pass the check
+func guardLastSuperAdmin(ctx context.Context, tx pgx.Tx, userID string) error {
+	rows, err := tx.Query(ctx, "SELECT id FROM users WHERE role = $1 FOR UPDATE", RoleSuperAdmin)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		count       int
+		isSuperUser bool
+	)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		count++
+		isSuperUser = isSuperUser || id == userID
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if isSuperUser && count <= 1 {
+		return ErrLastSuperAdmin
+	}
+
 	return nil
 }
 
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestUser inserts a user with the given role, deleting it once the
+// test ends
+func createTestUser(t *testing.T, role string) *User {
+	t.Helper()
+
+	id := uuid.Must(uuid.NewV7()).String()
+	user := &User{
+		ID:       id,
+		Fullname: "Test",
+		Password: "password",
+		Username: "t_" + strings.ReplaceAll(id, "-", "")[18:],
+		Role:     role,
+		Email:    id + "@example.com",
+	}
+	if _, err := CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		execTestSQL(t, `DELETE FROM users WHERE id = $1`, id)
+	})
+
+	return user
+}
+
+func TestRemovingASuperAdminWhenAnotherExists(t *testing.T) {
+	connectTestDB(t)
+
+	createTestUser(t, RoleSuperAdmin)
+	deleted := createTestUser(t, RoleSuperAdmin)
+	demoted := createTestUser(t, RoleSuperAdmin)
+
+	if err := DeleteUser(deleted.ID); err != nil {
+		t.Errorf("DeleteUser: expected the delete to be allowed, got %v", err)
+	}
+
+	demoted.Role = RoleAdmin
+	if err := UpdateUser(demoted); err != nil {
+		t.Errorf("UpdateUser: expected the demotion to be allowed, got %v", err)
+	}
+}
+
+// The last super admin case runs in a transaction that's rolled back, so
+// the super admins already in the database are demoted only inside it
+func TestGuardLastSuperAdmin(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	superAdmin := createTestUser(t, RoleSuperAdmin)
+	admin := createTestUser(t, RoleAdmin)
+
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE users SET role = $1 WHERE role = $2 AND id != $3`, RoleAdmin, RoleSuperAdmin, superAdmin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := guardLastSuperAdmin(ctx, tx, superAdmin.ID); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("expected ErrLastSuperAdmin for the last super admin, got %v", err)
+	}
+	if err := guardLastSuperAdmin(ctx, tx, admin.ID); err != nil {
+		t.Errorf("expected other users to pass, got %v", err)
+	}
+}
+
+func TestDeleteAndDemoteTheLastSuperAdmin(t *testing.T) {
+	connectTestDB(t)
+
+	var others int
+	conn, err := GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.QueryRow(context.Background(), `SELECT COUNT(*) FROM users WHERE role = $1`, RoleSuperAdmin).Scan(&others)
+	conn.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if others > 0 {
+		t.Skip("the test database already has super admins")
+	}
+
+	superAdmin := createTestUser(t, RoleSuperAdmin)
+
+	if err := DeleteUser(superAdmin.ID); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("DeleteUser: expected ErrLastSuperAdmin, got %v", err)
+	}
+
+	superAdmin.Role = RoleAdmin
+	if err := UpdateUser(superAdmin); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Errorf("UpdateUser: expected ErrLastSuperAdmin, got %v", err)
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	if got := NormalizeUsername("  Admin\t"); got != "admin" {
+		t.Errorf("got %q, want admin", got)
+	}
+}
+
+func TestGetUserByUsernameIgnoresCaseAndWhitespace(t *testing.T) {
+	connectTestDB(t)
+
+	user := createTestUser(t, RoleEditor)
+	for _, username := range []string{strings.ToUpper(user.Username), "  " + user.Username + " "} {
+		got, err := GetUserByUsername(username)
+		if err != nil {
+			t.Fatalf("GetUserByUsername(%q): %v", username, err)
+		}
+		if got.ID != user.ID {
+			t.Errorf("GetUserByUsername(%q): got user %s, want %s", username, got.ID, user.ID)
+		}
+	}
+}
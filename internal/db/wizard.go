@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math"
 	"slices"
@@ -13,6 +14,22 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+var (
+	ErrWizardNotFound = errors.New("wizard not found")
+	ErrTooManySteps   = errors.New("wizard has too many steps")
+)
+
+// MaxWizardSteps is the most steps a wizard may have. It can be changed
+// through the MAX_WIZARD_STEPS environment variable
+var MaxWizardSteps = 20
+
+func checkWizardStepCount(count int) error {
+	if count > MaxWizardSteps {
+		return fmt.Errorf("%w: %d, the max is %d", ErrTooManySteps, count, MaxWizardSteps)
+	}
+	return nil
+}
+
 type Wizard struct {
 	ID          string        `json:"id"`
 	Name        string        `json:"name"`
@@ -39,15 +56,20 @@ type WizardStep struct {
 	StepOrder   int       `json:"step_order"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// AvailableProductCount is the number of available, in stock products in
+	// the step's categories. Only filled by GetWizardWithSteps
+	AvailableProductCount int `json:"available_product_count"`
 }
 
 type WizardStepFilterParams struct {
-	Search     string     `json:"search"`
-	SearchMode SearchMode `json:"search_mode"`
-	Categories []string   `json:"categories"`
-	Sort       string     `json:"sort"`
-	Page       int        `json:"page"`
-	Limit      int        `json:"limit"`
+	Search       string     `json:"search"`
+	SearchMode   SearchMode `json:"search_mode"`
+	Categories   []string   `json:"categories"`
+	CategoryName string     `json:"category_name"` // Matches steps with a category whose name contains it
+	Sort         string     `json:"sort"`
+	Page         int        `json:"page"`
+	Limit        int        `json:"limit"`
 }
 
 type WizardStepFilterResult struct {
@@ -63,6 +85,9 @@ type WizardStepFilterResult struct {
 }
 
 func CreateWizard(ctx context.Context, wizard *Wizard) error {
+	if err := checkWizardStepCount(len(wizard.Steps)); err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -176,6 +201,9 @@ func FindWizard(ctx context.Context, id string) (*Wizard, error) {
 }
 
 func UpdateWizard(ctx context.Context, wizard *Wizard) error {
+	if err := checkWizardStepCount(len(wizard.Steps)); err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	conn, err := GetConn()
@@ -292,6 +320,9 @@ func GetWizardWithSteps(ctx context.Context, id string) (*Wizard, error) {
 		&eventKind,
 	)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWizardNotFound
+		}
 		return nil, err
 	}
 
@@ -312,7 +343,13 @@ func GetWizardWithSteps(ctx context.Context, id string) (*Wizard, error) {
 		       COALESCE(wsw.max_selected, ws.max_selected) as max_selected,
 		       ws.created_at, ws.updated_at,
 		       array_remove(array_agg(DISTINCT c.id), NULL) as category_ids,
-		       array_remove(array_agg(DISTINCT c.name), NULL) as categories
+		       array_remove(array_agg(DISTINCT c.name), NULL) as categories,
+		       (
+		           SELECT COUNT(*) FROM catalog_products cp
+		           WHERE cp.category_id IN (
+		               SELECT category_id FROM wizard_step_categories WHERE wizard_step_id = ws.id
+		           ) AND cp.available AND cp.quantity > 0
+		       )::int as available_product_count
 		FROM wizard_steps_wizards wsw
 		JOIN wizard_steps ws ON wsw.wizard_step_id = ws.id
 		LEFT JOIN wizard_step_categories wsc ON ws.id = wsc.wizard_step_id
@@ -349,6 +386,7 @@ func GetWizardWithSteps(ctx context.Context, id string) (*Wizard, error) {
 			&step.UpdatedAt,
 			&categoryIDs,
 			&categories,
+			&step.AvailableProductCount,
 		)
 		if err != nil {
 			return nil, err
@@ -849,6 +887,16 @@ func buildWizardStepQueryConditions(filters WizardStepFilterParams) ([]string, p
 		}
 	}
 
+	// Matched through a subquery so the step's category list stays complete
+	if filters.CategoryName != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM wizard_step_categories name_wsc
+			JOIN categories name_c ON name_c.id = name_wsc.category_id
+			WHERE name_wsc.wizard_step_id = ws.id AND name_c.name ILIKE @category_name
+		)`)
+		namedArgs["category_name"] = "%" + filters.CategoryName + "%"
+	}
+
 	return conditions, namedArgs
 }
 
@@ -1078,7 +1126,31 @@ func AttachStepToWizard(ctx context.Context, wizardID, stepID string, stepParams
 		"max_selected":   stepParams.MaxSelected,
 	}
 
-	_, err = conn.Exec(
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// The wizard row is locked so concurrent attachments can't both pass the
+	// step count check
+	var count int
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COUNT(sw.wizard_step_id)
+		FROM (SELECT id FROM wizards WHERE id = $1 FOR UPDATE) w
+		LEFT JOIN wizard_steps_wizards sw ON sw.wizard_id = w.id AND sw.wizard_step_id != $2`,
+		wizardID,
+		stepID,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if err := checkWizardStepCount(count + 1); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
 		ctx,
 		`INSERT INTO wizard_steps_wizards 
 			(wizard_id, wizard_step_id, required, step_order, multi_select, min_selected, max_selected)
@@ -1092,8 +1164,11 @@ func AttachStepToWizard(ctx context.Context, wizardID, stepID string, stepParams
 			max_selected = EXCLUDED.max_selected`,
 		args,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return tx.Commit(ctx)
 }
 
 func DetachStepFromWizard(ctx context.Context, wizardID, stepID string) error {
@@ -1361,3 +1436,229 @@ func GetWizardSteps(ctx context.Context, wizardID string) ([]*WizardStep, error)
 
 	return steps, nil
 }
+
+// DanglingAssoc is a wizard step association that points at a category
+// that no longer exists
+type DanglingAssoc struct {
+	WizardStepID   string `json:"wizard_step_id"`
+	WizardStepName string `json:"wizard_step_name"`
+	CategoryID     string `json:"category_id"`
+}
+
+// FindDanglingWizardStepCategories returns the wizard step category
+// associations whose category has been deleted
+func FindDanglingWizardStepCategories(ctx context.Context) ([]DanglingAssoc, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT wsc.wizard_step_id, COALESCE(ws.name, ''), wsc.category_id
+		FROM wizard_step_categories wsc
+		LEFT JOIN wizard_steps ws ON ws.id = wsc.wizard_step_id
+		LEFT JOIN categories c ON c.id = wsc.category_id
+		WHERE c.id IS NULL
+		ORDER BY ws.name ASC, wsc.category_id ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dangling := []DanglingAssoc{}
+	for rows.Next() {
+		var assoc DanglingAssoc
+		err := rows.Scan(&assoc.WizardStepID, &assoc.WizardStepName, &assoc.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+		dangling = append(dangling, assoc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return dangling, nil
+}
+
+// RemoveDanglingWizardStepCategories deletes the wizard step category
+// associations whose category has been deleted and returns how many were removed
+func RemoveDanglingWizardStepCategories(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := GetConn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	tag, err := conn.Exec(
+		ctx,
+		`DELETE FROM wizard_step_categories wsc
+		WHERE NOT EXISTS (SELECT 1 FROM categories c WHERE c.id = wsc.category_id)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// WizardStepFeasibility describes whether a step can be completed with the
+// products currently available in its categories
+type WizardStepFeasibility struct {
+	WizardStepID   string `json:"wizard_step_id"`
+	WizardStepName string `json:"wizard_step_name"`
+	MinSelected    int    `json:"min_selected"`
+	MaxSelected    int    `json:"max_selected"`
+	Available      int    `json:"available"`
+	Feasible       bool   `json:"feasible"`
+}
+
+// CheckWizardStepFeasibility compares the min_selected and max_selected of
+// the step, as configured for the wizard, against the count of available
+// products in the step's categories
+func CheckWizardStepFeasibility(ctx context.Context, wizardID, stepID string) (feasible bool, available int, err error) {
+	step, err := GetWizardStepWithDefaults(ctx, wizardID, stepID)
+	if err != nil {
+		return false, 0, err
+	}
+
+	available, err = countAvailableProductsInCategories(ctx, step.CategoryIDs)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return isWizardStepFeasible(step, available), available, nil
+}
+
+// CheckWizardFeasibility runs CheckWizardStepFeasibility over every step of
+// the wizard
+func CheckWizardFeasibility(ctx context.Context, wizardID string) ([]WizardStepFeasibility, error) {
+	steps, err := GetWizardSteps(ctx, wizardID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]WizardStepFeasibility, 0, len(steps))
+	for _, step := range steps {
+		available, err := countAvailableProductsInCategories(ctx, step.CategoryIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, WizardStepFeasibility{
+			WizardStepID:   step.ID,
+			WizardStepName: step.Name,
+			MinSelected:    step.MinSelected,
+			MaxSelected:    step.MaxSelected,
+			Available:      available,
+			Feasible:       isWizardStepFeasible(step, available),
+		})
+	}
+
+	return results, nil
+}
+
+func isWizardStepFeasible(step *WizardStep, available int) bool {
+	return available >= step.MinSelected && available >= step.MaxSelected
+}
+
+func countAvailableProductsInCategories(ctx context.Context, categoryIDs []string) (int, error) {
+	if len(categoryIDs) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	var count int
+	err = conn.QueryRow(
+		ctx,
+		`SELECT COUNT(*) FROM catalog_products
+		WHERE category_id = ANY($1) AND available AND quantity > 0`,
+		categoryIDs,
+	).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// FindProductsNotInAnyWizard returns the available products whose category
+// isn't offered by any step of an enabled wizard, so customers can only
+// reach them through the catalog
+func FindProductsNotInAnyWizard(ctx context.Context) ([]*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := GetConnWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		ctx,
+		`SELECT
+			prod.id, prod.name, COALESCE(prod.slug, ''), prod.description,
+			COALESCE(ctg.id::text, ''), COALESCE(ctg.name, ''),
+			COALESCE(img.filename, ''),
+			prod.available, prod.quantity
+		FROM products prod
+			LEFT JOIN categories ctg ON ctg.id = prod.category_id
+			LEFT JOIN images img ON img.id = prod.main_img_id
+		WHERE prod.available AND prod.deleted_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM wizard_step_categories wsc
+					JOIN wizard_steps_wizards wsw ON wsw.wizard_step_id = wsc.wizard_step_id
+					JOIN wizards w ON w.id = wsw.wizard_id
+				WHERE w.enabled AND wsc.category_id = prod.category_id
+			)
+		ORDER BY ctg.name ASC NULLS FIRST, prod.name ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+	for rows.Next() {
+		var product Product
+		err := rows.Scan(
+			&product.ID,
+			&product.Name,
+			&product.Slug,
+			&product.Description,
+			&product.CategoryID,
+			&product.Category,
+			&product.MainImg,
+			&product.Available,
+			&product.Quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if product.MainImg == "" {
+			product.MainImg = DefaultProductImage
+		}
+		products = append(products, &product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
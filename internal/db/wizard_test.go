@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRemoveDanglingWizardStepCategories(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	if _, err := RemoveDanglingWizardStepCategories(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	dangling, err := FindDanglingWizardStepCategories(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dangling) != 0 {
+		t.Errorf("got %d dangling associations after the cleanup, want 0", len(dangling))
+	}
+
+	removed, err := RemoveDanglingWizardStepCategories(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("second cleanup removed %d associations, want 0", removed)
+	}
+}
+
+func TestFilterWizardStepsByCategoryName(t *testing.T) {
+	connectTestDB(t)
+
+	categoryID, otherID := createTestCategory(t), createTestCategory(t)
+	step := createTestWizardStep(t, &WizardStep{CategoryIDs: []string{categoryID}})
+	createTestWizardStep(t, &WizardStep{CategoryIDs: []string{otherID}})
+
+	// Test category names end in their id
+	result, err := FilterWizardSteps(WizardStepFilterParams{CategoryName: categoryID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.WizardSteps) != 1 || result.WizardSteps[0].ID != step.ID {
+		t.Fatalf("got %d steps, want only %s", len(result.WizardSteps), step.ID)
+	}
+	if got := result.WizardSteps[0].CategoryIDs; len(got) != 1 || got[0] != categoryID {
+		t.Errorf("got categories %v, want [%s]", got, categoryID)
+	}
+
+	// Combined with the id filter both must match
+	result, err = FilterWizardSteps(WizardStepFilterParams{
+		CategoryName: categoryID,
+		Categories:   []string{otherID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.WizardSteps) != 0 {
+		t.Errorf("got %d steps, want none", len(result.WizardSteps))
+	}
+}
+
+func TestIsWizardStepFeasible(t *testing.T) {
+	tests := []struct {
+		name      string
+		min, max  int
+		available int
+		want      bool
+	}{
+		{"enough products", 1, 3, 3, true},
+		{"no limits", 0, 0, 0, true},
+		{"max over available", 1, 5, 3, false},
+		{"min over available", 2, 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := &WizardStep{MinSelected: tt.min, MaxSelected: tt.max}
+			if got := isWizardStepFeasible(step, tt.available); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWizardStepFeasibility(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	categoryID := createTestCategory(t)
+	for range 3 {
+		createTestProductIn(t, categoryID, 1)
+	}
+	// Out of stock products aren't available
+	createTestProductIn(t, categoryID, 0)
+
+	wizard := createTestWizard(t)
+	feasible := createTestWizardStep(t, &WizardStep{CategoryIDs: []string{categoryID}})
+	infeasible := createTestWizardStep(t, &WizardStep{CategoryIDs: []string{categoryID}})
+	if err := AttachStepToWizard(ctx, wizard.ID, feasible.ID, &WizardStep{StepOrder: 1, MaxSelected: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AttachStepToWizard(ctx, wizard.ID, infeasible.ID, &WizardStep{StepOrder: 2, MaxSelected: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		stepID string
+		want   bool
+	}{
+		{"feasible", feasible.ID, true},
+		{"infeasible", infeasible.ID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, available, err := CheckWizardStepFeasibility(ctx, wizard.ID, tt.stepID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || available != 3 {
+				t.Errorf("got feasible %v with %d available, want %v with 3", got, available, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindProductsNotInAnyWizard(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	inWizard, outside, inDisabledWizard := createTestCategory(t), createTestCategory(t), createTestCategory(t)
+	reachable := createTestProductIn(t, inWizard, 1)
+	unreachable := createTestProductIn(t, outside, 1)
+	disabled := createTestProductIn(t, inDisabledWizard, 1)
+
+	wizard := createTestWizard(t)
+	step := createTestWizardStep(t, &WizardStep{CategoryIDs: []string{inWizard}})
+	if err := AttachStepToWizard(ctx, wizard.ID, step.ID, &WizardStep{StepOrder: 1}); err != nil {
+		t.Fatal(err)
+	}
+	disabledWizard := createTestWizard(t)
+	execTestSQL(t, `UPDATE wizards SET enabled = false WHERE id = $1`, disabledWizard.ID)
+	disabledStep := createTestWizardStep(t, &WizardStep{CategoryIDs: []string{inDisabledWizard}})
+	if err := AttachStepToWizard(ctx, disabledWizard.ID, disabledStep.ID, &WizardStep{StepOrder: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	products, err := FindProductsNotInAnyWizard(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, product := range products {
+		found[product.ID] = true
+	}
+	if found[reachable] {
+		t.Error("expected the product in a wizard category to be left out")
+	}
+	if !found[unreachable] {
+		t.Error("expected the product outside every wizard to be found")
+	}
+	if !found[disabled] {
+		t.Error("expected the product only in a disabled wizard to be found")
+	}
+}
+
+func TestGetWizardWithStepsCountsAvailableProducts(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	first, second := createTestCategory(t), createTestCategory(t)
+	for range 3 {
+		createTestProductIn(t, first, 1)
+	}
+	// Out of stock and unavailable products aren't counted
+	createTestProductIn(t, first, 0)
+	unavailable := createTestProductIn(t, first, 1)
+	execTestSQL(t, `UPDATE products SET available = false WHERE id = $1`, unavailable)
+	createTestProductIn(t, second, 2)
+
+	wizard := createTestWizard(t)
+	firstStep := createTestWizardStep(t, &WizardStep{CategoryIDs: []string{first}})
+	bothStep := createTestWizardStep(t, &WizardStep{CategoryIDs: []string{first, second}})
+	if err := AttachStepToWizard(ctx, wizard.ID, firstStep.ID, &WizardStep{StepOrder: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AttachStepToWizard(ctx, wizard.ID, bothStep.ID, &WizardStep{StepOrder: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetWizardWithSteps(ctx, wizard.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{firstStep.ID: 3, bothStep.ID: 4}
+	if len(got.Steps) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(got.Steps), len(want))
+	}
+	for _, step := range got.Steps {
+		if step.AvailableProductCount != want[step.ID] {
+			t.Errorf("got %d available products for step %s, want %d", step.AvailableProductCount, step.ID, want[step.ID])
+		}
+	}
+}
+
+func TestGetWizardWithStepsNotFound(t *testing.T) {
+	connectTestDB(t)
+
+	_, err := GetWizardWithSteps(context.Background(), "00000000-0000-0000-0000-000000000000")
+	if !errors.Is(err, ErrWizardNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrWizardNotFound)
+	}
+}
+
+// useMaxWizardSteps sets MaxWizardSteps for the test
+func useMaxWizardSteps(t *testing.T, max int) {
+	t.Helper()
+
+	prev := MaxWizardSteps
+	t.Cleanup(func() { MaxWizardSteps = prev })
+	MaxWizardSteps = max
+}
+
+func TestCheckWizardStepCount(t *testing.T) {
+	useMaxWizardSteps(t, 3)
+
+	if err := checkWizardStepCount(3); err != nil {
+		t.Errorf("got error %v at the limit", err)
+	}
+	if err := checkWizardStepCount(4); !errors.Is(err, ErrTooManySteps) {
+		t.Errorf("got error %v over the limit, want %v", err, ErrTooManySteps)
+	}
+
+	wizard := &Wizard{Name: "test-wizard", Steps: make([]*WizardStep, 4)}
+	if err := CreateWizard(context.Background(), wizard); !errors.Is(err, ErrTooManySteps) {
+		t.Errorf("got error %v creating a wizard over the limit, want %v", err, ErrTooManySteps)
+	}
+}
+
+func TestSetDBParametersReadsTheMaxWizardSteps(t *testing.T) {
+	useMaxWizardSteps(t, 20)
+
+	t.Setenv(EnvVarMaxWizardSteps, "0")
+	SetDBParameters()
+	if MaxWizardSteps != 20 {
+		t.Errorf("got %d, want an invalid value to be ignored", MaxWizardSteps)
+	}
+
+	t.Setenv(EnvVarMaxWizardSteps, "5")
+	SetDBParameters()
+	if MaxWizardSteps != 5 {
+		t.Errorf("got %d, want 5", MaxWizardSteps)
+	}
+}
+
+func TestAttachStepToWizardEnforcesTheLimit(t *testing.T) {
+	connectTestDB(t)
+	useMaxWizardSteps(t, 2)
+	ctx := context.Background()
+
+	wizard := createTestWizard(t)
+	for i := range 2 {
+		step := createTestWizardStep(t, &WizardStep{})
+		if err := AttachStepToWizard(ctx, wizard.ID, step.ID, &WizardStep{StepOrder: i + 1}); err != nil {
+			t.Fatalf("attaching step %d: %v", i+1, err)
+		}
+		// Reattaching an attached step doesn't count it twice
+		if err := AttachStepToWizard(ctx, wizard.ID, step.ID, &WizardStep{StepOrder: i + 1}); err != nil {
+			t.Fatalf("reattaching step %d: %v", i+1, err)
+		}
+	}
+
+	step := createTestWizardStep(t, &WizardStep{})
+	err := AttachStepToWizard(ctx, wizard.ID, step.ID, &WizardStep{StepOrder: 3})
+	if !errors.Is(err, ErrTooManySteps) {
+		t.Errorf("got error %v over the limit, want %v", err, ErrTooManySteps)
+	}
+}
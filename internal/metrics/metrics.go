@@ -0,0 +1,69 @@
+// Package metrics keeps lightweight in-process counters for requests,
+// database errors and cache usage
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	startedAt = time.Now()
+
+	requests      sync.Map // route pattern -> *atomic.Int64
+	totalRequests atomic.Int64
+	serverErrors  atomic.Int64
+	dbErrors      atomic.Int64
+	cacheHits     atomic.Int64
+	cacheMisses   atomic.Int64
+	eventsEmitted atomic.Int64
+)
+
+// Snapshot is a point in time copy of every counter
+type Snapshot struct {
+	UptimeSeconds int64            `json:"uptime_seconds"`
+	TotalRequests int64            `json:"total_requests"`
+	Requests      map[string]int64 `json:"requests"`
+	ServerErrors  int64            `json:"server_errors"`
+	DBErrors      int64            `json:"db_errors"`
+	CacheHits     int64            `json:"cache_hits"`
+	CacheMisses   int64            `json:"cache_misses"`
+	EventsEmitted int64            `json:"events_emitted"`
+}
+
+// IncRequest counts a request served by the given route pattern
+func IncRequest(route string) {
+	totalRequests.Add(1)
+	counter, ok := requests.Load(route)
+	if !ok {
+		counter, _ = requests.LoadOrStore(route, &atomic.Int64{})
+	}
+	counter.(*atomic.Int64).Add(1)
+}
+
+func IncServerError() { serverErrors.Add(1) }
+func IncDBError()     { dbErrors.Add(1) }
+func IncCacheHit()    { cacheHits.Add(1) }
+func IncCacheMiss()   { cacheMisses.Add(1) }
+func IncEvent()       { eventsEmitted.Add(1) }
+
+// Read returns a snapshot of the current counters
+func Read() Snapshot {
+	snap := Snapshot{
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+		TotalRequests: totalRequests.Load(),
+		Requests:      map[string]int64{},
+		ServerErrors:  serverErrors.Load(),
+		DBErrors:      dbErrors.Load(),
+		CacheHits:     cacheHits.Load(),
+		CacheMisses:   cacheMisses.Load(),
+		EventsEmitted: eventsEmitted.Load(),
+	}
+	requests.Range(func(key, value any) bool {
+		snap.Requests[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+
+	return snap
+}
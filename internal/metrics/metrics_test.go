@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestIncRequestIsConcurrencySafe(t *testing.T) {
+	before := Read()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				IncRequest("GET /test/concurrent")
+			}
+		}()
+	}
+	wg.Wait()
+
+	after := Read()
+	if got := after.Requests["GET /test/concurrent"] - before.Requests["GET /test/concurrent"]; got != 5000 {
+		t.Errorf("got %d route requests, want 5000", got)
+	}
+	if got := after.TotalRequests - before.TotalRequests; got != 5000 {
+		t.Errorf("got %d total requests, want 5000", got)
+	}
+}
+
+func TestCountersAreReported(t *testing.T) {
+	before := Read()
+
+	IncServerError()
+	IncDBError()
+	IncCacheHit()
+	IncCacheHit()
+	IncCacheMiss()
+	IncEvent()
+
+	after := Read()
+	checks := []struct {
+		name          string
+		before, after int64
+		want          int64
+	}{
+		{"server errors", before.ServerErrors, after.ServerErrors, 1},
+		{"db errors", before.DBErrors, after.DBErrors, 1},
+		{"cache hits", before.CacheHits, after.CacheHits, 2},
+		{"cache misses", before.CacheMisses, after.CacheMisses, 1},
+		{"events", before.EventsEmitted, after.EventsEmitted, 1},
+	}
+	for _, c := range checks {
+		if got := c.after - c.before; got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestReadReturnsACopy(t *testing.T) {
+	IncRequest("GET /test/copy")
+	snap := Read()
+	snap.Requests["GET /test/copy"] = 1000
+
+	if got := Read().Requests["GET /test/copy"]; got == 1000 {
+		t.Error("modifying the snapshot changed the counters")
+	}
+}
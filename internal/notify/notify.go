@@ -0,0 +1,108 @@
+// Package notify contains a small in-process event bus used to let
+// integrations (webhooks, logging, etc.) know about domain events
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vladwithcode/qrcatalog/internal/metrics"
+)
+
+type EventType string
+
+const (
+	// EventProductSoldOut fires when a product's quantity transitions to zero
+	EventProductSoldOut EventType = "product.sold_out"
+)
+
+const EnvVarWebhookURL = "NOTIFY_WEBHOOK_URL"
+
+type Event struct {
+	Type       EventType      `json:"type"`
+	Payload    map[string]any `json:"payload"`
+	OccurredAt time.Time      `json:"occurred_at"`
+}
+
+type Handler func(Event)
+
+var (
+	mu       sync.RWMutex
+	handlers = map[EventType][]Handler{}
+	global   []Handler
+)
+
+// Subscribe registers h to be called for events of the given type
+func Subscribe(eventType EventType, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[eventType] = append(handlers[eventType], h)
+}
+
+// SubscribeAll registers h to be called for every emitted event
+func SubscribeAll(h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	global = append(global, h)
+}
+
+// Emit delivers the event to every subscribed handler. Handlers run
+// synchronously, so slow handlers should do their work in a goroutine
+func Emit(eventType EventType, payload map[string]any) {
+	e := Event{
+		Type:       eventType,
+		Payload:    payload,
+		OccurredAt: time.Now(),
+	}
+
+	mu.RLock()
+	hs := make([]Handler, 0, len(handlers[eventType])+len(global))
+	hs = append(hs, handlers[eventType]...)
+	hs = append(hs, global...)
+	mu.RUnlock()
+
+	metrics.IncEvent()
+	for _, h := range hs {
+		h(e)
+	}
+}
+
+// SetNotifyParameters reads the notify configuration from the environment
+// and subscribes the webhook handler if a webhook url is set
+func SetNotifyParameters() {
+	webhookURL := os.Getenv(EnvVarWebhookURL)
+	if webhookURL != "" {
+		SubscribeAll(NewWebhookHandler(webhookURL))
+	}
+}
+
+// NewWebhookHandler returns a handler that POSTs every event as JSON to url
+func NewWebhookHandler(url string) Handler {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return func(e Event) {
+		body, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("failed to marshal %s event: %v\n", e.Type, err)
+			return
+		}
+
+		go func() {
+			res, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("failed to deliver %s event: %v\n", e.Type, err)
+				return
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode >= 300 {
+				log.Printf("webhook responded %d to %s event\n", res.StatusCode, e.Type)
+			}
+		}()
+	}
+}
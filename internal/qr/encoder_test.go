@@ -0,0 +1,117 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomonRemainder(data, reedSolomonDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDrawFormatBits(t *testing.T) {
+	// Format strings for mask 0 as listed in the standard
+	want := map[Level]int{
+		LevelL: 0b111011111000100,
+		LevelM: 0b101010000010010,
+		LevelQ: 0b011010101011111,
+		LevelH: 0b001011010001001,
+	}
+
+	for level, bits := range want {
+		c := newCode(1, level)
+		c.drawFormatBits(0)
+
+		var first, second int
+		for i := 0; i <= 5; i++ {
+			first |= b2i(c.Dark(8, i)) << i
+		}
+		first |= b2i(c.Dark(8, 7)) << 6
+		first |= b2i(c.Dark(8, 8)) << 7
+		first |= b2i(c.Dark(7, 8)) << 8
+		for i := 9; i < 15; i++ {
+			first |= b2i(c.Dark(14-i, 8)) << i
+		}
+		for i := 0; i < 8; i++ {
+			second |= b2i(c.Dark(c.Size-1-i, 8)) << i
+		}
+		for i := 8; i < 15; i++ {
+			second |= b2i(c.Dark(8, c.Size-15+i)) << i
+		}
+
+		if first != bits || second != bits {
+			t.Errorf("level %d: got %015b and %015b, want %015b", level, first, second, bits)
+		}
+	}
+}
+
+func TestEncodePicksTheSmallestVersion(t *testing.T) {
+	tests := []struct {
+		length  int
+		level   Level
+		version int
+	}{
+		{17, LevelL, 1},
+		{18, LevelL, 2},
+		{7, LevelH, 1},
+		{8, LevelH, 2},
+		{2953, LevelL, 40},
+	}
+
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte("a"), tt.length), tt.level)
+		if err != nil {
+			t.Fatalf("%d bytes at level %d: %v", tt.length, tt.level, err)
+		}
+		if c.Version != tt.version {
+			t.Errorf("%d bytes at level %d: got version %d, want %d", tt.length, tt.level, c.Version, tt.version)
+		}
+		if c.Size != tt.version*4+17 {
+			t.Errorf("version %d: got size %d", c.Version, c.Size)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	if _, err := Encode(bytes.Repeat([]byte("a"), 2954), LevelL); !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("expected ErrDataTooLong, got %v", err)
+	}
+	if _, err := Encode([]byte("a"), Level(4)); !errors.Is(err, ErrLevelInvalid) {
+		t.Errorf("expected ErrLevelInvalid, got %v", err)
+	}
+}
+
+func TestEncodeDrawsFinderPatterns(t *testing.T) {
+	c, err := Encode([]byte("https://example.com/catalogo/producto/mesa"), LevelM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corners := [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}}
+	for _, corner := range corners {
+		for dy := range 7 {
+			for dx := range 7 {
+				dist := max(abs(dx-3), abs(dy-3))
+				want := dist != 2
+				if got := c.Dark(corner[0]+dx, corner[1]+dy); got != want {
+					t.Fatalf("finder at %v: module %d,%d is %v, want %v", corner, dx, dy, got, want)
+				}
+			}
+		}
+	}
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,332 @@
+// Package qr provides functions to generate the qr codes of the catalog
+// products as png images
+package qr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/vladwithcode/qrcatalog/internal/db"
+	"github.com/vladwithcode/qrcatalog/internal/uploads"
+)
+
+const (
+	DefaultSize  = 512
+	DefaultLevel = LevelM
+	MinSize      = 64
+	MaxSize      = 4096
+
+	// quietZone is the light border, in modules, required around the code
+	quietZone = 4
+
+	// CatalogPath is the path of the public catalog, relative to the base url.
+	// Categories live at /catalogo/{category} and their subcategories at
+	// /catalogo/{category}/{subcategory}
+	CatalogPath = "/catalogo/"
+
+	// ProductPath is the path of the public product page, relative to the
+	// base url
+	ProductPath = "/catalogo/producto/"
+)
+
+const (
+	EnvVarBaseURL  = "QR_BASE_URL"
+	EnvVarLogoPath = "QR_LOGO_PATH"
+)
+
+// BaseURL is the public url of the catalog encoded in the product qr codes.
+// It must be set, codes aren't generated without it
+var BaseURL string
+
+// DefaultLogoPath is used as the logo of the codes that don't set one
+var DefaultLogoPath string
+
+// SetQRParameters reads the qr configuration from the environment
+func SetQRParameters() {
+	BaseURL = os.Getenv(EnvVarBaseURL)
+	DefaultLogoPath = os.Getenv(EnvVarLogoPath)
+}
+
+var (
+	ErrSlugMissing     = errors.New("record has no slug")
+	ErrCategoryMissing = errors.New("subcategory has no category")
+	ErrBaseURLMissing  = errors.New(EnvVarBaseURL + " is not set")
+	ErrSizeInvalid     = fmt.Errorf("size must be between %d and %d pixels", MinSize, MaxSize)
+)
+
+// Options controls how the qr images are generated. Zero values use the
+// defaults
+type Options struct {
+	// Size is the width and height of the image in pixels
+	Size  int
+	Level Level
+	// LogoPath is a png drawn over the center of the code. Level is forced to
+	// LevelH when set so the code stays readable
+	LogoPath string
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Size == 0 {
+		o.Size = DefaultSize
+	}
+	if o.LogoPath == "" {
+		o.LogoPath = DefaultLogoPath
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return o, ErrSizeInvalid
+	}
+	if o.Level < LevelL || o.Level > LevelH {
+		return o, ErrLevelInvalid
+	}
+	return o, nil
+}
+
+// ParseLevel parses a level name (L, M, Q or H), case insensitive. An empty
+// name returns DefaultLevel
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(name) {
+	case "":
+		return DefaultLevel, nil
+	case "L":
+		return LevelL, nil
+	case "M":
+		return LevelM, nil
+	case "Q":
+		return LevelQ, nil
+	case "H":
+		return LevelH, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrLevelInvalid, name)
+}
+
+// ProductURL returns the public catalog url of the product with the given slug
+func ProductURL(baseURL, slug string) string {
+	return strings.TrimRight(baseURL, "/") + ProductPath + url.PathEscape(slug)
+}
+
+// ProductQRFilename returns the filename used for the qr of the product. It's
+// stable so regenerating a qr overwrites the previous image
+func ProductQRFilename(productID string) string {
+	return fmt.Sprintf("qr_product_%s.png", productID)
+}
+
+// GenerateProductQR encodes the public url of the product into a png and
+// writes it to the uploads directory, returning the written file so its
+// filename can be stored as the product's qrcode_filename
+func GenerateProductQR(product *db.Product, baseURL string, opts Options) (*uploads.WrittenFile, error) {
+	if product.Slug == "" {
+		return nil, fmt.Errorf("%w: product %s", ErrSlugMissing, product.ID)
+	}
+
+	img, err := PNG(ProductURL(baseURL, product.Slug), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploads.WriteBytes(ProductQRFilename(product.ID), img)
+}
+
+// CategoryURL returns the public catalog url of the category
+func CategoryURL(baseURL, categorySlug string) string {
+	return strings.TrimRight(baseURL, "/") + CatalogPath + url.PathEscape(categorySlug)
+}
+
+// SubcategoryURL returns the public catalog url of the subcategory, nested
+// under its category
+func SubcategoryURL(baseURL, categorySlug, subcategorySlug string) string {
+	return CategoryURL(baseURL, categorySlug) + "/" + url.PathEscape(subcategorySlug)
+}
+
+// GenerateCategoryQR encodes the public url of the category into a png and
+// writes it to the uploads directory, overwriting any previous one
+func GenerateCategoryQR(category *db.Category, baseURL string, opts Options) (*uploads.WrittenFile, error) {
+	if category.Slug == "" {
+		return nil, fmt.Errorf("%w: category %s", ErrSlugMissing, category.ID)
+	}
+
+	img, err := PNG(CategoryURL(baseURL, category.Slug), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploads.WriteBytes(fmt.Sprintf("qr_category_%s.png", category.ID), img)
+}
+
+// GenerateSubcategoryQR encodes the public url of the subcategory into a png
+// and writes it to the uploads directory, overwriting any previous one. The
+// slug of the parent category is read from the database
+func GenerateSubcategoryQR(subcategory *db.Subcategory, baseURL string, opts Options) (*uploads.WrittenFile, error) {
+	if subcategory.Slug == "" {
+		return nil, fmt.Errorf("%w: subcategory %s", ErrSlugMissing, subcategory.ID)
+	}
+	if subcategory.CategoryID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrCategoryMissing, subcategory.ID)
+	}
+
+	category, err := db.FindCategoryByID(subcategory.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	if category.Slug == "" {
+		return nil, fmt.Errorf("%w: category %s", ErrSlugMissing, category.ID)
+	}
+
+	img, err := PNG(SubcategoryURL(baseURL, category.Slug, subcategory.Slug), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploads.WriteBytes(fmt.Sprintf("qr_subcategory_%s.png", subcategory.ID), img)
+}
+
+// RegenerateQRCodesForCategory regenerates the qr of every product in the
+// category and stores the new filenames. A product failing doesn't stop the
+// run, it's logged and its id is returned in failed
+func RegenerateQRCodesForCategory(ctx context.Context, categoryID, baseURL string) (regenerated int, failed []string, err error) {
+	products, err := db.FindCategoryProductSlugs(ctx, categoryID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	failed = []string{}
+	for _, product := range products {
+		written, err := GenerateProductQR(product, baseURL, Options{})
+		if err == nil {
+			err = db.UpdateProductQRCode(ctx, product.ID, written.Filename)
+		}
+		if err != nil {
+			log.Printf("failed to regenerate qr of product %s: %v\n", product.ID, err)
+			failed = append(failed, product.ID)
+			continue
+		}
+		regenerated++
+	}
+
+	return regenerated, failed, nil
+}
+
+// PNG encodes content as a qr code and returns it as a png image
+func PNG(content string, opts Options) ([]byte, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	var logo image.Image
+	if opts.LogoPath != "" {
+		logo, err = loadLogo(opts.LogoPath)
+		if err != nil {
+			log.Printf("failed to load qr logo, generating a plain qr: %v\n", err)
+		} else {
+			opts.Level = LevelH
+		}
+	}
+
+	code, err := Encode([]byte(content), opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var img image.Image = code.Image(opts.Size)
+	if logo != nil {
+		img = code.withLogo(img, logo)
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func loadLogo(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+// Image renders the code with its quiet zone, centered in a size x size image.
+// Modules are scaled to the biggest whole number of pixels that fits
+func (c *Code) Image(size int) *image.Paletted {
+	scale, offset := c.layout(size)
+	size = max(size, (c.Size+quietZone*2)*scale)
+
+	img := image.NewPaletted(
+		image.Rect(0, 0, size, size),
+		color.Palette{color.White, color.Black},
+	)
+	for py := range size {
+		y := (py-offset)/scale - quietZone
+		for px := range size {
+			x := (px-offset)/scale - quietZone
+			if py >= offset && px >= offset && c.Dark(x, y) {
+				img.SetColorIndex(px, py, 1)
+			}
+		}
+	}
+
+	return img
+}
+
+// layout returns the pixels per module and the offset of the quiet zone when
+// rendering the code in a size x size image
+func (c *Code) layout(size int) (scale, offset int) {
+	modules := c.Size + quietZone*2
+	scale = max(size/modules, 1)
+	offset = max(size-modules*scale, 0) / 2
+	return scale, offset
+}
+
+// logoAreaRatio is the share of the code area covered by the logo
+const logoAreaRatio = 0.2
+
+// withLogo returns a copy of img, a render of the code, with the logo scaled
+// to cover about logoAreaRatio of the code and drawn over its center on a
+// white background
+func (c *Code) withLogo(img image.Image, logo image.Image) image.Image {
+	scale, offset := c.layout(img.Bounds().Dx())
+	codeStart := offset + quietZone*scale
+	codeSide := c.Size * scale
+
+	side := int(float64(codeSide) * math.Sqrt(logoAreaRatio))
+	start := codeStart + (codeSide-side)/2
+	area := image.Rect(start, start, start+side, start+side)
+
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, image.Point{}, draw.Src)
+	draw.Draw(out, area.Inset(-scale), image.White, image.Point{}, draw.Src)
+	draw.Draw(out, area, scaleImage(logo, side, side), image.Point{}, draw.Over)
+
+	return out
+}
+
+// scaleImage resizes src to w x h using nearest neighbor sampling
+func scaleImage(src image.Image, w, h int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		sy := b.Min.Y + y*b.Dy()/h
+		for x := range w {
+			sx := b.Min.X + x*b.Dx()/w
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,62 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]Level{"": DefaultLevel, "l": LevelL, "M": LevelM, "q": LevelQ, "H": LevelH}
+	for name, want := range tests {
+		got, err := ParseLevel(name)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseLevel("X"); !errors.Is(err, ErrLevelInvalid) {
+		t.Errorf("expected ErrLevelInvalid, got %v", err)
+	}
+}
+
+func TestURLs(t *testing.T) {
+	tests := []struct{ got, want string }{
+		{ProductURL("https://catalogo.example.com/", "mesa redonda"), "https://catalogo.example.com/catalogo/producto/mesa%20redonda"},
+		{CategoryURL("https://catalogo.example.com", "mesas"), "https://catalogo.example.com/catalogo/mesas"},
+		{SubcategoryURL("https://catalogo.example.com", "mesas", "mesas-redondas"), "https://catalogo.example.com/catalogo/mesas/mesas-redondas"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	data, err := PNG("https://catalogo.example.com/catalogo/producto/mesa", Options{Size: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+		t.Errorf("got %dx%d image, want 300x300", b.Dx(), b.Dy())
+	}
+	// The quiet zone keeps the corners light
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Error("expected the top left corner to be light")
+	}
+}
+
+func TestPNGRejectsInvalidSizes(t *testing.T) {
+	for _, size := range []int{MinSize - 1, MaxSize + 1} {
+		if _, err := PNG("x", Options{Size: size}); !errors.Is(err, ErrSizeInvalid) {
+			t.Errorf("size %d: expected ErrSizeInvalid, got %v", size, err)
+		}
+	}
+}
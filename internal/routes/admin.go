@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vladwithcode/qrcatalog/internal/auth"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+	"github.com/vladwithcode/qrcatalog/internal/metrics"
+)
+
+func RegisterAdminRoutes(router *customServeMux) {
+	router.HandleFunc("GET /api/admin/metrics", auth.RequireAccess(auth.AccessLevelSuperAdmin, GetMetrics))
+	router.HandleFunc("POST /api/admin/search-vectors/{entity}/rebuild", auth.RequireAccess(auth.AccessLevelSuperAdmin, RebuildSearchVectors))
+	router.HandleFunc("GET /api/admin/products/uncategorized", auth.RequireAccess(auth.AccessLevelSuperAdmin, GetUncategorizedProducts))
+	router.HandleFunc("GET /api/admin/products/not-in-wizard", auth.RequireAccess(auth.AccessLevelSuperAdmin, GetProductsNotInAnyWizard))
+	router.HandleFunc("GET /api/admin/settings", auth.RequireAccess(auth.AccessLevelAdmin, GetSettings))
+	router.HandleFunc("PUT /api/admin/settings/{key}", auth.RequireAccess(auth.AccessLevelAdmin, UpdateSetting))
+}
+
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	resData := map[string]any{
+		"metrics": metrics.Read(),
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func RebuildSearchVectors(w http.ResponseWriter, r *http.Request) {
+	updated, err := db.RebuildSearchVectors(r.Context(), r.PathValue("entity"))
+	if err != nil {
+		if errors.Is(err, db.ErrSearchEntityInvalid) {
+			respondWithError(w, r, http.StatusBadRequest, "La entidad no admite búsqueda", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"updated": updated,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GetUncategorizedProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := db.FindUncategorizedProducts(r.Context())
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"products": products,
+		"total":    len(products),
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GetProductsNotInAnyWizard(w http.ResponseWriter, r *http.Request) {
+	products, err := db.FindProductsNotInAnyWizard(r.Context())
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"products": products,
+		"total":    len(products),
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := db.FindSettings(r.Context())
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"settings": settings,
+		"options":  db.SettingOptions(),
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func UpdateSetting(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Value string `json:"value"`
+	}
+	msg, err := decodeJSONBody(r, &data)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	err = db.SetSetting(r.Context(), r.PathValue("key"), data.Value)
+	if err != nil {
+		if errors.Is(err, db.ErrSettingUnknown) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró la configuración", err)
+			return
+		}
+		if errors.Is(err, db.ErrSettingInvalid) {
+			respondWithError(w, r, http.StatusBadRequest, "El valor no es válido para esta configuración", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{"success": true})
+}
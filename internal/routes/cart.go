@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vladwithcode/qrcatalog/internal/auth"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+func RegisterCartRoutes(router *customServeMux) {
+	router.HandleFunc("GET /api/cart/validate", publicMiddleware(ValidateCart))
+	router.HandleFunc("POST /api/cart/share", publicMiddleware(ShareCart))
+	router.HandleFunc("PUT /api/cart/customer", publicMiddleware(UpdateCartCustomer))
+	router.HandleFunc("GET /api/carts/by-customer", auth.ValidateAuth(GetCustomerCarts))
+	// Not wrapped in publicMiddleware so the viewer doesn't adopt the shared cart
+	router.HandleFunc("GET /api/cart/shared/{token}", GetSharedCart)
+}
+
+// GetCustomerCarts lists the active carts of a customer by phone and/or
+// email, so staff can follow up on them
+func GetCustomerCarts(w http.ResponseWriter, r *http.Request) {
+	carts, err := db.FindCartsByCustomer(
+		r.Context(),
+		r.URL.Query().Get("phone"),
+		r.URL.Query().Get("email"),
+	)
+	if err != nil {
+		if errors.Is(err, db.ErrCartContactMissing) {
+			respondWithError(w, r, http.StatusBadRequest, "Se requiere un teléfono o correo", err)
+			return
+		}
+		if errors.Is(err, db.ErrCartContactInvalid) {
+			respondWithError(w, r, http.StatusBadRequest, "El teléfono no es válido", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{
+		"carts": carts,
+	})
+}
+
+func ValidateCart(w http.ResponseWriter, r *http.Request) {
+	cartID, err := db.GetCartIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "No se encontró el carrito", err)
+		return
+	}
+
+	validation, err := db.ValidateCart(r.Context(), cartID)
+	if err != nil {
+		if errors.Is(err, db.ErrCartNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el carrito", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"validation": validation,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func ShareCart(w http.ResponseWriter, r *http.Request) {
+	cartID, err := db.GetCartIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "No se encontró el carrito", err)
+		return
+	}
+
+	token, err := auth.CreateCartShareToken(r.Context(), cartID)
+	if err != nil {
+		if errors.Is(err, db.ErrCartNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el carrito", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"token":      token,
+		"expires_in": int(auth.CartShareTokenDuration.Seconds()),
+	}
+	respondWithJSON(w, r, http.StatusCreated, resData)
+}
+
+func UpdateCartCustomer(w http.ResponseWriter, r *http.Request) {
+	cartID, err := db.GetCartIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "No se encontró el carrito", err)
+		return
+	}
+
+	var data struct {
+		Name  string `json:"customer_name"`
+		Email string `json:"customer_email"`
+		Phone string `json:"customer_phone"`
+	}
+	msg, err := decodeJSONBody(r, &data)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	err = db.UpdateCartCustomer(r.Context(), cartID, data.Name, data.Email, data.Phone)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrCartIDInvalidMissing):
+			respondWithError(w, r, http.StatusBadRequest, "No se encontró el carrito", err)
+		case errors.Is(err, db.ErrCartContactInvalid):
+			respondWithError(w, r, http.StatusBadRequest, "El correo o teléfono no son válidos", err)
+		case errors.Is(err, db.ErrCartSubmitted):
+			respondWithError(w, r, http.StatusConflict, "El carrito ya fue enviado", err)
+		default:
+			respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		}
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{"success": true})
+}
+
+func GetSharedCart(w http.ResponseWriter, r *http.Request) {
+	shareID, err := auth.ParseCartShareToken(r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, auth.ErrCartShareTokenExpired) {
+			respondWithError(w, r, http.StatusGone, "El enlace del carrito ha expirado", err)
+			return
+		}
+		respondWithError(w, r, http.StatusBadRequest, "El enlace del carrito no es válido", err)
+		return
+	}
+
+	cart, err := db.FindSharedCart(r.Context(), shareID)
+	if err != nil {
+		if errors.Is(err, db.ErrCartNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el carrito", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"cart":      cart,
+		"read_only": true,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+func RegisterCatalogRoutes(router *customServeMux) {
+	router.HandleFunc("GET /api/catalog/tree", GetCatalogTree)
+	router.HandleFunc("GET /api/catalog/product/{id}", GetCatalogProduct)
+	router.HandleFunc("GET /api/catalog/featured", GetFeaturedCatalogProducts)
+	router.HandleFunc("GET /api/catalog/products", GetCatalogProducts)
+	router.HandleFunc("GET /api/catalog/products/by-slug", GetCatalogProductsBySlugs)
+	router.HandleFunc("GET /api/catalog/products/stock", GetCatalogStockLevels)
+	router.HandleFunc("GET /api/catalog/product/{id}/adjacent", GetAdjacentCatalogProducts)
+	router.HandleFunc("GET /api/catalog/subcategory/{slug}", GetCatalogSubcategory)
+}
+
+func GetCatalogTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := db.GetCategoryTree(r.Context())
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"categories": tree,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GetCatalogProduct(w http.ResponseWriter, r *http.Request) {
+	product, err := db.FindCatalogProductDetail(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, db.ErrProductNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el producto", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	// Counted in the background so the response isn't held by the update
+	go func(id string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := db.IncrementProductView(ctx, id); err != nil {
+			log.Printf("failed to count view of product %s: %v\n", id, err)
+		}
+	}(product.ID)
+
+	resData := map[string]any{
+		"product": product,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GetFeaturedCatalogProducts(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "El límite debe ser un número", err)
+			return
+		}
+		limit = parsed
+	}
+
+	products, err := db.FindFeaturedProducts(limit)
+	if err != nil {
+		if errors.Is(err, db.ErrFeaturedProductsLimit) {
+			respondWithError(w, r, http.StatusBadRequest, "El límite no puede ser negativo", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{
+		"products": products,
+	})
+}
+
+func GetAdjacentCatalogProducts(w http.ResponseWriter, r *http.Request) {
+	prev, next, err := db.FindAdjacentProducts(
+		r.Context(),
+		r.PathValue("id"),
+		r.URL.Query().Get("category"),
+		r.URL.Query().Get("sort"),
+	)
+	if err != nil {
+		if errors.Is(err, db.ErrProductNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el producto", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"prev": prev,
+		"next": next,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GetCatalogProducts(w http.ResponseWriter, r *http.Request) {
+	params := db.NewCatalogProductFilterParamsFromRequest(r)
+
+	filter := db.FilterCatalogProducts
+	if r.URL.Query().Get("facets") == "1" {
+		filter = db.FilterCatalogProductsWithFacets
+	}
+	result, err := filter(params)
+	if err != nil {
+		if errors.Is(err, db.ErrCatalogFieldInvalid) {
+			respondWithError(w, r, http.StatusBadRequest, "Uno de los campos solicitados no es válido", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, result)
+}
+
+func GetCatalogProductsBySlugs(w http.ResponseWriter, r *http.Request) {
+	var slugs []string
+	for _, slug := range strings.Split(r.URL.Query().Get("slugs"), ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+	if len(slugs) > 100 {
+		respondWithError(w, r, http.StatusBadRequest, "No se pueden solicitar más de 100 productos", nil)
+		return
+	}
+
+	result, err := db.GetProductsBySlugs(slugs)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, result)
+}
+
+// GetCatalogStockLevels responds with the orderable quantity of every
+// product given through the repeated ids param
+func GetCatalogStockLevels(w http.ResponseWriter, r *http.Request) {
+	ids := r.URL.Query()["ids"]
+	if len(ids) > 100 {
+		respondWithError(w, r, http.StatusBadRequest, "No se pueden solicitar más de 100 productos", nil)
+		return
+	}
+
+	levels, err := db.GetStockLevels(r.Context(), ids)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"stock": levels,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GetCatalogSubcategory(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	subcategory, err := db.FindSubcategoryWithProducts(r.PathValue("slug"), page, limit)
+	if err != nil {
+		if errors.Is(err, db.ErrSubcategoryNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró la subcategoría", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"subcategory": subcategory,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vladwithcode/qrcatalog/internal/auth"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+	"github.com/vladwithcode/qrcatalog/internal/qr"
+)
+
+func RegisterCategoriesRoutes(router *customServeMux) {
+	router.HandleFunc("POST /api/category/{id}/qrcodes/regenerate", auth.ValidateAuth(RegenerateCategoryQRCodes))
+	router.HandleFunc("POST /api/category/{id}/qrcode", auth.ValidateAuth(GenerateCategoryQRCode))
+	router.HandleFunc("POST /api/subcategory/{id}/qrcode", auth.ValidateAuth(GenerateSubcategoryQRCode))
+}
+
+func RegenerateCategoryQRCodes(w http.ResponseWriter, r *http.Request) {
+	category, err := db.FindCategoryByID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, r, http.StatusNotFound, "No se encontró la categoría", err)
+		return
+	}
+
+	baseURL, err := qrBaseURL()
+	if err != nil {
+		respondWithQRError(w, r, err)
+		return
+	}
+
+	regenerated, failed, err := qr.RegenerateQRCodesForCategory(r.Context(), category.ID, baseURL)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"regenerated": regenerated,
+		"failed":      failed,
+		"success":     len(failed) == 0,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GenerateCategoryQRCode(w http.ResponseWriter, r *http.Request) {
+	opts, err := qrOptionsFromRequest(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Parámetros de QR inválidos", err)
+		return
+	}
+
+	category, err := db.FindCategoryByID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, r, http.StatusNotFound, "No se encontró la categoría", err)
+		return
+	}
+
+	baseURL, err := qrBaseURL()
+	if err != nil {
+		respondWithQRError(w, r, err)
+		return
+	}
+
+	written, err := qr.GenerateCategoryQR(category, baseURL, opts)
+	if err != nil {
+		respondWithQRError(w, r, err)
+		return
+	}
+
+	err = db.UpdateCategoryQRCode(r.Context(), category.ID, written.Filename)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"qrcode":  written.Filename,
+		"success": true,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func GenerateSubcategoryQRCode(w http.ResponseWriter, r *http.Request) {
+	opts, err := qrOptionsFromRequest(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Parámetros de QR inválidos", err)
+		return
+	}
+
+	subcategory, err := db.FindSubcategoryByID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, r, http.StatusNotFound, "No se encontró la subcategoría", err)
+		return
+	}
+
+	baseURL, err := qrBaseURL()
+	if err != nil {
+		respondWithQRError(w, r, err)
+		return
+	}
+
+	written, err := qr.GenerateSubcategoryQR(subcategory, baseURL, opts)
+	if err != nil {
+		respondWithQRError(w, r, err)
+		return
+	}
+
+	err = db.UpdateSubcategoryQRCode(r.Context(), subcategory.ID, written.Filename)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"qrcode":  written.Filename,
+		"success": true,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+// respondWithQRError maps the qr generation errors to their response
+func respondWithQRError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, qr.ErrSlugMissing):
+		respondWithError(w, r, http.StatusUnprocessableEntity, "El registro no tiene un slug para generar su QR", err)
+	case errors.Is(err, qr.ErrCategoryMissing):
+		respondWithError(w, r, http.StatusUnprocessableEntity, "La subcategoría no pertenece a ninguna categoría", err)
+	case errors.Is(err, qr.ErrSizeInvalid), errors.Is(err, qr.ErrLevelInvalid):
+		respondWithError(w, r, http.StatusBadRequest, "Parámetros de QR inválidos", err)
+	case errors.Is(err, qr.ErrBaseURLMissing):
+		respondWithError(w, r, http.StatusServiceUnavailable, "La URL base de los QR no está configurada", err)
+	default:
+		respondWithError(w, r, http.StatusInternalServerError, "Error al generar el QR", err)
+	}
+}
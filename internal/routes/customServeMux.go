@@ -1,8 +1,12 @@
 package routes
 
 import (
+	"mime"
 	"net/http"
 	"os"
+	"strconv"
+
+	"github.com/vladwithcode/qrcatalog/internal/metrics"
 )
 
 // customServeMux builds on top of http.ServeMux to provide the ability to customize
@@ -14,21 +18,34 @@ type customServeMux struct {
 	//
 	// Defaults to http.NotFoundHandler().ServeHTTP
 	notFoundHandle http.HandlerFunc
+
+	// nonJSONPatterns holds the patterns allowed to receive non JSON bodies
+	// (e.g. multipart uploads)
+	nonJSONPatterns map[string]bool
 }
 
 func NewCustomServeMux() *customServeMux {
 	return &customServeMux{
 		http.NewServeMux(),
 		http.NotFoundHandler().ServeHTTP,
+		map[string]bool{},
 	}
 }
 
+// HandleNonJSONFunc registers the handler for the given pattern, exempting
+// it from the JSON Content-Type requirement on mutating requests
+func (csm *customServeMux) HandleNonJSONFunc(pattern string, handler http.HandlerFunc) {
+	csm.nonJSONPatterns[pattern] = true
+	csm.HandleFunc(pattern, handler)
+}
+
 // Will search for the handler appropiate for the received request, if found
 // processes the request normally, otherwise responds with a 404
 func (csm *customServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	csm.setCORSHeaders(w)
 
 	if r.Method == http.MethodOptions {
+		csm.setCORSMaxAge(w)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -36,13 +53,41 @@ func (csm *customServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	_, pattern := csm.Handler(r)
 
 	if pattern == "" {
+		metrics.IncRequest("not_found")
 		csm.notFoundHandle(w, r)
 		return
 	}
+	metrics.IncRequest(pattern)
+
+	if !csm.nonJSONPatterns[pattern] && !hasJSONBody(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		w.Write([]byte(`{"error": "El contenido de la petición debe ser JSON (application/json)"}`))
+		return
+	}
 
 	csm.ServeMux.ServeHTTP(w, r)
 }
 
+// hasJSONBody reports whether a POST/PUT/PATCH request either has no body or
+// declares a JSON Content-Type. Other methods always pass
+func hasJSONBody(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return true
+	}
+	if r.ContentLength == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json"
+}
+
 // Set the custom NotFoundHandler
 func (csm *customServeMux) NotFoundHandleFunc(handler http.HandlerFunc) {
 	csm.notFoundHandle = handler
@@ -59,3 +104,24 @@ func (csm *customServeMux) setCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 }
+
+// DefaultCORSMaxAge is how long, in seconds, browsers may cache a preflight
+// response when CORS_MAX_AGE isn't set
+const DefaultCORSMaxAge = 600
+
+// setCORSMaxAge lets browsers cache the preflight response. A negative
+// CORS_MAX_AGE disables the header
+func (csm *customServeMux) setCORSMaxAge(w http.ResponseWriter) {
+	maxAge := DefaultCORSMaxAge
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err == nil {
+			maxAge = parsed
+		}
+	}
+	if maxAge < 0 {
+		return
+	}
+
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+}
@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestMux() *customServeMux {
+	csm := NewCustomServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	csm.HandleFunc("POST /api/json", ok)
+	csm.HandleFunc("GET /api/json", ok)
+	csm.HandleNonJSONFunc("POST /api/upload", ok)
+	return csm
+}
+
+func TestCustomServeMuxRejectsNonJSONBodies(t *testing.T) {
+	csm := newTestMux()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json", http.MethodPost, "/api/json", "application/json", `{}`, http.StatusOK},
+		{"json with charset", http.MethodPost, "/api/json", "application/json; charset=utf-8", `{}`, http.StatusOK},
+		{"text body", http.MethodPost, "/api/json", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+		{"missing content type", http.MethodPost, "/api/json", "", `{}`, http.StatusUnsupportedMediaType},
+		{"empty body", http.MethodPost, "/api/json", "", ``, http.StatusOK},
+		{"get", http.MethodGet, "/api/json", "text/plain", ``, http.StatusOK},
+		{"exempt pattern", http.MethodPost, "/api/upload", "multipart/form-data; boundary=x", `--x--`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			csm.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomServeMuxNotFound(t *testing.T) {
+	csm := newTestMux()
+
+	w := httptest.NewRecorder()
+	csm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/missing", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestCustomServeMuxPreflightMaxAge(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{"default", "", strconv.Itoa(DefaultCORSMaxAge)},
+		{"configured", "3600", "3600"},
+		{"invalid uses default", "abc", strconv.Itoa(DefaultCORSMaxAge)},
+		{"negative disables", "-1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CORS_MAX_AGE", tt.env)
+			csm := newTestMux()
+
+			w := httptest.NewRecorder()
+			csm.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/json", nil))
+
+			if w.Code != http.StatusNoContent {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); got != tt.want {
+				t.Errorf("got Access-Control-Max-Age %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomServeMuxMaxAgeOnlyOnPreflight(t *testing.T) {
+	csm := newTestMux()
+
+	w := httptest.NewRecorder()
+	csm.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/json", nil))
+
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("expected no Access-Control-Max-Age header, got %q", got)
+	}
+}
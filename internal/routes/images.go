@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/vladwithcode/qrcatalog/internal/auth"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+func RegisterImagesRoutes(router *customServeMux) {
+	router.HandleFunc("POST /api/image/{id}/products", auth.ValidateAuth(LinkImageToProducts))
+}
+
+func LinkImageToProducts(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		ProductIDs []string `json:"product_ids"`
+	}
+	msg, err := decodeJSONBody(r, &data)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+	if len(data.ProductIDs) == 0 {
+		respondWithError(w, r, http.StatusBadRequest, "Debes seleccionar al menos un producto", nil)
+		return
+	}
+
+	err = db.LinkImageToProducts(r.Context(), r.PathValue("id"), data.ProductIDs)
+	if err != nil {
+		if strings.Contains(err.Error(), "23503") {
+			respondWithError(w, r, http.StatusBadRequest, "La imagen o alguno de los productos no existe", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"linked": len(data.ProductIDs),
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
@@ -0,0 +1,331 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/vladwithcode/qrcatalog/internal/auth"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+	"github.com/vladwithcode/qrcatalog/internal/qr"
+	"github.com/vladwithcode/qrcatalog/internal/uploads"
+)
+
+func RegisterProductsRoutes(router *customServeMux) {
+	router.HandleNonJSONFunc("POST /api/product/{id}/videos", auth.ValidateAuth(UploadProductVideo))
+	router.HandleFunc("POST /api/product/{id}/qrcode", auth.ValidateAuth(GenerateProductQRCode))
+	router.HandleFunc("DELETE /api/product/{id}", auth.ValidateAuth(DeleteProduct))
+	router.HandleFunc("POST /api/product/{id}/restore", auth.ValidateAuth(RestoreProduct))
+	router.HandleFunc("PUT /api/product/{id}/featured", auth.ValidateAuth(SetProductFeatured))
+	router.HandleFunc("DELETE /api/product/{id}/purge", auth.RequireAccess(auth.AccessLevelSuperAdmin, PurgeProduct))
+	router.HandleFunc("GET /api/product/{id}/export", auth.ValidateAuth(ExportProduct))
+	router.HandleFunc("POST /api/products/import", auth.ValidateAuth(ImportProduct))
+	router.HandleFunc("POST /api/products/reassign-category", auth.ValidateAuth(ReassignProductsCategory))
+}
+
+func UploadProductVideo(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, uploads.MaxVideoUploadSize+(1<<20))
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "El video excede el límite de 50MB", err)
+		return
+	}
+
+	productID := r.PathValue("id")
+	_, err = db.FindProductByID(productID)
+	if err != nil {
+		respondWithError(w, r, http.StatusNotFound, "No se encontró el producto", err)
+		return
+	}
+
+	_, videoHeader, err := r.FormFile("video")
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Debe proporcionar un video", err)
+		return
+	}
+
+	written, err := uploads.UploadVideo(videoHeader)
+	if err != nil {
+		switch {
+		case errors.Is(err, uploads.ErrVideoTooLarge):
+			respondWithError(w, r, http.StatusBadRequest, "El video excede el límite de 50MB", err)
+		case errors.Is(err, uploads.ErrVideoTypeInvalid):
+			respondWithError(w, r, http.StatusBadRequest, "Solo se permiten videos mp4 o webm", err)
+		default:
+			respondWithError(w, r, http.StatusInternalServerError, "Error al guardar el video", err)
+		}
+		return
+	}
+
+	err = db.LinkVideoToProduct(r.Context(), productID, written.Filename, written.Size)
+	if err != nil {
+		uploads.Delete(written.Filename)
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"video":   written.Filename,
+		"success": true,
+	}
+	respondWithJSON(w, r, http.StatusCreated, resData)
+}
+
+func GenerateProductQRCode(w http.ResponseWriter, r *http.Request) {
+	opts, err := qrOptionsFromRequest(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Parámetros de QR inválidos", err)
+		return
+	}
+
+	product, err := db.FindProductByID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, r, http.StatusNotFound, "No se encontró el producto", err)
+		return
+	}
+
+	baseURL, err := qrBaseURL()
+	if err != nil {
+		respondWithQRError(w, r, err)
+		return
+	}
+
+	written, err := qr.GenerateProductQR(product, baseURL, opts)
+	if err != nil {
+		respondWithQRError(w, r, err)
+		return
+	}
+
+	err = db.UpdateProductQRCode(r.Context(), product.ID, written.Filename)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"qrcode":  written.Filename,
+		"success": true,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	err := db.DeleteProduct(r.PathValue("id"))
+	if err != nil {
+		respondWithProductDeleteError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{"success": true})
+}
+
+func RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	err := db.RestoreProduct(r.PathValue("id"))
+	if err != nil {
+		respondWithProductDeleteError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{"success": true})
+}
+
+func PurgeProduct(w http.ResponseWriter, r *http.Request) {
+	err := db.PurgeProduct(r.PathValue("id"))
+	if err != nil {
+		respondWithProductDeleteError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{"success": true})
+}
+
+func SetProductFeatured(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Featured *bool `json:"featured"`
+	}
+	msg, err := decodeJSONBody(r, &data)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+	if data.Featured == nil {
+		respondWithError(w, r, http.StatusBadRequest, "Se requiere el campo featured", nil)
+		return
+	}
+
+	err = db.SetProductFeatured(r.PathValue("id"), *data.Featured)
+	if err != nil {
+		respondWithProductDeleteError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{
+		"featured": *data.Featured,
+		"success":  true,
+	})
+}
+
+func respondWithProductDeleteError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, db.ErrProductNotFound) {
+		respondWithError(w, r, http.StatusNotFound, "No se encontró el producto", err)
+		return
+	}
+	respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+}
+
+// qrOptionsFromRequest reads the optional size and level query params
+func qrOptionsFromRequest(r *http.Request) (qr.Options, error) {
+	var opts qr.Options
+	query := r.URL.Query()
+
+	if size := query.Get("size"); size != "" {
+		parsed, err := strconv.Atoi(size)
+		if err != nil {
+			return opts, err
+		}
+		opts.Size = parsed
+	}
+
+	level, err := qr.ParseLevel(query.Get("level"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Level = level
+
+	return opts, nil
+}
+
+// qrBaseURL returns the configured qr base url. The request host isn't used
+// as a fallback since it's controlled by the client
+func qrBaseURL() (string, error) {
+	if qr.BaseURL == "" {
+		return "", qr.ErrBaseURLMissing
+	}
+	return qr.BaseURL, nil
+}
+
+func ReassignProductsCategory(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		ProductIDs []string `json:"product_ids"`
+		CategoryID string   `json:"category_id"`
+	}
+	msg, err := decodeJSONBody(r, &data)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+	if len(data.ProductIDs) == 0 {
+		respondWithError(w, r, http.StatusBadRequest, "Se requiere al menos un producto", nil)
+		return
+	}
+
+	updated, err := db.ReassignProductsCategory(r.Context(), data.ProductIDs, data.CategoryID)
+	if err != nil {
+		if errors.Is(err, db.ErrCategoryNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró la categoría", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{
+		"updated": updated,
+		"success": true,
+	})
+}
+
+// ExportProduct responds with the product's bundle. Image contents are
+// embedded if include_images=1
+func ExportProduct(w http.ResponseWriter, r *http.Request) {
+	bundle, err := db.ExportProduct(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, db.ErrProductNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el producto", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	if r.URL.Query().Get("include_images") == "1" {
+		for _, img := range bundle.Images {
+			img.Data, err = uploads.ReadBytes(img.Filename)
+			if err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, "No se pudo leer una de las imágenes del producto", err)
+				return
+			}
+		}
+	}
+
+	respondWithJSON(w, r, http.StatusOK, map[string]any{"bundle": bundle})
+}
+
+// ImportProduct creates a product from a bundle made by ExportProduct,
+// writing the embedded image files that don't exist yet
+func ImportProduct(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, uploads.MaxImageUploadSize)
+
+	bundle := db.ProductBundle{}
+	msg, err := decodeJSONBody(r, &bundle)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	// Embedded images are checked before importing but only written once the
+	// import succeeds, so a failed import doesn't leave files behind
+	for _, img := range bundle.Images {
+		if len(img.Data) == 0 {
+			continue
+		}
+		err = uploads.CheckImageBytes(img.Filename, img.Data)
+		if err != nil {
+			respondWithBundleImageError(w, r, err)
+			return
+		}
+	}
+
+	product, err := db.ImportProductBundle(r.Context(), &bundle)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrProductBundleVersion), errors.Is(err, db.ErrProductBundleInvalid),
+			errors.Is(err, db.ErrProductMainImgInvalid):
+			respondWithError(w, r, http.StatusBadRequest, "El paquete del producto no es válido", err)
+		case errors.Is(err, db.ErrCategoryNotFound):
+			respondWithError(w, r, http.StatusUnprocessableEntity, "No existe la categoría del producto", err)
+		case errors.Is(err, db.ErrSubcategoryNotFound):
+			respondWithError(w, r, http.StatusUnprocessableEntity, "No existe la subcategoría del producto", err)
+		default:
+			respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		}
+		return
+	}
+
+	for _, img := range bundle.Images {
+		if len(img.Data) == 0 {
+			continue
+		}
+		_, err = uploads.WriteImageBytes(img.Filename, img.Data)
+		if err != nil {
+			respondWithBundleImageError(w, r, err)
+			return
+		}
+	}
+
+	respondWithJSON(w, r, http.StatusCreated, map[string]any{
+		"product": product,
+		"success": true,
+	})
+}
+
+func respondWithBundleImageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, uploads.ErrImageTypeInvalid):
+		respondWithError(w, r, http.StatusBadRequest, "Una de las imágenes no tiene un nombre o tipo válido", err)
+	case errors.Is(err, uploads.ErrImageExists):
+		respondWithError(w, r, http.StatusConflict, "Ya existe una imagen diferente con el mismo nombre", err)
+	default:
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+	}
+}
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vladwithcode/qrcatalog/internal/qr"
+)
+
+func TestQRBaseURLRequiresConfig(t *testing.T) {
+	prev := qr.BaseURL
+	t.Cleanup(func() { qr.BaseURL = prev })
+
+	qr.BaseURL = ""
+	if _, err := qrBaseURL(); !errors.Is(err, qr.ErrBaseURLMissing) {
+		t.Fatalf("expected ErrBaseURLMissing, got %v", err)
+	}
+
+	qr.BaseURL = "https://catalogo.example.com"
+	got, err := qrBaseURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != qr.BaseURL {
+		t.Errorf("got %q, want %q", got, qr.BaseURL)
+	}
+}
+
+func TestRespondWithQRErrorBaseURLMissing(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/products/1/qrcode", nil)
+	w := httptest.NewRecorder()
+	respondWithQRError(w, r, qr.ErrBaseURLMissing)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
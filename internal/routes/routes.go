@@ -4,23 +4,35 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/vladwithcode/qrcatalog/internal/auth"
 	"github.com/vladwithcode/qrcatalog/internal/db"
+	"github.com/vladwithcode/qrcatalog/internal/metrics"
 )
 
 func NewRouter() http.Handler {
 	router := NewCustomServeMux()
 
 	RegisterSectionsRoutes(router)
+	RegisterCartRoutes(router)
+	RegisterImagesRoutes(router)
+	RegisterCatalogRoutes(router)
+	RegisterProductsRoutes(router)
+	RegisterWizardsRoutes(router)
+	RegisterCategoriesRoutes(router)
+	RegisterAdminRoutes(router)
 
 	// Api
 	router.HandleFunc("GET /api/auth", auth.PopulateAuth(CheckAuth))
-	router.HandleFunc("POST /api/sign-in", auth.PopulateAuth(SignIn))
+	router.HandleNonJSONFunc("POST /api/sign-in", auth.PopulateAuth(SignIn))
 
 	// Serve static files
 	fs := http.FileServer(http.Dir("web/static/"))
@@ -75,10 +87,15 @@ func SignIn(w http.ResponseWriter, r *http.Request) {
 
 	data := db.User{}
 	err = json.NewDecoder(r.Body).Decode(&data)
+	data.Username = strings.TrimSpace(data.Username)
 	if data.Username == "" || data.Password == "" {
 		respondWithError(w, r, http.StatusBadRequest, "El nombre de usuario y la contraseña son requeridos", nil)
 		return
 	}
+	if len(data.Username) > db.UsernameMaxLength || len(data.Password) > db.PasswordMaxLength {
+		respondWithError(w, r, http.StatusUnauthorized, "El nombre de usuario o contraseña son incorrectos", nil)
+		return
+	}
 
 	user, err := db.GetUserByUsername(data.Username)
 	if err != nil {
@@ -158,9 +175,46 @@ func respondWithError(w http.ResponseWriter, r *http.Request, code int, reason s
 		"error": reason,
 	}
 	respondWithJSON(w, r, code, resData)
+	if code >= http.StatusInternalServerError {
+		metrics.IncServerError()
+	}
 	log.Printf("[%s] %s failed: %v\n", r.Method, r.URL.Path, err)
 }
 
+// decodeJSONBody decodes the request body into dst rejecting unknown fields.
+// On failure it returns a user facing message describing what went wrong
+// along with the original error.
+func decodeJSONBody(r *http.Request, dst any) (string, error) {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil {
+		return "", nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("El formulario contiene JSON mal formado (posición %d)", syntaxErr.Offset), err
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "El formulario contiene JSON mal formado", err
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return fmt.Sprintf("El campo \"%s\" tiene un tipo de dato inválido", typeErr.Field), err
+		}
+		return "El formulario contiene un valor con tipo de dato inválido", err
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return fmt.Sprintf("El formulario contiene un campo desconocido: %s", field), err
+	case errors.Is(err, io.EOF):
+		return "El formulario está vacío", err
+	default:
+		return "Error al procesar el formulario", err
+	}
+}
+
 func publicMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Gives templ's ctx access to the request path and query params
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+		Qty  int    `json:"qty"`
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantMsg string
+	}{
+		{"valid", `{"name": "mesa", "qty": 2}`, ""},
+		{"empty", ``, "El formulario está vacío"},
+		{"truncated", `{"name": "mesa"`, "El formulario contiene JSON mal formado"},
+		{"syntax", `{"name": mesa}`, "El formulario contiene JSON mal formado (posición 10)"},
+		{"wrong type", `{"qty": "dos"}`, `El campo "qty" tiene un tipo de dato inválido`},
+		{"unknown field", `{"color": "rojo"}`, `El formulario contiene un campo desconocido: "color"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+
+			var dst payload
+			msg, err := decodeJSONBody(r, &dst)
+			if msg != tt.wantMsg {
+				t.Errorf("got message %q, want %q", msg, tt.wantMsg)
+			}
+			if (err != nil) != (tt.wantMsg != "") {
+				t.Errorf("got error %v with message %q", err, msg)
+			}
+		})
+	}
+}
+
+func TestSignInValidatesInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"blank username", `{"username": "   ", "password": "secreto"}`, http.StatusBadRequest},
+		{"missing password", `{"username": "admin"}`, http.StatusBadRequest},
+		{"username too long", `{"username": "` + strings.Repeat("a", 17) + `", "password": "secreto"}`, http.StatusUnauthorized},
+		{"password too long", `{"username": "admin", "password": "` + strings.Repeat("a", 73) + `"}`, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/signin", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			SignIn(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -2,7 +2,7 @@ package routes
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -20,18 +20,31 @@ func RegisterSectionsRoutes(router *customServeMux) {
 	router.HandleFunc("POST /api/section", auth.ValidateAuth(CreateSection))
 	router.HandleFunc("PUT /api/section/{id}", auth.ValidateAuth(UpdateSection))
 	router.HandleFunc("DELETE /api/section/{id}", auth.ValidateAuth(DeleteSection))
-	router.HandleFunc("POST /api/sections/media", auth.ValidateAuth(UploadSectionMedia))
+	router.HandleFunc("PUT /api/section/service/{id}/items", auth.ValidateAuth(UpdateServiceItems))
+	router.HandleFunc("PUT /api/sections/order", auth.ValidateAuth(ReorderSections))
+	router.HandleNonJSONFunc("POST /api/sections/media", auth.ValidateAuth(UploadSectionMedia))
 }
 
+// GetPublicSections lists the sections in the sort picked through the
+// sections default sort setting, their display order by default. Without a
+// page or limit the first db.MaxPublicSectionsLimit sections are returned
 func GetPublicSections(w http.ResponseWriter, r *http.Request) {
-	sections, err := db.FindAllSections(r.Context())
+	filters := db.NewPublicSectionFilterParamsFromRequest(r)
+	filters.Sort = db.SettingOrDefault(r.Context(), db.SettingSectionsDefaultSort, filters.Sort)
+	result, err := db.FilterSections(r.Context(), filters)
 	if err != nil {
 		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
 		return
 	}
 
 	resData := map[string]any{
-		"sections": sections,
+		"sections":     result.Sections,
+		"total":        result.Total,
+		"page":         result.Page,
+		"limit":        result.Limit,
+		"total_pages":  result.TotalPages,
+		"has_next":     result.HasNext,
+		"has_previous": result.HasPrevious,
 	}
 	respondWithJSON(w, r, http.StatusOK, resData)
 }
@@ -68,9 +81,9 @@ func GetSection(w http.ResponseWriter, r *http.Request) {
 
 func CreateSection(w http.ResponseWriter, r *http.Request) {
 	var data db.Section
-	err := json.NewDecoder(r.Body).Decode(&data)
+	msg, err := decodeJSONBody(r, &data)
 	if err != nil {
-		respondWithError(w, r, http.StatusBadRequest, "Error al procesar el formulario", err)
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
 		return
 	}
 
@@ -80,6 +93,10 @@ func CreateSection(w http.ResponseWriter, r *http.Request) {
 			respondWithError(w, r, http.StatusBadRequest, "Ya existe un contenido con ese nombre", err)
 			return
 		}
+		if errors.Is(err, db.ErrSectionServicePricing) {
+			respondWithError(w, r, http.StatusBadRequest, "Un servicio no puede tener precio general y precios por elemento al mismo tiempo", err)
+			return
+		}
 
 		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
 		return
@@ -100,9 +117,9 @@ func UpdateSection(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var data db.Section
-	err := json.NewDecoder(r.Body).Decode(&data)
+	msg, err := decodeJSONBody(r, &data)
 	if err != nil {
-		respondWithError(w, r, http.StatusBadRequest, "Error al procesar el formulario", err)
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
 		return
 	}
 
@@ -113,6 +130,10 @@ func UpdateSection(w http.ResponseWriter, r *http.Request) {
 			respondWithError(w, r, http.StatusBadRequest, "Ya existe un contenido con ese nombre", err)
 			return
 		}
+		if errors.Is(err, db.ErrSectionServicePricing) {
+			respondWithError(w, r, http.StatusBadRequest, "Un servicio no puede tener precio general y precios por elemento al mismo tiempo", err)
+			return
+		}
 
 		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
 		return
@@ -125,6 +146,66 @@ func UpdateSection(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, r, http.StatusOK, resData)
 }
 
+func UpdateServiceItems(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Items []*db.SectionServiceItem `json:"items"`
+	}
+	msg, err := decodeJSONBody(r, &data)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+
+	err = db.UpdateServiceItems(r.Context(), r.PathValue("id"), data.Items)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrSectionServiceNotFound):
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el servicio", err)
+		case errors.Is(err, db.ErrSectionServicePricing):
+			respondWithError(w, r, http.StatusBadRequest, "Un servicio no puede tener precio general y precios por elemento al mismo tiempo", err)
+		default:
+			respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		}
+		return
+	}
+
+	resData := map[string]any{
+		"items":   data.Items,
+		"success": true,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func ReorderSections(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		IDs []string `json:"ids"`
+	}
+	msg, err := decodeJSONBody(r, &data)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, msg, err)
+		return
+	}
+	if len(data.IDs) == 0 {
+		respondWithError(w, r, http.StatusBadRequest, "Debe proporcionar el orden de las secciones", nil)
+		return
+	}
+
+	err = db.ReorderSections(r.Context(), data.IDs)
+	if err != nil {
+		if errors.Is(err, db.ErrSectionNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "Una o más secciones no existen", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"success": true,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
 func DeleteSection(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	err := db.DeleteSection(r.Context(), id)
@@ -233,19 +314,22 @@ func processSectionImageFile(fileHeader *multipart.FileHeader) (string, error) {
 		return "", fmt.Errorf("El archivo '%s' excede el límite de 4MB", fileHeader.Filename)
 	}
 
-	// Validate file type (only images allowed)
-	contentType := fileHeader.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "image/") {
-		return "", fmt.Errorf("El archivo '%s' no es una imagen válida. Solo se permiten archivos de imagen", fileHeader.Filename)
+	// Section images are shown full width, so they're scaled down and
+	// re-encoded to keep pages light. UploadOptimized validates the type and
+	// content against the allowed image types
+	written, err := uploads.UploadOptimized(fileHeader, uploads.OptimizeOpts{})
+	if errors.Is(err, uploads.ErrImageTypeInvalid) {
+		return "", fmt.Errorf(
+			"El archivo '%s' no es una imagen válida. Solo se permiten archivos %s",
+			fileHeader.Filename,
+			strings.Join(uploads.AllowedImageExtensions(), ", "),
+		)
 	}
-
-	// Use the uploads package to handle file upload
-	filename, err := uploads.Upload(fileHeader)
 	if err != nil {
 		return "", fmt.Errorf("Error al guardar el archivo: %v", err)
 	}
 
-	return filename, nil
+	return written.Filename, nil
 }
 
 func updateSectionImages(ctx context.Context, sectionID, imageFilename, bgImageFilename string) error {
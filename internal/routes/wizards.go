@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vladwithcode/qrcatalog/internal/auth"
+	"github.com/vladwithcode/qrcatalog/internal/db"
+)
+
+func RegisterWizardsRoutes(router *customServeMux) {
+	router.HandleFunc("GET /api/wizard/{id}/steps", auth.ValidateAuth(GetWizardWithSteps))
+	router.HandleFunc("GET /api/wizard/{id}/validate", auth.ValidateAuth(ValidateWizardSteps))
+}
+
+func GetWizardWithSteps(w http.ResponseWriter, r *http.Request) {
+	wizard, err := db.GetWizardWithSteps(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, db.ErrWizardNotFound) {
+			respondWithError(w, r, http.StatusNotFound, "No se encontró el asistente", err)
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	resData := map[string]any{
+		"wizard": wizard,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
+
+func ValidateWizardSteps(w http.ResponseWriter, r *http.Request) {
+	steps, err := db.CheckWizardFeasibility(r.Context(), r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Ocurrió un error inesperado", err)
+		return
+	}
+
+	feasible := true
+	for _, step := range steps {
+		feasible = feasible && step.Feasible
+	}
+
+	resData := map[string]any{
+		"steps":    steps,
+		"feasible": feasible,
+	}
+	respondWithJSON(w, r, http.StatusOK, resData)
+}
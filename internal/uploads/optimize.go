@@ -0,0 +1,313 @@
+package uploads
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultMaxImageDimension is the max width or height of optimized images
+	// when OptimizeOpts doesn't set one
+	DefaultMaxImageDimension = 2048
+	// DefaultImageQuality is the JPEG quality used when OptimizeOpts doesn't
+	// set one
+	DefaultImageQuality = 82
+	// MaxImagePixels caps the width times height of images that get decoded,
+	// as a small compressed file can expand to gigabytes once decoded
+	MaxImagePixels = 40_000_000
+)
+
+var (
+	ErrImageEncodeFail = errors.New("failed to encode optimized image")
+	ErrImageDecodeFail = errors.New("failed to decode image")
+	ErrImageTooLarge   = errors.New("image dimensions exceed the max allowed")
+)
+
+// OptimizeOpts controls how UploadOptimized re-encodes an image
+type OptimizeOpts struct {
+	// MaxDimension is the max width or height, larger images are scaled down
+	// keeping their aspect ratio. 0 uses DefaultMaxImageDimension and a
+	// negative value disables resizing
+	MaxDimension int
+	// Quality is the JPEG quality, from 1 to 100. 0 uses DefaultImageQuality
+	Quality int
+	// NoOptimize writes the file as uploaded, mirroring Image.NoOptimize
+	NoOptimize bool
+}
+
+// UploadOptimized validates the image and writes the file to the uploads
+// dir, scaled down to opts.MaxDimension and re-encoded to reduce its size.
+//
+// The standard library has no WebP encoder, so images are re-encoded as JPEG,
+// or as PNG when they have transparency. The original file is written as is
+// when NoOptimize is set, its format can't be decoded (e.g. WebP or AVIF) or
+// re-encoding it wouldn't make it smaller. Images over MaxImagePixels are
+// rejected with ErrImageTooLarge before being decoded
+func UploadOptimized(file *multipart.FileHeader, opts OptimizeOpts) (*WrittenFile, error) {
+	err := ValidateImage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	base := uploadBasename("upload")
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if opts.NoOptimize {
+		return writeOriginal(file, base+ext)
+	}
+
+	p, err := file.Open()
+	if err != nil {
+		return nil, errors.Join(ErrFileHeaderOpenFail, err)
+	}
+	original, err := io.ReadAll(p)
+	p.Close()
+	if err != nil {
+		return nil, errors.Join(ErrFileCopyFail, err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		// Unsupported formats are kept as uploaded
+		return WriteBytes(base+ext, original)
+	}
+	if err := checkImagePixels(config); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, errors.Join(ErrImageDecodeFail, err)
+	}
+
+	maxDim := opts.MaxDimension
+	if maxDim == 0 {
+		maxDim = DefaultMaxImageDimension
+	}
+	resized := false
+	if maxDim > 0 {
+		img, resized = resizeToFit(img, maxDim)
+	}
+
+	encoded, encodedExt, err := encodeOptimized(img, opts.Quality)
+	if err != nil {
+		return nil, errors.Join(ErrImageEncodeFail, err)
+	}
+	if !resized && len(encoded) >= len(original) {
+		return WriteBytes(base+ext, original)
+	}
+
+	return WriteBytes(base+encodedExt, encoded)
+}
+
+// checkImagePixels returns ErrImageTooLarge if an image with the given config
+// has more than MaxImagePixels pixels
+func checkImagePixels(config image.Config) error {
+	if int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+	return nil
+}
+
+// writeOriginal writes the uploaded file to filename inside UploadsPath
+func writeOriginal(file *multipart.FileHeader, filename string) (*WrittenFile, error) {
+	sz, err := writeFile(file, filepath.Join(UploadsPath, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	return &WrittenFile{
+		Filename: filename,
+		Size:     sz,
+	}, nil
+}
+
+// encodeOptimized encodes img as PNG if it has transparent pixels, as JPEG
+// otherwise, returning the data along with the matching extension
+func encodeOptimized(img image.Image, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if hasTransparency(img) {
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".png", nil
+	}
+
+	if quality < 1 || quality > 100 {
+		quality = DefaultImageQuality
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ".jpg", nil
+}
+
+// hasTransparency reports whether any pixel of img isn't fully opaque
+func hasTransparency(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resizeToFit scales img down so neither side exceeds maxDim, averaging the
+// source pixels covered by each output pixel. It returns img unchanged and
+// false if it already fits
+func resizeToFit(img image.Image, maxDim int) (image.Image, bool) {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	if srcW <= maxDim && srcH <= maxDim {
+		return img, false
+	}
+
+	dstW, dstH := maxDim, maxDim
+	if srcW >= srcH {
+		dstH = max(1, srcH*maxDim/srcW)
+	} else {
+		dstW = max(1, srcW*maxDim/srcH)
+	}
+
+	return resize(img, dstW, dstH), true
+}
+
+// resize scales img down to dstW x dstH, averaging the source pixels covered
+// by each output pixel. Pixels are read from img as they're needed instead of
+// copying it first
+func resize(img image.Image, dstW, dstH int) image.Image {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := range dstH {
+		y0, y1 := y*srcH/dstH, max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := range dstW {
+			x0, x1 := x*srcW/dstW, max((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					px := nrgbaAt(img, b.Min.X+sx, b.Min.Y+sy)
+					r += int(px.R)
+					g += int(px.G)
+					bl += int(px.B)
+					a += int(px.A)
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// UploadResponsive validates the image and writes the original file to
+// the uploads dir, along with a copy scaled to each of widths for srcset use.
+// Copies are suffixed with their width (e.g. upload_..._640.jpg) and keep
+// the original aspect ratio. Widths that aren't smaller than the source are
+// skipped, as images are never upscaled. The original is returned first
+func UploadResponsive(file *multipart.FileHeader, widths []int) ([]*WrittenFile, error) {
+	err := ValidateImage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := file.Open()
+	if err != nil {
+		return nil, errors.Join(ErrFileHeaderOpenFail, err)
+	}
+	original, err := io.ReadAll(p)
+	p.Close()
+	if err != nil {
+		return nil, errors.Join(ErrFileCopyFail, err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		return nil, errors.Join(ErrImageDecodeFail, err)
+	}
+	if err := checkImagePixels(config); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, errors.Join(ErrImageDecodeFail, err)
+	}
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	base := uploadBasename("upload")
+
+	written, err := WriteBytes(base+ext, original)
+	if err != nil {
+		return nil, err
+	}
+	written.Width = srcW
+	writtenFiles := []*WrittenFile{written}
+
+	done := map[int]bool{}
+	for _, width := range widths {
+		if width <= 0 || width >= srcW || done[width] {
+			continue
+		}
+		done[width] = true
+
+		height := max(1, srcH*width/srcW)
+		encoded, encodedExt, err := encodeOptimized(resize(img, width, height), DefaultImageQuality)
+		if err != nil {
+			return nil, errors.Join(ErrImageEncodeFail, err)
+		}
+
+		written, err := WriteBytes(fmt.Sprintf("%s_%d%s", base, width, encodedExt), encoded)
+		if err != nil {
+			return nil, err
+		}
+		written.Width = width
+		writtenFiles = append(writtenFiles, written)
+	}
+
+	return writtenFiles, nil
+}
+
+// nrgbaAt returns the color of the pixel of img at x, y. The types decoded
+// from JPEG and PNG files are read directly, as converting through At is
+// much slower
+func nrgbaAt(img image.Image, x, y int) color.NRGBA {
+	switch src := img.(type) {
+	case *image.NRGBA:
+		return src.NRGBAAt(x, y)
+	case *image.YCbCr:
+		c := src.YCbCrAt(x, y)
+		r, g, b := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+		return color.NRGBA{R: r, G: g, B: b, A: 0xff}
+	case *image.Gray:
+		c := src.GrayAt(x, y)
+		return color.NRGBA{R: c.Y, G: c.Y, B: c.Y, A: 0xff}
+	}
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
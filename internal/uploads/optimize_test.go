@@ -0,0 +1,115 @@
+package uploads
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadOptimizedResizesLargeImages(t *testing.T) {
+	dir := useTempUploadsPath(t)
+	file := newFileHeader(t, "photo.png", "image/png", pngFixture(t, 300, 100))
+
+	written, err := UploadOptimized(file, OptimizeOpts{MaxDimension: 150})
+	if err != nil {
+		t.Fatalf("UploadOptimized() error = %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, written.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 150 || config.Height != 50 {
+		t.Errorf("optimized image is %dx%d, want 150x50", config.Width, config.Height)
+	}
+}
+
+func TestUploadOptimizedNoOptimizeKeepsOriginal(t *testing.T) {
+	dir := useTempUploadsPath(t)
+	data := pngFixture(t, 300, 100)
+	file := newFileHeader(t, "photo.png", "image/png", data)
+
+	written, err := UploadOptimized(file, OptimizeOpts{MaxDimension: 150, NoOptimize: true})
+	if err != nil {
+		t.Fatalf("UploadOptimized() error = %v", err)
+	}
+	if filepath.Ext(written.Filename) != ".png" {
+		t.Errorf("filename = %q, want the original extension", written.Filename)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, written.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("NoOptimize upload doesn't match the original file")
+	}
+}
+
+func TestUploadOptimizedRejectsHugeDimensions(t *testing.T) {
+	dir := useTempUploadsPath(t)
+	file := newFileHeader(t, "bomb.png", "image/png", pngHeaderOnly(t, 20000, 20000))
+
+	_, err := UploadOptimized(file, OptimizeOpts{})
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("UploadOptimized() error = %v, want ErrImageTooLarge", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("%d files were written for a rejected image", len(entries))
+	}
+}
+
+// pngHeaderOnly returns the signature and IHDR chunk of a w x h PNG, enough
+// for image.DecodeConfig but not for decoding
+func pngHeaderOnly(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(w))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(h))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+func TestUploadResponsiveSkipsWidthsLargerThanSource(t *testing.T) {
+	useTempUploadsPath(t)
+	file := newFileHeader(t, "photo.png", "image/png", pngFixture(t, 400, 200))
+
+	written, err := UploadResponsive(file, []int{100, 200, 200, 800})
+	if err != nil {
+		t.Fatalf("UploadResponsive() error = %v", err)
+	}
+
+	widths := []int{}
+	for _, w := range written {
+		widths = append(widths, w.Width)
+	}
+	want := []int{400, 100, 200}
+	if len(widths) != len(want) {
+		t.Fatalf("widths = %v, want %v", widths, want)
+	}
+	for i := range want {
+		if widths[i] != want[i] {
+			t.Fatalf("widths = %v, want %v", widths, want)
+		}
+	}
+}
@@ -2,31 +2,200 @@
 package uploads
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 const (
 	RemoveImgFlag      = "delete"
 	MaxImageUploadSize = 64 << 20
+	MaxVideoUploadSize = 50 << 20
 )
 
 var (
 	ErrFileHeaderOpenFail = errors.New("failed to open file from fileheader")
 	ErrFileCreateFail     = errors.New("failed to create output file")
 	ErrFileCopyFail       = errors.New("failed to copy file")
+	ErrVideoTooLarge      = errors.New("video exceeds the max upload size")
+	ErrVideoTypeInvalid   = errors.New("video must be an mp4 or webm file")
+	ErrImageTypeInvalid   = errors.New("image type is not allowed")
+	ErrImageExists        = errors.New("a different image with that name already exists")
+
+	// AllowedVideoTypes maps the accepted video extensions to their mime type
+	AllowedVideoTypes = map[string]string{
+		".mp4":  "video/mp4",
+		".webm": "video/webm",
+	}
+
+	// AllowedImageTypes maps the accepted image extensions to their mime type.
+	// SVG is left out on purpose as it can carry scripts
+	AllowedImageTypes = map[string]string{
+		".jpg":  "image/jpeg",
+		".jpeg": "image/jpeg",
+		".png":  "image/png",
+		".webp": "image/webp",
+	}
+
+	// knownImageTypes are the image extensions that can be enabled through
+	// EnvVarAllowedImageTypes
+	knownImageTypes = map[string]string{
+		".jpg":  "image/jpeg",
+		".jpeg": "image/jpeg",
+		".png":  "image/png",
+		".webp": "image/webp",
+		".gif":  "image/gif",
+		".avif": "image/avif",
+		".bmp":  "image/bmp",
+		".svg":  "image/svg+xml",
+	}
 
 	UploadsPath = "web/static/uploads"
 )
 
+// EnvVarAllowedImageTypes holds a comma separated list of image extensions
+// (e.g. "jpg,png,webp") overriding AllowedImageTypes
+const EnvVarAllowedImageTypes = "UPLOAD_IMAGE_TYPES"
+
+// SetUploadParameters reads the uploads configuration from the environment
+func SetUploadParameters() {
+	envTypes := os.Getenv(EnvVarAllowedImageTypes)
+	if envTypes == "" {
+		return
+	}
+
+	allowed := map[string]string{}
+	for _, ext := range strings.Split(envTypes, ",") {
+		ext = "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+		mimeType, ok := knownImageTypes[ext]
+		if !ok {
+			log.Printf("ignoring unknown image type %q in %s\n", ext, EnvVarAllowedImageTypes)
+			continue
+		}
+		allowed[ext] = mimeType
+	}
+	if len(allowed) > 0 {
+		AllowedImageTypes = allowed
+	}
+}
+
+// AllowedImageExtensions returns the sorted list of allowed image extensions
+func AllowedImageExtensions() []string {
+	exts := make([]string, 0, len(AllowedImageTypes))
+	for ext := range AllowedImageTypes {
+		exts = append(exts, ext)
+	}
+	slices.Sort(exts)
+	return exts
+}
+
+// ValidateImageType checks the file extension and declared content type are
+// in AllowedImageTypes
+func ValidateImageType(file *multipart.FileHeader) error {
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	mimeType, ok := AllowedImageTypes[ext]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrImageTypeInvalid, ext)
+	}
+
+	contentType := file.Header.Get("Content-Type")
+	if contentType != "" && contentType != mimeType && contentType != "application/octet-stream" {
+		return fmt.Errorf("%w: %s", ErrImageTypeInvalid, contentType)
+	}
+
+	return nil
+}
+
+// ValidateImage checks the file with ValidateImageType and then sniffs its
+// first 512 bytes, so files whose content doesn't match their extension (e.g.
+// a renamed text file) are rejected regardless of the declared content type
+func ValidateImage(file *multipart.FileHeader) error {
+	err := ValidateImageType(file)
+	if err != nil {
+		return err
+	}
+
+	p, err := file.Open()
+	if err != nil {
+		return errors.Join(ErrFileHeaderOpenFail, err)
+	}
+	defer p.Close()
+
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(p, header)
+
+	return checkImageContent(file.Filename, header[:n])
+}
+
+// ValidateImageBytes checks filename is a plain name with an allowed image
+// extension and that data, sniffed as in ValidateImage, matches it
+func ValidateImageBytes(filename string, data []byte) error {
+	if filename == "" || filepath.Base(filename) != filename {
+		return fmt.Errorf("%w: %s", ErrImageTypeInvalid, filename)
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if _, ok := AllowedImageTypes[ext]; !ok {
+		return fmt.Errorf("%w: %s", ErrImageTypeInvalid, ext)
+	}
+
+	return checkImageContent(filename, data[:min(len(data), 512)])
+}
+
+// checkImageContent checks the sniffed type of header matches the allowed
+// type of filename's extension
+func checkImageContent(filename string, header []byte) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if sniffImageType(header) != AllowedImageTypes[ext] {
+		return fmt.Errorf("%w: content of %s doesn't match %s", ErrImageTypeInvalid, filename, ext)
+	}
+
+	return nil
+}
+
+// sniffImageType returns the mime type of an image from its first bytes.
+// AVIF and SVG aren't recognized by http.DetectContentType so they're
+// checked by hand
+func sniffImageType(header []byte) string {
+	// AVIF files are ISO base media files with an avif or avis brand
+	if len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")) &&
+		(bytes.Equal(header[8:12], []byte("avif")) || bytes.Equal(header[8:12], []byte("avis"))) {
+		return "image/avif"
+	}
+
+	contentType, _, _ := strings.Cut(http.DetectContentType(header), ";")
+	if (contentType == "text/xml" || contentType == "text/plain") && bytes.Contains(header, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+
+	return contentType
+}
+
+// uploadBasename returns a name, without extension, for a new upload. It
+// starts with prefix and the upload time to the millisecond so files sort
+// chronologically, followed by a random part so uploads made at the same
+// time never overwrite each other
+func uploadBasename(prefix string) string {
+	date := time.Now().Format("2006-01-02T15:04:05.000")
+	random := strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+	return fmt.Sprintf("%s_%s_%s", prefix, date, random)
+}
+
 type WrittenFile struct {
 	Filename string
 	Size     int64
+	// Width is the image width in pixels, set by the responsive uploads
+	Width int
 }
 
 func writeFile(file *multipart.FileHeader, writePath string) (int64, error) {
@@ -51,10 +220,14 @@ func writeFile(file *multipart.FileHeader, writePath string) (int64, error) {
 }
 
 func Upload(file *multipart.FileHeader) (filename string, err error) {
-	date := time.Now().Format("2006-01-02T15:04:05")
+	err = ValidateImage(file)
+	if err != nil {
+		return "", err
+	}
+
 	uploadsPath := UploadsPath
 
-	filename = fmt.Sprintf("upload_%s_%d%s", date, 0, filepath.Ext(file.Filename))
+	filename = uploadBasename("upload") + filepath.Ext(file.Filename)
 	writePath := filepath.Join(uploadsPath, filename)
 	_, err = writeFile(file, writePath)
 	if err != nil {
@@ -64,13 +237,21 @@ func Upload(file *multipart.FileHeader) (filename string, err error) {
 	return filename, nil
 }
 
+// UploadMultiple validates every file before writing them to the uploads dir,
+// so no file is written if any of them isn't a valid image
 func UploadMultiple(files []*multipart.FileHeader) (writtenFiles []*WrittenFile, err error) {
-	date := time.Now().Format("2006-01-02T15:04:05")
+	for _, fHeader := range files {
+		if err := ValidateImage(fHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	base := uploadBasename("upload")
 	uploadsPath := UploadsPath
 	writtenFiles = make([]*WrittenFile, len(files))
 
 	for i, fHeader := range files {
-		filename := fmt.Sprintf("upload_%s_%d%s", date, i, filepath.Ext(fHeader.Filename))
+		filename := fmt.Sprintf("%s_%d%s", base, i, filepath.Ext(fHeader.Filename))
 		writePath := filepath.Join(uploadsPath, filename)
 
 		sz, err := writeFile(fHeader, writePath)
@@ -87,6 +268,81 @@ func UploadMultiple(files []*multipart.FileHeader) (writtenFiles []*WrittenFile,
 	return writtenFiles, nil
 }
 
+// WriteBytes writes data to filename inside UploadsPath, overwriting the file
+// if it already exists
+func WriteBytes(filename string, data []byte) (*WrittenFile, error) {
+	writePath := filepath.Join(UploadsPath, filename)
+	err := os.WriteFile(writePath, data, 0644)
+	if err != nil {
+		return nil, errors.Join(ErrFileCreateFail, err)
+	}
+
+	return &WrittenFile{
+		Filename: filename,
+		Size:     int64(len(data)),
+	}, nil
+}
+
+// ReadBytes returns the contents of filename inside UploadsPath
+func ReadBytes(filename string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(UploadsPath, filepath.Base(filename)))
+}
+
+// CheckImageBytes validates data with ValidateImageBytes and makes sure it
+// can be written as filename inside UploadsPath, which is the case unless a
+// file with different contents already uses that name
+func CheckImageBytes(filename string, data []byte) error {
+	err := ValidateImageBytes(filename, data)
+	if err != nil {
+		return err
+	}
+
+	existing, err := os.ReadFile(filepath.Join(UploadsPath, filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(existing, data) {
+		return fmt.Errorf("%w: %s", ErrImageExists, filename)
+	}
+
+	return nil
+}
+
+// WriteImageBytes checks data with CheckImageBytes and writes it to filename
+// inside UploadsPath. Nothing is written if the same file already exists
+func WriteImageBytes(filename string, data []byte) (*WrittenFile, error) {
+	err := CheckImageBytes(filename, data)
+	if err != nil {
+		return nil, err
+	}
+
+	writePath := filepath.Join(UploadsPath, filename)
+	f, err := os.OpenFile(writePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		// Written since it was checked, so it's compared again
+		if err := CheckImageBytes(filename, data); err != nil {
+			return nil, err
+		}
+		return &WrittenFile{Filename: filename, Size: int64(len(data))}, nil
+	}
+	if err != nil {
+		return nil, errors.Join(ErrFileCreateFail, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return nil, errors.Join(ErrFileCopyFail, err)
+	}
+
+	return &WrittenFile{
+		Filename: filename,
+		Size:     int64(len(data)),
+	}, nil
+}
+
 func Update(filename string, newFile *multipart.FileHeader) error {
 	writePath := filepath.Join(UploadsPath, filename)
 	_, err := writeFile(newFile, writePath)
@@ -114,3 +370,67 @@ func DeleteMultiple(filenames []string) error {
 
 	return nil
 }
+
+// ValidateVideo checks the file is an mp4 or webm video within
+// MaxVideoUploadSize, by its extension, declared type and content
+func ValidateVideo(file *multipart.FileHeader) error {
+	if file.Size > MaxVideoUploadSize {
+		return ErrVideoTooLarge
+	}
+
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	mimeType, ok := AllowedVideoTypes[ext]
+	if !ok {
+		return ErrVideoTypeInvalid
+	}
+	contentType := file.Header.Get("Content-Type")
+	if contentType != "" && contentType != mimeType && contentType != "application/octet-stream" {
+		return ErrVideoTypeInvalid
+	}
+
+	p, err := file.Open()
+	if err != nil {
+		return errors.Join(ErrFileHeaderOpenFail, err)
+	}
+	defer p.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(p, header)
+	header = header[:n]
+
+	switch ext {
+	case ".mp4":
+		// ISO base media files start with a box size followed by "ftyp"
+		if len(header) < 8 || !bytes.Equal(header[4:8], []byte("ftyp")) {
+			return ErrVideoTypeInvalid
+		}
+	case ".webm":
+		// EBML magic number
+		if !bytes.HasPrefix(header, []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+			return ErrVideoTypeInvalid
+		}
+	}
+
+	return nil
+}
+
+// UploadVideo validates the file with ValidateVideo and writes it to the
+// uploads dir
+func UploadVideo(file *multipart.FileHeader) (*WrittenFile, error) {
+	err := ValidateVideo(file)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := uploadBasename("video") + strings.ToLower(filepath.Ext(file.Filename))
+	writePath := filepath.Join(UploadsPath, filename)
+	sz, err := writeFile(file, writePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WrittenFile{
+		Filename: filename,
+		Size:     sz,
+	}, nil
+}
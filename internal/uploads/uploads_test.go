@@ -0,0 +1,237 @@
+package uploads
+
+import (
+	"errors"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteImageBytesRejectsMismatchedContent(t *testing.T) {
+	dir := useTempUploadsPath(t)
+
+	_, err := WriteImageBytes("fake.png", []byte("just some text"))
+	if !errors.Is(err, ErrImageTypeInvalid) {
+		t.Fatalf("WriteImageBytes() error = %v, want ErrImageTypeInvalid", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fake.png")); !os.IsNotExist(err) {
+		t.Error("rejected image was written")
+	}
+}
+
+func TestWriteImageBytesRejectsNameClashWithDifferentContent(t *testing.T) {
+	useTempUploadsPath(t)
+	if _, err := WriteImageBytes("photo.png", pngFixture(t, 4, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := WriteImageBytes("photo.png", pngFixture(t, 8, 8))
+	if !errors.Is(err, ErrImageExists) {
+		t.Fatalf("WriteImageBytes() error = %v, want ErrImageExists", err)
+	}
+}
+
+func TestWriteImageBytesKeepsIdenticalFile(t *testing.T) {
+	useTempUploadsPath(t)
+	data := pngFixture(t, 4, 4)
+	if _, err := WriteImageBytes("photo.png", data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WriteImageBytes("photo.png", data); err != nil {
+		t.Fatalf("WriteImageBytes() error = %v for an identical file", err)
+	}
+}
+
+func TestWriteImageBytesRejectsPaths(t *testing.T) {
+	useTempUploadsPath(t)
+
+	_, err := WriteImageBytes("../photo.png", pngFixture(t, 4, 4))
+	if !errors.Is(err, ErrImageTypeInvalid) {
+		t.Fatalf("WriteImageBytes() error = %v, want ErrImageTypeInvalid", err)
+	}
+}
+
+func TestValidateImageRejectsRenamedTextFile(t *testing.T) {
+	fh := newFileHeader(t, "a.png", "image/png", []byte("hello, this is not an image"))
+
+	err := ValidateImage(fh)
+	if !errors.Is(err, ErrImageTypeInvalid) {
+		t.Fatalf("expected ErrImageTypeInvalid, got %v", err)
+	}
+}
+
+func TestValidateImageAcceptsPNG(t *testing.T) {
+	fh := newFileHeader(t, "a.png", "image/png", pngFixture(t, 4, 4))
+
+	if err := ValidateImage(fh); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadMultipleWritesNothingIfAnyFileIsInvalid(t *testing.T) {
+	dir := useTempUploadsPath(t)
+	files := []*multipart.FileHeader{
+		newFileHeader(t, "a.png", "image/png", pngFixture(t, 4, 4)),
+		newFileHeader(t, "b.png", "image/png", []byte("not an image")),
+	}
+
+	if _, err := UploadMultiple(files); !errors.Is(err, ErrImageTypeInvalid) {
+		t.Fatalf("expected ErrImageTypeInvalid, got %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no files to be written, found %d", len(entries))
+	}
+}
+
+func TestUploadBasenameIsUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for range 1000 {
+		name := uploadBasename("upload")
+		if !strings.HasPrefix(name, "upload_") {
+			t.Fatalf("expected %q to start with the prefix", name)
+		}
+		if seen[name] {
+			t.Fatalf("got duplicated basename %q", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestUploadSameSecondDoesNotOverwrite(t *testing.T) {
+	useTempUploadsPath(t)
+	data := pngFixture(t, 4, 4)
+
+	first, err := Upload(newFileHeader(t, "a.png", "image/png", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Upload(newFileHeader(t, "a.png", "image/png", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second {
+		t.Fatalf("both uploads were written to %q", first)
+	}
+	for _, name := range []string{first, second} {
+		if _, err := os.Stat(filepath.Join(UploadsPath, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+}
+
+func TestSetUploadParametersParsesAllowlist(t *testing.T) {
+	prev := AllowedImageTypes
+	t.Cleanup(func() { AllowedImageTypes = prev })
+
+	t.Setenv(EnvVarAllowedImageTypes, " PNG, .gif,exe ")
+	SetUploadParameters()
+
+	got := strings.Join(AllowedImageExtensions(), ",")
+	if got != ".gif,.png" {
+		t.Errorf("got allowed extensions %q, want %q", got, ".gif,.png")
+	}
+}
+
+func TestSetUploadParametersKeepsDefaultsOnUnknownTypes(t *testing.T) {
+	prev := AllowedImageTypes
+	t.Cleanup(func() { AllowedImageTypes = prev })
+
+	t.Setenv(EnvVarAllowedImageTypes, "exe,bat")
+	SetUploadParameters()
+
+	if len(AllowedImageTypes) != len(prev) {
+		t.Errorf("expected the default allowlist to be kept, got %v", AllowedImageTypes)
+	}
+}
+
+func TestValidateImageType(t *testing.T) {
+	tests := []struct {
+		filename    string
+		contentType string
+		wantErr     bool
+	}{
+		{"a.png", "image/png", false},
+		{"a.JPG", "image/jpeg", false},
+		{"a.png", "application/octet-stream", false},
+		{"a.png", "", false},
+		{"a.png", "image/jpeg", true},
+		{"a.svg", "image/svg+xml", true},
+		{"a", "image/png", true},
+	}
+
+	for _, tt := range tests {
+		fh := newFileHeader(t, tt.filename, tt.contentType, []byte("x"))
+		err := ValidateImageType(fh)
+		if tt.wantErr && !errors.Is(err, ErrImageTypeInvalid) {
+			t.Errorf("%s (%s): expected ErrImageTypeInvalid, got %v", tt.filename, tt.contentType, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s (%s): unexpected error %v", tt.filename, tt.contentType, err)
+		}
+	}
+}
+
+// mp4Fixture is the start of an ISO base media file, enough to pass the
+// content check
+var mp4Fixture = append([]byte{0, 0, 0, 0x18}, []byte("ftypmp42\x00\x00\x00\x00")...)
+
+func TestUploadVideoWritesMP4(t *testing.T) {
+	useTempUploadsPath(t)
+
+	written, err := UploadVideo(newFileHeader(t, "demo.MP4", "video/mp4", mp4Fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(written.Filename, "video_") || filepath.Ext(written.Filename) != ".mp4" {
+		t.Errorf("got filename %q", written.Filename)
+	}
+	if _, err := os.Stat(filepath.Join(UploadsPath, written.Filename)); err != nil {
+		t.Errorf("expected the video to be written: %v", err)
+	}
+}
+
+func TestValidateVideo(t *testing.T) {
+	webm := []byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42, 0x86, 0x81}
+
+	tests := []struct {
+		name        string
+		filename    string
+		contentType string
+		data        []byte
+		wantErr     error
+	}{
+		{"mp4", "demo.mp4", "video/mp4", mp4Fixture, nil},
+		{"webm", "demo.webm", "video/webm", webm, nil},
+		{"untyped mp4", "demo.mp4", "application/octet-stream", mp4Fixture, nil},
+		{"image", "demo.png", "image/png", []byte("\x89PNG\r\n\x1a\n"), ErrVideoTypeInvalid},
+		{"renamed text file", "demo.mp4", "video/mp4", []byte("not a video at all"), ErrVideoTypeInvalid},
+		{"mismatched type", "demo.webm", "video/mp4", webm, ErrVideoTypeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVideo(newFileHeader(t, tt.filename, tt.contentType, tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateVideo() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateVideoRejectsLargeFiles(t *testing.T) {
+	fh := newFileHeader(t, "demo.mp4", "video/mp4", mp4Fixture)
+	fh.Size = MaxVideoUploadSize + 1
+
+	if err := ValidateVideo(fh); !errors.Is(err, ErrVideoTooLarge) {
+		t.Errorf("ValidateVideo() error = %v, want ErrVideoTooLarge", err)
+	}
+}
@@ -9,7 +9,10 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/vladwithcode/qrcatalog/internal/auth"
 	"github.com/vladwithcode/qrcatalog/internal/db"
+	"github.com/vladwithcode/qrcatalog/internal/notify"
+	"github.com/vladwithcode/qrcatalog/internal/qr"
 	"github.com/vladwithcode/qrcatalog/internal/routes"
+	"github.com/vladwithcode/qrcatalog/internal/uploads"
 )
 
 func main() {
@@ -28,8 +31,12 @@ func main() {
 		log.Fatalf("failed to connect to DB:\n%v\n", err)
 	}
 	defer dbPool.Close()
+	db.SetDBParameters()
 
 	auth.SetAuthParameters()
+	notify.SetNotifyParameters()
+	qr.SetQRParameters()
+	uploads.SetUploadParameters()
 
 	router := routes.NewRouter()
 	fmt.Printf("Starting server on port http://localhost:%s\n", port)
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products ADD COLUMN min_order_qty INT NOT NULL DEFAULT 1 CHECK (min_order_qty > 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE products DROP COLUMN min_order_qty;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE categories ADD COLUMN display_order INT NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN featured BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE categories DROP COLUMN display_order;
+ALTER TABLE products DROP COLUMN featured;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+DELETE FROM images_products WHERE image_id IS NULL OR product_id IS NULL;
+
+DELETE FROM images_products a
+    USING images_products b
+    WHERE a.ctid < b.ctid
+        AND a.image_id = b.image_id
+        AND a.product_id = b.product_id;
+
+ALTER TABLE images_products
+    ADD CONSTRAINT images_products_pkey PRIMARY KEY (image_id, product_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE images_products DROP CONSTRAINT images_products_pkey;
+-- +goose StatementEnd
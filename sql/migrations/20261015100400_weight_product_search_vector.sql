@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Weight product matches by where they happen: name (A), description (B),
+-- long_description (C) and category name (D)
+CREATE OR REPLACE FUNCTION update_product_search_vector()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := 
+        setweight(to_tsvector('spanish', COALESCE(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('spanish', COALESCE(NEW.description, '')), 'B') ||
+        setweight(to_tsvector('spanish', COALESCE(NEW.long_description, '')), 'C') ||
+        setweight(to_tsvector('spanish', COALESCE(
+            (SELECT name FROM public.categories WHERE id = NEW.category_id), ''
+        )), 'D');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE public.products SET search_vector = 
+    setweight(to_tsvector('spanish', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('spanish', COALESCE(description, '')), 'B') ||
+    setweight(to_tsvector('spanish', COALESCE(long_description, '')), 'C') ||
+    setweight(to_tsvector('spanish', COALESCE(
+        (SELECT name FROM public.categories WHERE id = category_id), ''
+    )), 'D');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION update_product_search_vector()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := 
+        setweight(to_tsvector('spanish', COALESCE(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('spanish', COALESCE(NEW.description, '')), 'B') ||
+        setweight(to_tsvector('spanish', COALESCE(NEW.long_description, '')), 'B') ||
+        setweight(to_tsvector('spanish', COALESCE(
+            (SELECT name FROM public.categories WHERE id = NEW.category_id), ''
+        )), 'C');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE public.products SET search_vector = 
+    setweight(to_tsvector('spanish', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('spanish', COALESCE(description, '')), 'B') ||
+    setweight(to_tsvector('spanish', COALESCE(long_description, '')), 'B') ||
+    setweight(to_tsvector('spanish', COALESCE(
+        (SELECT name FROM public.categories WHERE id = category_id), ''
+    )), 'C');
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE subcategories ADD COLUMN qrcode_filename TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE subcategories DROP COLUMN qrcode_filename;
+-- +goose StatementEnd
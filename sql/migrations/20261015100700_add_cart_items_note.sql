@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE cart_items ADD COLUMN note TEXT NOT NULL DEFAULT '';
+ALTER TABLE cart_items ADD COLUMN customizations JSONB NOT NULL DEFAULT '{}'::jsonb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE cart_items DROP COLUMN customizations;
+ALTER TABLE cart_items DROP COLUMN note;
+-- +goose StatementEnd
@@ -0,0 +1,92 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX idx_products_deleted_at ON products(deleted_at) WHERE deleted_at IS NULL;
+
+CREATE OR REPLACE VIEW catalog_categories AS
+SELECT 
+    c.id,
+    c.name,
+    COUNT(p.id) as product_count
+FROM public.categories c
+LEFT JOIN public.products p ON c.id = p.category_id AND p.deleted_at IS NULL
+GROUP BY c.id, c.name
+ORDER BY c.name;
+
+CREATE OR REPLACE VIEW catalog_products AS
+SELECT 
+    p.id,
+    p.name,
+    p.description,
+    p.long_description,
+    p.slug,
+    p.category_id,
+    c.name as category_name,
+    COALESCE(main_img.filename, '') as image_url,
+    p.price,
+    p.unit,
+    p.available,
+    p.quantity,
+    p.search_vector,
+    -- Aggregate gallery images as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(i.filename ORDER BY i.filename)
+            FROM public.images_products ip
+            JOIN public.images i ON ip.image_id = i.id
+            WHERE ip.product_id = p.id
+        ),
+        '[]'::json
+    ) as images
+FROM public.products p
+LEFT JOIN public.categories c ON p.category_id = c.id
+LEFT JOIN public.images main_img ON p.main_img_id = main_img.id
+WHERE p.deleted_at IS NULL
+ORDER BY p.name;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE VIEW catalog_categories AS
+SELECT 
+    c.id,
+    c.name,
+    COUNT(p.id) as product_count
+FROM public.categories c
+LEFT JOIN public.products p ON c.id = p.category_id
+GROUP BY c.id, c.name
+ORDER BY c.name;
+
+CREATE OR REPLACE VIEW catalog_products AS
+SELECT 
+    p.id,
+    p.name,
+    p.description,
+    p.long_description,
+    p.slug,
+    p.category_id,
+    c.name as category_name,
+    COALESCE(main_img.filename, '') as image_url,
+    p.price,
+    p.unit,
+    p.available,
+    p.quantity,
+    p.search_vector,
+    -- Aggregate gallery images as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(i.filename ORDER BY i.filename)
+            FROM public.images_products ip
+            JOIN public.images i ON ip.image_id = i.id
+            WHERE ip.product_id = p.id
+        ),
+        '[]'::json
+    ) as images
+FROM public.products p
+LEFT JOIN public.categories c ON p.category_id = c.id
+LEFT JOIN public.images main_img ON p.main_img_id = main_img.id
+ORDER BY p.name;
+
+DROP INDEX IF EXISTS idx_products_deleted_at;
+ALTER TABLE products DROP COLUMN deleted_at;
+-- +goose StatementEnd
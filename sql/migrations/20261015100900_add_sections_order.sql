@@ -0,0 +1,144 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sections ADD COLUMN order_idx INT NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE VIEW detailed_sections AS
+SELECT
+    s.id,
+    s.name,
+    s.title,
+    s.image,
+    s.bg_image,
+    s.created_at,
+    s.updated_at,
+    s.search_vector,
+    -- Aggregate paragraphs as JSON array, ordered by order field
+    COALESCE(
+        (
+            SELECT json_agg(
+                json_build_object(
+                    'id', sp.id,
+                    'section_id', sp.section_id,
+                    'order', sp.order_idx,
+                    'content', sp.content,
+                    'created_at', sp.created_at,
+                    'updated_at', sp.updated_at
+                ) ORDER BY sp.order_idx ASC
+            )
+            FROM section_paragraphs sp
+            WHERE sp.section_id = s.id
+        ),
+        '[]'::json
+    ) as paragraphs,
+    -- Aggregate services with their items as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(
+                json_build_object(
+                    'id', ss.id,
+                    'section_id', ss.section_id,
+                    'title', ss.title,
+                    'price', ss.price,
+                    'description', ss.description,
+                    'created_at', ss.created_at,
+                    'updated_at', ss.updated_at,
+                    'items', COALESCE((
+                        SELECT json_agg(
+                            json_build_object(
+                                'id', ssi.id,
+                                'service_id', ssi.service_id,
+                                'order', ssi.order_idx,
+                                'price', ssi.price,
+                                'content', ssi.content,
+                                'content_as_list', ssi.content_as_list,
+                                'created_at', ssi.created_at,
+                                'updated_at', ssi.updated_at
+                            ) ORDER BY ssi.order_idx ASC
+                        )
+                        FROM section_service_items ssi
+                        WHERE ssi.service_id = ss.id
+                    ), '[]'::json)
+                ) ORDER BY ss.created_at ASC
+            )
+            FROM section_service ss
+            WHERE ss.section_id = s.id
+        ),
+        '[]'::json
+    ) as services,
+    s.order_idx
+FROM sections s
+ORDER BY s.order_idx ASC, s.created_at DESC;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP VIEW IF EXISTS detailed_sections;
+
+CREATE VIEW detailed_sections AS
+SELECT
+    s.id,
+    s.name,
+    s.title,
+    s.image,
+    s.bg_image,
+    s.created_at,
+    s.updated_at,
+    s.search_vector,
+    -- Aggregate paragraphs as JSON array, ordered by order field
+    COALESCE(
+        (
+            SELECT json_agg(
+                json_build_object(
+                    'id', sp.id,
+                    'section_id', sp.section_id,
+                    'order', sp.order_idx,
+                    'content', sp.content,
+                    'created_at', sp.created_at,
+                    'updated_at', sp.updated_at
+                ) ORDER BY sp.order_idx ASC
+            )
+            FROM section_paragraphs sp
+            WHERE sp.section_id = s.id
+        ),
+        '[]'::json
+    ) as paragraphs,
+    -- Aggregate services with their items as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(
+                json_build_object(
+                    'id', ss.id,
+                    'section_id', ss.section_id,
+                    'title', ss.title,
+                    'price', ss.price,
+                    'description', ss.description,
+                    'created_at', ss.created_at,
+                    'updated_at', ss.updated_at,
+                    'items', COALESCE((
+                        SELECT json_agg(
+                            json_build_object(
+                                'id', ssi.id,
+                                'service_id', ssi.service_id,
+                                'order', ssi.order_idx,
+                                'price', ssi.price,
+                                'content', ssi.content,
+                                'content_as_list', ssi.content_as_list,
+                                'created_at', ssi.created_at,
+                                'updated_at', ssi.updated_at
+                            ) ORDER BY ssi.order_idx ASC
+                        )
+                        FROM section_service_items ssi
+                        WHERE ssi.service_id = ss.id
+                    ), '[]'::json)
+                ) ORDER BY ss.created_at ASC
+            )
+            FROM section_service ss
+            WHERE ss.section_id = s.id
+        ),
+        '[]'::json
+    ) as services
+FROM sections s
+ORDER BY s.created_at DESC;
+
+ALTER TABLE sections DROP COLUMN order_idx;
+-- +goose StatementEnd
@@ -0,0 +1,106 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products ADD COLUMN available_from TIMESTAMPTZ;
+ALTER TABLE products ADD COLUMN available_until TIMESTAMPTZ;
+ALTER TABLE products ADD CONSTRAINT products_availability_window_check
+    CHECK (available_from IS NULL OR available_until IS NULL OR available_from < available_until);
+
+-- product_in_window reports whether the current time falls within a
+-- product's availability window. Missing bounds leave that side open
+CREATE OR REPLACE FUNCTION product_in_window(available_from TIMESTAMPTZ, available_until TIMESTAMPTZ)
+RETURNS BOOLEAN AS $$
+    SELECT (available_from IS NULL OR available_from <= NOW())
+        AND (available_until IS NULL OR available_until > NOW());
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE VIEW catalog_categories AS
+SELECT 
+    c.id,
+    c.name,
+    COUNT(p.id) as product_count
+FROM public.categories c
+LEFT JOIN public.products p ON c.id = p.category_id AND p.deleted_at IS NULL
+    AND product_in_window(p.available_from, p.available_until)
+GROUP BY c.id, c.name
+ORDER BY c.name;
+
+CREATE OR REPLACE VIEW catalog_products AS
+SELECT 
+    p.id,
+    p.name,
+    p.description,
+    p.long_description,
+    p.slug,
+    p.category_id,
+    c.name as category_name,
+    COALESCE(main_img.filename, '') as image_url,
+    p.price,
+    p.unit,
+    p.available,
+    p.quantity,
+    p.search_vector,
+    -- Aggregate gallery images as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(i.filename ORDER BY i.filename)
+            FROM public.images_products ip
+            JOIN public.images i ON ip.image_id = i.id
+            WHERE ip.product_id = p.id
+        ),
+        '[]'::json
+    ) as images
+FROM public.products p
+LEFT JOIN public.categories c ON p.category_id = c.id
+LEFT JOIN public.images main_img ON p.main_img_id = main_img.id
+WHERE p.deleted_at IS NULL AND product_in_window(p.available_from, p.available_until)
+ORDER BY p.name;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE VIEW catalog_categories AS
+SELECT 
+    c.id,
+    c.name,
+    COUNT(p.id) as product_count
+FROM public.categories c
+LEFT JOIN public.products p ON c.id = p.category_id AND p.deleted_at IS NULL
+GROUP BY c.id, c.name
+ORDER BY c.name;
+
+CREATE OR REPLACE VIEW catalog_products AS
+SELECT 
+    p.id,
+    p.name,
+    p.description,
+    p.long_description,
+    p.slug,
+    p.category_id,
+    c.name as category_name,
+    COALESCE(main_img.filename, '') as image_url,
+    p.price,
+    p.unit,
+    p.available,
+    p.quantity,
+    p.search_vector,
+    -- Aggregate gallery images as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(i.filename ORDER BY i.filename)
+            FROM public.images_products ip
+            JOIN public.images i ON ip.image_id = i.id
+            WHERE ip.product_id = p.id
+        ),
+        '[]'::json
+    ) as images
+FROM public.products p
+LEFT JOIN public.categories c ON p.category_id = c.id
+LEFT JOIN public.images main_img ON p.main_img_id = main_img.id
+WHERE p.deleted_at IS NULL
+ORDER BY p.name;
+
+DROP FUNCTION IF EXISTS product_in_window(TIMESTAMPTZ, TIMESTAMPTZ);
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_availability_window_check;
+ALTER TABLE products DROP COLUMN available_until;
+ALTER TABLE products DROP COLUMN available_from;
+-- +goose StatementEnd
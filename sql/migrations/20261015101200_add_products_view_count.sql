@@ -0,0 +1,74 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE products ADD COLUMN view_count BIGINT NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE VIEW catalog_products AS
+SELECT 
+    p.id,
+    p.name,
+    p.description,
+    p.long_description,
+    p.slug,
+    p.category_id,
+    c.name as category_name,
+    COALESCE(main_img.filename, '') as image_url,
+    p.price,
+    p.unit,
+    p.available,
+    p.quantity,
+    p.search_vector,
+    -- Aggregate gallery images as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(i.filename ORDER BY i.filename)
+            FROM public.images_products ip
+            JOIN public.images i ON ip.image_id = i.id
+            WHERE ip.product_id = p.id
+        ),
+        '[]'::json
+    ) as images,
+    p.view_count
+FROM public.products p
+LEFT JOIN public.categories c ON p.category_id = c.id
+LEFT JOIN public.images main_img ON p.main_img_id = main_img.id
+WHERE p.deleted_at IS NULL AND product_in_window(p.available_from, p.available_until)
+ORDER BY p.name;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Columns can't be dropped from a view through CREATE OR REPLACE
+DROP VIEW catalog_products;
+CREATE VIEW catalog_products AS
+SELECT 
+    p.id,
+    p.name,
+    p.description,
+    p.long_description,
+    p.slug,
+    p.category_id,
+    c.name as category_name,
+    COALESCE(main_img.filename, '') as image_url,
+    p.price,
+    p.unit,
+    p.available,
+    p.quantity,
+    p.search_vector,
+    -- Aggregate gallery images as JSON array
+    COALESCE(
+        (
+            SELECT json_agg(i.filename ORDER BY i.filename)
+            FROM public.images_products ip
+            JOIN public.images i ON ip.image_id = i.id
+            WHERE ip.product_id = p.id
+        ),
+        '[]'::json
+    ) as images
+FROM public.products p
+LEFT JOIN public.categories c ON p.category_id = c.id
+LEFT JOIN public.images main_img ON p.main_img_id = main_img.id
+WHERE p.deleted_at IS NULL AND product_in_window(p.available_from, p.available_until)
+ORDER BY p.name;
+
+ALTER TABLE products DROP COLUMN view_count;
+-- +goose StatementEnd
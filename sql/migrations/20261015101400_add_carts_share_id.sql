@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Opaque id put in cart share links, so links never expose the cart id that
+-- grants write access through the cart cookie
+ALTER TABLE carts ADD COLUMN share_id UUID UNIQUE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE carts DROP COLUMN share_id;
+-- +goose StatementEnd